@@ -0,0 +1,436 @@
+package cmd
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/rsa"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	ecies "github.com/ecies/go/v2"
+
+	"recovery-tool/common"
+	"recovery-tool/common/code"
+	"recovery-tool/crypto"
+	"recovery-tool/crypto/secure"
+)
+
+// BackupMatch is a team in the backup archives matching the user mnemonic
+type BackupMatch struct {
+	Archive string `yaml:"archive" json:"archive"`
+	Entry   string `yaml:"entry" json:"entry"` // e.g. hbc_623
+
+	team *encryptedTeam
+}
+
+func (m *BackupMatch) String() string {
+	return fmt.Sprintf("%s:%s", m.Archive, m.Entry)
+}
+
+// backup schema versions, the entries without version are BackupVersion1
+const (
+	BackupVersion1 = 1
+
+	LatestBackupVersion = BackupVersion1
+)
+
+// encryptedTeam is a backup entry, the hbc shares and chain codes are paired by index
+type encryptedTeam struct {
+	Version       int      `json:"version"`
+	HbcPrivKeys   []string `json:"hbc_private_keys"`
+	HbcChainCodes []string `json:"hbc_chain_codes"`
+	UserPubKey    string   `json:"user_pub_key"`
+	// the team root public keys in hex, optional, verified against the recovered keys
+	EcdsaPubKey string `json:"ecdsa_pub_key,omitempty"`
+	EddsaPubKey string `json:"eddsa_pub_key,omitempty"`
+}
+
+// parseTeam parses a backup entry of any supported version, and checks the fields needed to match and decrypt it
+func parseTeam(data []byte) (*encryptedTeam, error) {
+	team := &encryptedTeam{}
+	if err := json.Unmarshal(data, team); err != nil {
+		return nil, code.NewI18nError(code.FailedToParseDataErr, fmt.Sprintf("unmarshal team failed: %s", err.Error()))
+	}
+
+	switch team.Version {
+	case 0:
+		team.Version = BackupVersion1
+	case BackupVersion1:
+	default:
+		return nil, code.NewI18nError(code.BackupVersionErr, fmt.Sprintf("unsupported backup version %d, the latest is %d", team.Version, LatestBackupVersion))
+	}
+
+	if len(team.UserPubKey) == 0 {
+		return nil, code.NewI18nError(code.FailedToParseDataErr, "team has no user pubkey")
+	}
+	if len(team.HbcPrivKeys) == 0 {
+		return nil, code.NewI18nError(code.FailedToParseDataErr, "team has no hbc share")
+	}
+	if len(team.HbcPrivKeys) != len(team.HbcChainCodes) {
+		return nil, code.NewI18nError(code.FailedToParseDataErr, fmt.Sprintf("team has %d hbc shares but %d chain codes", len(team.HbcPrivKeys), len(team.HbcChainCodes)))
+	}
+	return team, nil
+}
+
+// zipPaths returns zip_path followed by zip_paths
+func (params *RecoveryInput) zipPaths() []string {
+	paths := make([]string, 0, len(params.ZipPaths)+1)
+	if len(params.ZipPath) > 0 {
+		paths = append(paths, params.ZipPath)
+	}
+	return append(paths, params.ZipPaths...)
+}
+
+// listBackupArchives replaces the directories in paths with the zip files in them, sorted by name
+func listBackupArchives(paths []string) ([]string, error) {
+	archives := make([]string, 0, len(paths))
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, code.NewI18nError(code.FileNotFound, fmt.Sprintf("backup archive not found: %s", path))
+		}
+		if !info.IsDir() {
+			archives = append(archives, path)
+			continue
+		}
+
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, code.NewI18nError(code.FileNotFound, fmt.Sprintf("read backup directory %s failed: %s", path, err))
+		}
+		dirArchives := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			if !entry.IsDir() && strings.EqualFold(filepath.Ext(entry.Name()), ".zip") {
+				dirArchives = append(dirArchives, filepath.Join(path, entry.Name()))
+			}
+		}
+		if len(dirArchives) == 0 {
+			return nil, code.NewI18nError(code.FileNotFound, fmt.Sprintf("no zip file in backup directory: %s", path))
+		}
+		sort.Strings(dirArchives)
+		archives = append(archives, dirArchives...)
+	}
+	return archives, nil
+}
+
+// backupEntry is a team in a backup archive, file is nil if the archive failed to open
+type backupEntry struct {
+	archive string
+	file    *zip.File
+}
+
+type scannedEntry struct {
+	team    *encryptedTeam
+	matched bool
+	err     error
+}
+
+// findHbcPrivs scans every entry of the archives for the teams matching userPubKey, and returns the hbc keys of the first one.
+// The entries are decrypted by workers in parallel, and with stopOnMatch the entries after the first matched one are skipped.
+// A failed archive or entry does not stop the scan. If no team matches, the error of the first failed entry is
+// returned only when every entry failed, otherwise the mnemonic does not match and the failures are logged.
+// A matched team failing to decrypt returns its error.
+// More than one matching team is warned, as the mnemonic is expected to belong to a single team.
+func findHbcPrivs(
+	zipPaths []string,
+	userPubKey string,
+	eciesPrivKey *ecies.PrivateKey,
+	rsaPrivKey *rsa.PrivateKey,
+	workers int,
+	stopOnMatch bool,
+) ([]*common.RootKey, []*BackupMatch, error) {
+	archives, err := listBackupArchives(zipPaths)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var entries []backupEntry
+	var scanned []scannedEntry
+	notScanned, notScannedArchives := 0, 0
+	for i, archive := range archives {
+		archiveEntries, archiveScanned, count := scanBackupArchive(archive, userPubKey, eciesPrivKey, rsaPrivKey, workers, stopOnMatch)
+		entries = append(entries, archiveEntries[:count]...)
+		scanned = append(scanned, archiveScanned[:count]...)
+		notScanned += len(archiveEntries) - count
+		if stopOnMatch && count > 0 && archiveScanned[count-1].matched && archiveScanned[count-1].err == nil {
+			notScannedArchives = len(archives) - i - 1
+			break
+		}
+	}
+
+	var result []*common.RootKey
+	var matches []*BackupMatch
+	var firstErr, matchErr error
+	skipped := 0
+
+	for i, entry := range entries {
+		err := scanned[i].err
+		if err == nil && scanned[i].matched {
+			match := &BackupMatch{Archive: entry.archive, Entry: entry.file.Name, team: scanned[i].team}
+			common.Logger.Infof("backup %s matches the mnemonic", match)
+
+			var privs []*common.RootKey
+			privs, err = decryptHbcPrivs(scanned[i].team, eciesPrivKey, rsaPrivKey)
+			if err != nil && matchErr == nil {
+				matchErr = err
+			}
+			if err == nil {
+				matches = append(matches, match)
+				if result == nil {
+					result = privs
+				} else {
+					if !sameRootKeys(result, privs) {
+						common.Logger.Warnf("backup %s matches the mnemonic with different keys from %s, using %s", match, matches[0], matches[0])
+					}
+					wipeRootKeys(privs)
+				}
+			}
+		}
+		if err != nil {
+			if entry.file != nil {
+				common.Logger.Warnf("scan backup %s:%s failed: %s", entry.archive, entry.file.Name, err)
+			}
+			skipped++
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	if skipped > 0 {
+		common.Logger.Warnf("%d of %d backup entries are skipped, the first error: %s", skipped, len(entries), firstErr)
+	}
+	if len(matches) == 0 {
+		if matchErr != nil {
+			return nil, nil, matchErr
+		}
+		if skipped > 0 && skipped == len(entries) {
+			return nil, nil, firstErr
+		}
+		return nil, nil, code.NewI18nError(code.MnemonicNotMatch, "mnemonic and zip do not match")
+	}
+	if len(matches) > 1 {
+		common.Logger.Warnf("%d teams match the mnemonic: %v", len(matches), matches)
+	}
+	if notScanned > 0 || notScannedArchives > 0 {
+		common.Logger.Infof("%d backup entries and %d archives after the match are not scanned", notScanned, notScannedArchives)
+	}
+	return result, matches, nil
+}
+
+// scanBackupArchive opens an archive, scans its entries and closes it before the next archive is opened.
+// An archive failing to open is a single scanned entry without file, carrying the error.
+func scanBackupArchive(
+	archive string,
+	userPubKey string,
+	eciesPrivKey *ecies.PrivateKey,
+	rsaPrivKey *rsa.PrivateKey,
+	workers int,
+	stopOnMatch bool,
+) ([]backupEntry, []scannedEntry, int) {
+	zf, err := zip.OpenReader(archive)
+	if err != nil {
+		common.Logger.Errorf("open backup %s failed: %s", archive, err)
+		err = code.NewI18nError(code.FileFormatErr, "zip file format error")
+		return []backupEntry{{archive: archive}}, []scannedEntry{{err: err}}, 1
+	}
+	defer zf.Close()
+
+	entries := make([]backupEntry, 0, len(zf.File))
+	for _, file := range zf.File {
+		if !file.FileInfo().IsDir() {
+			entries = append(entries, backupEntry{archive: archive, file: file})
+		}
+	}
+	scanned, count := scanBackupEntries(entries, userPubKey, eciesPrivKey, rsaPrivKey, workers, stopOnMatch)
+	return entries, scanned, count
+}
+
+// scanBackupEntries matches the entries on a pool of workers, every entry is written into its own slot.
+// With stopOnMatch, the workers stop taking the entries after the first matched one,
+// and only the slots before it (and itself) are scanned, which is the returned count.
+func scanBackupEntries(
+	entries []backupEntry,
+	userPubKey string,
+	eciesPrivKey *ecies.PrivateKey,
+	rsaPrivKey *rsa.PrivateKey,
+	workers int,
+	stopOnMatch bool,
+) ([]scannedEntry, int) {
+	scanned := make([]scannedEntry, len(entries))
+
+	// the index of the first matched entry, only lowered
+	firstMatch := int64(len(entries))
+	stopped := func(i int) bool {
+		return stopOnMatch && int64(i) > atomic.LoadInt64(&firstMatch)
+	}
+
+	entryCh := make(chan int)
+	wg := &sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range entryCh {
+				if stopped(i) {
+					continue
+				}
+				team, matched, err := matchTeam(entries[i].file, userPubKey, eciesPrivKey, rsaPrivKey)
+				scanned[i] = scannedEntry{team: team, matched: matched, err: err}
+				if matched && err == nil {
+					for {
+						current := atomic.LoadInt64(&firstMatch)
+						if int64(i) >= current || atomic.CompareAndSwapInt64(&firstMatch, current, int64(i)) {
+							break
+						}
+					}
+				}
+			}
+		}()
+	}
+
+	for i := range entries {
+		if stopped(i) {
+			break
+		}
+		entryCh <- i
+	}
+	close(entryCh)
+	wg.Wait()
+
+	if !stopOnMatch || firstMatch == int64(len(entries)) {
+		return scanned, len(entries)
+	}
+	return scanned, int(firstMatch) + 1
+}
+
+func matchTeam(
+	file *zip.File,
+	userPubKey string,
+	eciesPrivKey *ecies.PrivateKey,
+	rsaPrivKey *rsa.PrivateKey,
+) (*encryptedTeam, bool, error) {
+	fileBytes, err := common.ReadAll(file)
+	if err != nil {
+		return nil, false, code.NewI18nError(code.FileFormatErr, err.Error())
+	}
+
+	encrypted, err := parseTeam(fileBytes)
+	if err != nil {
+		return nil, false, err
+	}
+
+	decryptedUsrPubKey, err := decryptUserPubKey(encrypted.UserPubKey, eciesPrivKey, rsaPrivKey)
+	if err != nil {
+		return nil, false, err
+	}
+	return encrypted, decryptedUsrPubKey == userPubKey, nil
+}
+
+func decryptHbcPrivs(team *encryptedTeam, eciesPrivKey *ecies.PrivateKey, rsaPrivKey *rsa.PrivateKey) ([]*common.RootKey, error) {
+	privs := make([]*common.RootKey, 0, len(team.HbcPrivKeys))
+	for i := range team.HbcPrivKeys {
+		priv, err := decryptHbcPriv(team.HbcPrivKeys[i], team.HbcChainCodes[i], eciesPrivKey, rsaPrivKey)
+		if err != nil {
+			wipeRootKeys(privs)
+			return nil, err
+		}
+		privs = append(privs, priv)
+	}
+	return privs, nil
+}
+
+// wipeRootKeys zeroes the keys of a team that is not used
+func wipeRootKeys(keys []*common.RootKey) {
+	(&common.RootKeys{Shares: keys}).Wipe()
+}
+
+func sameRootKeys(a, b []*common.RootKey) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].PrivKey.Cmp(b[i].PrivKey) != 0 || !bytes.Equal(a[i].ChainCode, b[i].ChainCode) {
+			return false
+		}
+	}
+	return true
+}
+
+func decryptUserPubKey(userPubKey string, eciesPrivKey *ecies.PrivateKey, rsaPrivKey *rsa.PrivateKey) (string, error) {
+	userPubKeyBytes, err := hex.DecodeString(userPubKey)
+	if err != nil {
+		return "", code.NewI18nError(code.FailedToParseDataErr, fmt.Sprintf("hex decode user pubkey error: %s", err.Error()))
+	}
+
+	decryptedUsrPubKey, err := crypto.RsaDecryptOAEP(rsaPrivKey, userPubKeyBytes)
+	if err != nil {
+		return "", code.NewI18nError(code.RSADecryptBackupDataErr, fmt.Sprintf("rsa decrypt user pubkey error: %s", err.Error()))
+	}
+
+	decryptedUsrPubKey, err = ecies.Decrypt(eciesPrivKey, decryptedUsrPubKey)
+	if err != nil {
+		return "", code.NewI18nError(code.EciesDecryptBackupDataErr, fmt.Sprintf("ecies decrypt user pubkey error: %s", err.Error()))
+	}
+
+	return hex.EncodeToString(decryptedUsrPubKey), nil
+}
+
+func decryptHbcPriv(
+	privKey, chainCode string,
+	eciesPrivKey *ecies.PrivateKey,
+	rsaPrivKey *rsa.PrivateKey,
+) (*common.RootKey, error) {
+	privKeyBytes, err := hex.DecodeString(privKey)
+	if err != nil {
+		return nil, code.NewI18nError(code.FailedToParseDataErr, fmt.Sprintf("hex decode privkey failed: %s", err.Error()))
+	}
+	chainCodeBytes, err := hex.DecodeString(chainCode)
+	if err != nil {
+		return nil, code.NewI18nError(code.FailedToParseDataErr, fmt.Sprintf("hex decode chaincode failed: %s", err.Error()))
+	}
+
+	decryptedPrivKey, err := crypto.RsaDecryptOAEP(rsaPrivKey, privKeyBytes)
+	if err != nil {
+		return nil, code.NewI18nError(code.RSADecryptBackupDataErr, fmt.Sprintf("rsa decode privkey failed: %s", err.Error()))
+	}
+	decryptedChainCode, err := crypto.RsaDecryptOAEP(rsaPrivKey, chainCodeBytes)
+	if err != nil {
+		return nil, code.NewI18nError(code.RSADecryptBackupDataErr, fmt.Sprintf("rsa decode chaincode failed: %s", err.Error()))
+	}
+
+	decryptedPrivKey, err = ecies.Decrypt(eciesPrivKey, decryptedPrivKey)
+	if err != nil {
+		return nil, code.NewI18nError(code.EciesDecryptBackupDataErr, fmt.Sprintf("ecies decode privkey failed: %s", err.Error()))
+	}
+	privKeyBuf := secure.Copy(decryptedPrivKey)
+	defer privKeyBuf.Wipe()
+	decryptedChainCode, err = ecies.Decrypt(eciesPrivKey, decryptedChainCode)
+	if err != nil {
+		return nil, code.NewI18nError(code.EciesDecryptBackupDataErr, fmt.Sprintf("ecies decode chaincode failed: %s", err.Error()))
+	}
+
+	if len(privKeyBuf.Bytes()) == 0 || len(privKeyBuf.Bytes()) > 32 {
+		return nil, code.NewI18nError(code.FailedToParseDataErr, fmt.Sprintf("invalid privkey length: %d", len(privKeyBuf.Bytes())))
+	}
+	if len(decryptedChainCode) != 32 {
+		return nil, code.NewI18nError(code.FailedToParseDataErr, fmt.Sprintf("invalid chaincode length: %d", len(decryptedChainCode)))
+	}
+
+	privateKey := new(big.Int).SetBytes(privKeyBuf.Bytes())
+
+	return &common.RootKey{
+		PrivKey:     privateKey,
+		EcdsaPubKey: crypto.ScalarBaseMult(crypto.S256(), privateKey),
+		EddsaPubKey: crypto.ScalarBaseMult(crypto.Edwards(), privateKey),
+		ChainCode:   decryptedChainCode,
+	}, nil
+}
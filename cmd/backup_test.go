@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"archive/zip"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	ecies "github.com/ecies/go/v2"
+	"github.com/stretchr/testify/assert"
+
+	"recovery-tool/common/code"
+	"recovery-tool/crypto"
+)
+
+// backupKeys are the decryption keys of a test backup
+type backupKeys struct {
+	ecies *ecies.PrivateKey
+	rsa   *rsa.PrivateKey
+}
+
+func newBackupKeys(t *testing.T) *backupKeys {
+	eciesPrivKey, err := ecies.GenerateKey()
+	assert.NoError(t, err)
+	rsaPrivKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	return &backupKeys{ecies: eciesPrivKey, rsa: rsaPrivKey}
+}
+
+// encrypt encrypts data the way the backups are, by ecies then rsa, in hex
+func (keys *backupKeys) encrypt(t *testing.T, data []byte) string {
+	encrypted, err := ecies.Encrypt(keys.ecies.PublicKey, data)
+	assert.NoError(t, err)
+	encrypted, err = crypto.RsaEncryptOAEP(&keys.rsa.PublicKey, encrypted)
+	assert.NoError(t, err)
+	return hex.EncodeToString(encrypted)
+}
+
+// newTeam encrypts the hbc shares, whose private keys are privKeys and chain codes are all of the index byte
+func (keys *backupKeys) newTeam(t *testing.T, userPubKey []byte, privKeys ...int64) *encryptedTeam {
+	team := &encryptedTeam{UserPubKey: keys.encrypt(t, userPubKey)}
+	for i, privKey := range privKeys {
+		chainCode := make([]byte, 32)
+		for j := range chainCode {
+			chainCode[j] = byte(i + 1)
+		}
+		team.HbcPrivKeys = append(team.HbcPrivKeys, keys.encrypt(t, big.NewInt(privKey).Bytes()))
+		team.HbcChainCodes = append(team.HbcChainCodes, keys.encrypt(t, chainCode))
+	}
+	return team
+}
+
+func writeBackupArchive(t *testing.T, path string, teams map[string]*encryptedTeam) {
+	f, err := os.Create(path)
+	assert.NoError(t, err)
+	defer f.Close()
+	w := zip.NewWriter(f)
+	for name, team := range teams {
+		data, err := json.Marshal(team)
+		assert.NoError(t, err)
+		entry, err := w.Create(name)
+		assert.NoError(t, err)
+		_, err = entry.Write(data)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, w.Close())
+}
+
+func TestParseTeam(t *testing.T) {
+	_, err := parseTeam([]byte(`{"user_pub_key":"00","hbc_private_keys":["01","02","03"],"hbc_chain_codes":["04","05","06"]}`))
+	assert.NoError(t, err)
+
+	for _, data := range []string{
+		`[]`,
+		`{"version":2,"user_pub_key":"00","hbc_private_keys":["01"],"hbc_chain_codes":["02"]}`,
+		`{"hbc_private_keys":["01"],"hbc_chain_codes":["02"]}`,
+		`{"user_pub_key":"00"}`,
+		`{"user_pub_key":"00","hbc_private_keys":["01","02","03"],"hbc_chain_codes":["04","05"]}`,
+	} {
+		_, err := parseTeam([]byte(data))
+		assert.Error(t, err, data)
+	}
+}
+
+func TestDecryptHbcPrivs(t *testing.T) {
+	keys := newBackupKeys(t)
+	team := keys.newTeam(t, []byte{1}, 0x1234, 0x5678, 0x9abc)
+
+	privs, err := decryptHbcPrivs(team, keys.ecies, keys.rsa)
+	assert.NoError(t, err)
+	assert.Len(t, privs, 3)
+	for i, privKey := range []int64{0x1234, 0x5678, 0x9abc} {
+		assert.Equal(t, big.NewInt(privKey), privs[i].PrivKey)
+		assert.Equal(t, byte(i+1), privs[i].ChainCode[31])
+		assert.Equal(t, crypto.ScalarBaseMult(crypto.S256(), privs[i].PrivKey), privs[i].EcdsaPubKey)
+	}
+
+	// a corrupted share fails the team
+	team.HbcChainCodes[2] = team.HbcChainCodes[2][:len(team.HbcChainCodes[2])-2]
+	_, err = decryptHbcPrivs(team, keys.ecies, keys.rsa)
+	assert.Error(t, err)
+
+	other := newBackupKeys(t)
+	_, err = decryptHbcPrivs(keys.newTeam(t, []byte{1}, 0x1234), other.ecies, other.rsa)
+	i18nErr, ok := err.(*code.I18nError)
+	assert.True(t, ok)
+	assert.Equal(t, code.RSADecryptBackupDataErr, i18nErr.Code)
+}
+
+func TestFindHbcPrivs(t *testing.T) {
+	keys := newBackupKeys(t)
+	userPubKey := []byte{2, 3}
+	dir := t.TempDir()
+	writeBackupArchive(t, filepath.Join(dir, "a.zip"), map[string]*encryptedTeam{
+		"hbc_1": keys.newTeam(t, []byte{4, 5}, 0x1111, 0x2222),
+		"hbc_2": keys.newTeam(t, userPubKey, 0x1234, 0x5678, 0x9abc),
+	})
+	writeBackupArchive(t, filepath.Join(dir, "b.zip"), map[string]*encryptedTeam{
+		"hbc_3": keys.newTeam(t, userPubKey, 0x1234, 0x5678, 0x9abc),
+	})
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "0.zip"), []byte("junk"), 0600))
+
+	privs, matches, err := findHbcPrivs([]string{dir}, hex.EncodeToString(userPubKey), keys.ecies, keys.rsa, 2, false)
+	assert.NoError(t, err)
+	assert.Len(t, privs, 3)
+	assert.Equal(t, big.NewInt(0x9abc), privs[2].PrivKey)
+	if assert.Len(t, matches, 2) {
+		assert.Equal(t, "hbc_2", matches[0].Entry)
+		assert.Equal(t, "hbc_3", matches[1].Entry)
+	}
+
+	_, matches, err = findHbcPrivs([]string{dir}, hex.EncodeToString(userPubKey), keys.ecies, keys.rsa, 1, true)
+	assert.NoError(t, err)
+	if assert.Len(t, matches, 1) {
+		assert.Equal(t, filepath.Join(dir, "a.zip"), matches[0].Archive)
+	}
+
+	// the junk archive does not hide that no team matches
+	_, _, err = findHbcPrivs([]string{dir}, "0607", keys.ecies, keys.rsa, 2, false)
+	assert.Equal(t, code.MnemonicNotMatch, asI18nError(err).Code)
+
+	// the error is returned when every entry failed
+	junk := filepath.Join(t.TempDir(), "junk.zip")
+	assert.NoError(t, os.WriteFile(junk, []byte("junk"), 0600))
+	_, _, err = findHbcPrivs([]string{junk}, hex.EncodeToString(userPubKey), keys.ecies, keys.rsa, 2, false)
+	assert.Equal(t, code.FileFormatErr, asI18nError(err).Code)
+
+	// and when the matched team fails to decrypt
+	corrupted := keys.newTeam(t, userPubKey, 0x1234, 0x5678)
+	corrupted.HbcPrivKeys[1] = keys.newTeam(t, userPubKey).UserPubKey[:8]
+	archive := filepath.Join(t.TempDir(), "c.zip")
+	writeBackupArchive(t, archive, map[string]*encryptedTeam{
+		"hbc_4": corrupted,
+		"hbc_5": keys.newTeam(t, []byte{4, 5}, 0x1111, 0x2222),
+	})
+	_, _, err = findHbcPrivs([]string{archive, junk}, hex.EncodeToString(userPubKey), keys.ecies, keys.rsa, 2, false)
+	assert.Equal(t, code.RSADecryptBackupDataErr, asI18nError(err).Code)
+}
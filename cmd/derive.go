@@ -0,0 +1,255 @@
+package cmd
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcutil"
+
+	"recovery-tool/common"
+	"recovery-tool/common/code"
+	"recovery-tool/crypto/secure"
+)
+
+// deriveTask derives all the addresses of a chain in a vault (or an api wallet)
+type deriveTask struct {
+	walletType string
+	vaultIndex int // starts from 1, 0 for api wallets
+	chainName  string
+	rawCoin    RawCoin // derived instead of a chain when chainName is empty
+}
+
+func (t deriveTask) String() string {
+	target := fmt.Sprintf("chain %s", t.chainName)
+	if t.chainName == "" {
+		target = t.rawCoin.String()
+	}
+	if t.walletType == ApiWallet {
+		return fmt.Sprintf("api wallet, %s", target)
+	}
+	return fmt.Sprintf("vault %d, %s", t.vaultIndex, target)
+}
+
+// deriveTasks lists the tasks in output order: asset wallets first, then api wallets, each ordered by vault and chain.
+// The coin types come after the chains of a vault, in the input order.
+func deriveTasks(params *RecoveryInput) []deriveTask {
+	tasks := make([]deriveTask, 0)
+	for _, walletType := range params.walletTypes() {
+		vaultIndices := params.vaultIndices
+		if walletType == ApiWallet {
+			vaultIndices = []int{0}
+		}
+		for _, vaultIndex := range vaultIndices {
+			for _, chainName := range params.Chains {
+				tasks = append(tasks, deriveTask{walletType: walletType, vaultIndex: vaultIndex, chainName: chainName})
+			}
+			for _, coin := range params.CoinType {
+				tasks = append(tasks, deriveTask{walletType: walletType, vaultIndex: vaultIndex, rawCoin: coin})
+			}
+		}
+	}
+	return tasks
+}
+
+// concurrentDeriveChilds runs the derive tasks on a pool of params.Parallelism workers.
+// A failed task does not stop the others, its error is kept along with the childs derived before the failure.
+// Every task writes into its own slot, so the result keeps the task order without sorting.
+func concurrentDeriveChilds(ctx context.Context, params *RecoveryInput, rootKeys *common.RootKeys) *RecoveryResult {
+	tasks := deriveTasks(params)
+	results := make([][]*DeriveResult, len(tasks))
+	errs := make([]error, len(tasks))
+
+	taskCh := make(chan int)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < params.Parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for taskIndex := range taskCh {
+				results[taskIndex], errs[taskIndex] = deriveTaskChilds(ctx, tasks[taskIndex], params.addressIndices, rootKeys, params.AddressesOnly)
+			}
+		}()
+	}
+
+dispatch:
+	for taskIndex := range tasks {
+		select {
+		case taskCh <- taskIndex:
+		case <-ctx.Done():
+			// the tasks never dispatched are failed by the cancellation as well
+			for ; taskIndex < len(tasks); taskIndex++ {
+				errs[taskIndex] = ctx.Err()
+			}
+			break dispatch
+		}
+	}
+	close(taskCh)
+	wg.Wait()
+
+	total := 0
+	for _, childs := range results {
+		total += len(childs)
+	}
+	result := &RecoveryResult{Keys: make([]*DeriveResult, 0, total)}
+	for taskIndex, task := range tasks {
+		result.Keys = append(result.Keys, results[taskIndex]...)
+		if errs[taskIndex] != nil {
+			result.Errors = append(result.Errors, newDeriveError(task, errs[taskIndex]))
+		}
+	}
+	return result
+}
+
+// deriveTaskChilds stops at the first failed address, returning the childs derived before it
+func deriveTaskChilds(ctx context.Context, task deriveTask, addressIndices []int, rootKeys *common.RootKeys, addressesOnly bool) ([]*DeriveResult, error) {
+	deriveResult := make([]*DeriveResult, 0, len(addressIndices))
+	for _, addressIndex := range addressIndices {
+		if err := ctx.Err(); err != nil {
+			return deriveResult, err
+		}
+		var child *DeriveResult
+		var err error
+		if task.chainName == "" {
+			child, err = deriveRawChild(task.walletType, task.vaultIndex, addressIndex, task.rawCoin, rootKeys, addressesOnly)
+		} else {
+			child, err = deriveChild(task.walletType, task.vaultIndex, addressIndex, task.chainName, rootKeys, addressesOnly)
+		}
+		if err != nil {
+			return deriveResult, err
+		}
+		deriveResult = append(deriveResult, child)
+	}
+	return deriveResult, nil
+}
+
+// asI18nError returns err as an I18nError, an error of another type is a system error
+func asI18nError(err error) *code.I18nError {
+	i18nErr, ok := err.(*code.I18nError)
+	if !ok {
+		i18nErr = &code.I18nError{Code: code.SystemErr, Msg: err.Error()}
+	}
+	return i18nErr
+}
+
+func newDeriveError(task deriveTask, err error) *DeriveError {
+	i18nErr := asI18nError(err)
+	deriveErr := &DeriveError{
+		WalletType: task.walletType,
+		VaultIndex: task.vaultIndex,
+		Chain:      task.chainName,
+		Code:       i18nErr.Code,
+		Msg:        i18nErr.Msg,
+	}
+	if task.chainName == "" {
+		coinType := task.rawCoin.Coin
+		deriveErr.CoinType = &coinType
+		deriveErr.SignKind = task.rawCoin.SignKind
+	}
+	return deriveErr
+}
+
+// less puts asset wallets first, then api wallets, each ordered by vault and chain, and then coin type
+func (t deriveTask) less(other deriveTask) bool {
+	if t.walletType != other.walletType {
+		return t.walletType == AssetWallet
+	}
+	if t.vaultIndex != other.vaultIndex {
+		return t.vaultIndex < other.vaultIndex
+	}
+	if t.chainName != other.chainName {
+		// the coin types without chain name come last
+		return other.chainName == "" || (t.chainName != "" && t.chainName < other.chainName)
+	}
+	if t.rawCoin.Coin != other.rawCoin.Coin {
+		return t.rawCoin.Coin < other.rawCoin.Coin
+	}
+	return t.rawCoin.SignKind < other.rawCoin.SignKind
+}
+
+// sortDeriveResult orders the childs the same as the tasks, and then by address
+func sortDeriveResult(deriveResult []*DeriveResult) {
+	sort.Slice(deriveResult, func(i, j int) bool {
+		a, b := deriveResult[i], deriveResult[j]
+		taskA, taskB := a.task(), b.task()
+		if taskA != taskB {
+			return taskA.less(taskB)
+		}
+		return a.AddressIndex < b.AddressIndex
+	})
+}
+
+func sortDeriveErrors(deriveErrors []*DeriveError) {
+	sort.Slice(deriveErrors, func(i, j int) bool {
+		return deriveErrors[i].task().less(deriveErrors[j].task())
+	})
+}
+
+// deriveChild derives the key of one address, vaultIndex starts from 1 and is ignored by api wallets.
+// With addressesOnly, the public key is returned instead of the private key, which is wiped once the address is derived.
+func deriveChild(walletType string, vaultIndex, addressIndex int, chainName string, rootKeys *common.RootKeys, addressesOnly bool) (*DeriveResult, error) {
+	coinInfo, _ := common.ChainInfos[chainName]
+	hdPath := childPath(walletType, vaultIndex, int(coinInfo.CoinType), addressIndex)
+
+	privKey, address, err := common.DeriveChild(rootKeys, hdPath, int(coinInfo.CoinType))
+	if err != nil {
+		return nil, err
+	}
+
+	child := &DeriveResult{
+		WalletType:   walletType,
+		VaultIndex:   vaultIndex,
+		Chain:        chainName,
+		AddressIndex: addressIndex,
+		Address:      address,
+	}
+	if addressesOnly {
+		child.PubKey = hex.EncodeToString(common.PubKeyBytes(privKey, int(coinInfo.CoinType)))
+		secure.WipeBigInt(privKey)
+		return child, nil
+	}
+
+	var buf [32]byte
+	privKeyBytes := privKey.FillBytes(buf[:])
+	child.PrivKey = formatPrivKey(coinInfo.CoinType, privKeyBytes)
+	secure.Wipe(privKeyBytes)
+	secure.WipeBigInt(privKey)
+	return child, nil
+}
+
+// childPath returns the derivation path of an address, vaultIndex starts from 1 and is ignored by api wallets
+func childPath(walletType string, vaultIndex, coinType, addressIndex int) string {
+	if walletType == ApiWallet {
+		return fmt.Sprintf(ApiWalletPath, coinType, addressIndex)
+	}
+	return fmt.Sprintf(AssetWalletPath, vaultIndex-1, coinType, addressIndex)
+}
+
+func formatPrivKey(coinType uint32, privKeyBytes []byte) string {
+	if coinType == common.BTC || coinType == common.LTC || coinType == common.DOGE || coinType == common.BCH {
+		wif := &btcutil.WIF{}
+		priv, _ := btcec.PrivKeyFromBytes(btcec.S256(), privKeyBytes)
+		defer secure.WipeBigInt(priv.D)
+
+		switch coinType {
+		case common.BTC:
+			param := &common.BTCParams
+			wif, _ = btcutil.NewWIF(priv, param, true)
+		case common.DOGE:
+			param := &common.DOGEParams
+			wif, _ = btcutil.NewWIF(priv, param, true)
+		case common.LTC:
+			param := &common.LTCParams
+			wif, _ = btcutil.NewWIF(priv, param, true)
+		case common.BCH:
+			param := &common.BCHParams
+			wif, _ = btcutil.NewWIF(priv, param, true)
+		}
+		return wif.String()
+	}
+
+	return hex.EncodeToString(privKeyBytes)
+}
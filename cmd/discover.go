@@ -0,0 +1,262 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"recovery-tool/common"
+	"recovery-tool/common/code"
+	"recovery-tool/tx/apt"
+	"recovery-tool/tx/btc"
+	"recovery-tool/tx/dot"
+	"recovery-tool/tx/evm"
+	"recovery-tool/tx/sol"
+)
+
+const (
+	DefaultGapLimit        = 20
+	DefaultAddressGapLimit = 1
+
+	BtcNode = "https://blockstream.info/api"
+)
+
+// default nodes used by discovery, other chains must be set in RecoveryInput.Nodes
+var defaultNodes = map[string]string{
+	common.SolanaChain:   SolNode,
+	common.AptostChain:   AptNode,
+	common.PolkadotChain: DotNode,
+	common.BitcoinChain:  BtcNode,
+}
+
+type activity struct {
+	Used    bool   // has balance or any transaction
+	Balance string // main chain coin amount
+}
+
+func (params *RecoveryInput) nodeUrl(chainName string) string {
+	if url, ok := params.Nodes[chainName]; ok && url != "" {
+		return strings.TrimRight(url, "/")
+	}
+	return defaultNodes[chainName]
+}
+
+func checkDiscoverParams(params *RecoveryInput) error {
+	if params.GapLimit < 0 || params.AddressGapLimit < 0 {
+		return code.NewI18nError(code.ParamErr, "gap limit must >= 1")
+	}
+	if params.GapLimit == 0 {
+		params.GapLimit = DefaultGapLimit
+	}
+	if params.AddressGapLimit == 0 {
+		params.AddressGapLimit = DefaultAddressGapLimit
+	}
+
+	if len(params.CoinType) > 0 {
+		return code.NewI18nError(code.CoinTypeParamErr, "discovery is not supported on coin_type, which has no address")
+	}
+	for _, chainName := range params.Chains {
+		if !discoverable(chainName) {
+			return code.NewI18nError(code.ChainParamErr, fmt.Sprintf("discovery is not supported on chain: %s", chainName))
+		}
+		if params.nodeUrl(chainName) == "" {
+			return code.NewI18nError(code.ChainParamErr, fmt.Sprintf("node url of chain %s is required for discovery", chainName))
+		}
+	}
+	return nil
+}
+
+func discoverable(chainName string) bool {
+	switch chainName {
+	case common.SolanaChain, common.AptostChain, common.PolkadotChain,
+		common.BitcoinChain, common.LitecoinChain,
+		common.EthereumChain, common.BSCChain, common.HecoChain, common.PolygonChain, common.ArbitrumChain, common.BaseChain:
+		return true
+	default:
+		return false
+	}
+}
+
+// discoverChilds walks the vaults of every chain until GapLimit unused vaults in a row,
+// and the addresses of every vault until AddressGapLimit unused addresses in a row.
+// Api wallets have no vaults, their addresses are walked until GapLimit unused ones.
+// Only used addresses are returned, a failed chain keeps the ones found before the failure.
+func discoverChilds(ctx context.Context, params *RecoveryInput, rootKeys *common.RootKeys) *RecoveryResult {
+	result := &RecoveryResult{Keys: make([]*DeriveResult, 0)}
+
+	var lock sync.Mutex
+
+	wg := &sync.WaitGroup{}
+	for _, walletType := range params.walletTypes() {
+		for _, chainName := range params.Chains {
+			wg.Add(1)
+			go func(walletType, chainName string) {
+				defer wg.Done()
+
+				var childs []*DeriveResult
+				var failedVault int
+				query, err := newActivityQuerier(chainName, params.nodeUrl(chainName))
+				if err == nil {
+					if walletType == ApiWallet {
+						childs, _, err = discoverAddresses(ctx, ApiWallet, 0, params.GapLimit, chainName, query, rootKeys, params.AddressesOnly)
+					} else {
+						childs, failedVault, err = discoverVaults(ctx, params.GapLimit, params.AddressGapLimit, chainName, query, rootKeys, params.AddressesOnly)
+					}
+				}
+
+				lock.Lock()
+				defer lock.Unlock()
+				result.Keys = append(result.Keys, childs...)
+				if err != nil {
+					task := deriveTask{walletType: walletType, vaultIndex: failedVault, chainName: chainName}
+					result.Errors = append(result.Errors, newDeriveError(task, err))
+				}
+			}(walletType, chainName)
+		}
+	}
+	wg.Wait()
+
+	sortDeriveResult(result.Keys)
+	sortDeriveErrors(result.Errors)
+
+	return result
+}
+
+// discoverVaults returns the used addresses found before a failure, and the vault failed to discover
+func discoverVaults(ctx context.Context, gapLimit, addressGapLimit int, chainName string, query activityQuerier, rootKeys *common.RootKeys, addressesOnly bool) ([]*DeriveResult, int, error) {
+	deriveResult := make([]*DeriveResult, 0)
+
+	gap := 0
+	for vaultIndex := 1; gap < gapLimit; vaultIndex++ {
+		childs, used, err := discoverAddresses(ctx, AssetWallet, vaultIndex, addressGapLimit, chainName, query, rootKeys, addressesOnly)
+		deriveResult = append(deriveResult, childs...)
+		if err != nil {
+			return deriveResult, vaultIndex, err
+		}
+		if used {
+			gap = 0
+		} else {
+			gap++
+		}
+	}
+	common.Logger.Infof("[%s] discovered %d used addresses", chainName, len(deriveResult))
+	return deriveResult, 0, nil
+}
+
+// discoverAddresses walks the addresses of a vault (or an api wallet) until gapLimit unused ones in a row.
+// On failure, the used addresses found before it are returned with the error.
+func discoverAddresses(ctx context.Context, walletType string, vaultIndex, gapLimit int, chainName string, query activityQuerier, rootKeys *common.RootKeys, addressesOnly bool) ([]*DeriveResult, bool, error) {
+	deriveResult := make([]*DeriveResult, 0)
+
+	gap := 0
+	for addressIndex := 0; gap < gapLimit && addressIndex <= common.MaxIndex; addressIndex++ {
+		if err := ctx.Err(); err != nil {
+			return deriveResult, len(deriveResult) > 0, code.NewI18nError(code.SystemErr, fmt.Sprintf("discovery canceled: %s", err))
+		}
+		child, err := deriveChild(walletType, vaultIndex, addressIndex, chainName, rootKeys, addressesOnly)
+		if err != nil {
+			return deriveResult, len(deriveResult) > 0, err
+		}
+
+		act, err := query(ctx, child.Address)
+		if err != nil {
+			common.Logger.Errorf("[%s] query %s failed: %s", chainName, child.Address, err)
+			return deriveResult, len(deriveResult) > 0, code.NewI18nError(code.NetworkErr, err.Error())
+		}
+		if !act.Used {
+			gap++
+			continue
+		}
+
+		gap = 0
+		child.Balance = act.Balance
+		deriveResult = append(deriveResult, child)
+	}
+	return deriveResult, len(deriveResult) > 0, nil
+}
+
+// activityQuerier queries the activity of an address, one is built for each chain and reused for all its addresses
+type activityQuerier func(ctx context.Context, address string) (*activity, error)
+
+func newActivityQuerier(chainName, url string) (activityQuerier, error) {
+	switch chainName {
+	case common.SolanaChain:
+		client := sol.NewSol(url)
+		return func(ctx context.Context, address string) (*activity, error) {
+			balance, err := client.GetBalance(ctx, address)
+			if err != nil {
+				return nil, err
+			}
+			used := balance > 0
+			if !used {
+				if used, err = client.HasHistory(ctx, address); err != nil {
+					return nil, err
+				}
+			}
+			return &activity{Used: used, Balance: client.ToDecimal(balance).String()}, nil
+		}, nil
+	case common.AptostChain:
+		client := apt.NewApt(url)
+		return func(ctx context.Context, address string) (*activity, error) {
+			balance, _, err := client.BalanceWithContext(ctx, address)
+			if err != nil {
+				return nil, err
+			}
+			used := balance.IsPositive()
+			if !used {
+				nonce, err := client.GetNonceWithContext(ctx, address)
+				if err != nil && !strings.Contains(err.Error(), "not_found") {
+					return nil, err
+				}
+				used = nonce > 0
+			}
+			return &activity{Used: used, Balance: balance.String()}, nil
+		}, nil
+	case common.PolkadotChain:
+		client := dot.NewDot(url)
+		return func(ctx context.Context, address string) (*activity, error) {
+			balance, _, err := client.BalanceWithContext(ctx, address)
+			if err != nil {
+				return nil, err
+			}
+			used := balance.IsPositive()
+			if !used {
+				nonce, err := client.GetNonceWithContext(ctx, address)
+				if err != nil {
+					return nil, err
+				}
+				used = nonce > 0
+			}
+			return &activity{Used: used, Balance: balance.String()}, nil
+		}, nil
+	case common.BitcoinChain, common.LitecoinChain:
+		client := btc.NewBtc(url)
+		return func(ctx context.Context, address string) (*activity, error) {
+			stats, err := client.AddressStats(ctx, address)
+			if err != nil {
+				return nil, err
+			}
+			return &activity{Used: stats.TxCount() > 0, Balance: client.ToDecimal(stats.Amount()).String()}, nil
+		}, nil
+	case common.EthereumChain, common.BSCChain, common.HecoChain, common.PolygonChain, common.ArbitrumChain, common.BaseChain:
+		client := evm.NewEvm(url)
+		return func(ctx context.Context, address string) (*activity, error) {
+			balance, _, err := client.Balance(ctx, address)
+			if err != nil {
+				return nil, err
+			}
+			used := balance.IsPositive()
+			if !used {
+				nonce, err := client.GetNonce(ctx, address)
+				if err != nil {
+					return nil, err
+				}
+				used = nonce > 0
+			}
+			return &activity{Used: used, Balance: balance.String()}, nil
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported chain: %s", chainName)
+	}
+}
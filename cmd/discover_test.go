@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"context"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"recovery-tool/common"
+	"recovery-tool/common/code"
+	"recovery-tool/crypto"
+)
+
+func newTestRootKeys() *common.RootKeys {
+	var shares []*common.RootKey
+	sum := new(big.Int)
+	for i, privKey := range []int64{0x1234567, 0x2345678} {
+		priv := big.NewInt(privKey)
+		sum.Add(sum, priv)
+		shares = append(shares, &common.RootKey{
+			PrivKey:     priv,
+			EcdsaPubKey: crypto.ScalarBaseMult(crypto.S256(), priv),
+			EddsaPubKey: crypto.ScalarBaseMult(crypto.Edwards(), priv),
+			ChainCode:   []byte{byte(i + 1), 31: byte(i + 1)},
+		})
+	}
+	return &common.RootKeys{Shares: shares, EddsaPubKey: crypto.ScalarBaseMult(crypto.Edwards(), sum)}
+}
+
+// esploraServer serves the address stats of an esplora api, the used addresses have a transaction,
+// the failed ones return an error, and the queried addresses are recorded
+type esploraServer struct {
+	*httptest.Server
+	used    map[string]bool
+	failed  map[string]bool
+	mu      sync.Mutex
+	queried []string
+}
+
+func newEsploraServer() *esploraServer {
+	s := &esploraServer{used: make(map[string]bool), failed: make(map[string]bool)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		address := strings.TrimPrefix(r.URL.Path, "/address/")
+		s.mu.Lock()
+		s.queried = append(s.queried, address)
+		s.mu.Unlock()
+		switch {
+		case s.failed[address]:
+			w.WriteHeader(http.StatusInternalServerError)
+		case s.used[address]:
+			w.Write([]byte(`{"chain_stats":{"funded_txo_sum":100000,"spent_txo_sum":0,"tx_count":1}}`))
+		default:
+			w.Write([]byte(`{"chain_stats":{"funded_txo_sum":0,"spent_txo_sum":0,"tx_count":0}}`))
+		}
+	}))
+	return s
+}
+
+func testAddress(t *testing.T, rootKeys *common.RootKeys, walletType string, vaultIndex, addressIndex int) string {
+	child, err := deriveChild(walletType, vaultIndex, addressIndex, common.BitcoinChain, rootKeys, true)
+	assert.NoError(t, err)
+	return child.Address
+}
+
+func TestDiscoverGapLimit(t *testing.T) {
+	rootKeys := newTestRootKeys()
+	server := newEsploraServer()
+	defer server.Close()
+
+	// vault 5 is beyond the gap of vaults 3 and 4, address 2 of vault 2 beyond the gap of address 1
+	used := [][2]int{{2, 0}, {2, 2}, {5, 0}}
+	for _, child := range used {
+		server.used[testAddress(t, rootKeys, AssetWallet, child[0], child[1])] = true
+	}
+	server.used[testAddress(t, rootKeys, ApiWallet, 0, 1)] = true
+
+	params := &RecoveryInput{
+		Chains:        []string{common.BitcoinChain},
+		WalletType:    AllWallet,
+		Nodes:         map[string]string{common.BitcoinChain: server.URL + "/"},
+		GapLimit:      2,
+		AddressesOnly: true,
+	}
+	assert.NoError(t, checkDiscoverParams(params))
+	assert.Equal(t, DefaultAddressGapLimit, params.AddressGapLimit)
+
+	result := discoverChilds(context.Background(), params, rootKeys)
+	assert.Empty(t, result.Errors)
+	assert.Len(t, result.Keys, 2)
+	assert.Equal(t, AssetWallet, result.Keys[0].WalletType)
+	assert.Equal(t, 2, result.Keys[0].VaultIndex)
+	assert.Equal(t, 0, result.Keys[0].AddressIndex)
+	assert.Equal(t, "0.001", result.Keys[0].Balance)
+	assert.Empty(t, result.Keys[0].PrivKey)
+	assert.Equal(t, ApiWallet, result.Keys[1].WalletType)
+	assert.Equal(t, 1, result.Keys[1].AddressIndex)
+
+	// vaults 1, 3 and 4 one address each, vault 2 two, the api wallet addresses 0 to 3
+	assert.Len(t, server.queried, 9)
+	assert.NotContains(t, server.queried, testAddress(t, rootKeys, AssetWallet, 5, 0))
+	assert.NotContains(t, server.queried, testAddress(t, rootKeys, AssetWallet, 2, 2))
+}
+
+func TestDiscoverFailure(t *testing.T) {
+	rootKeys := newTestRootKeys()
+	server := newEsploraServer()
+	defer server.Close()
+	server.used[testAddress(t, rootKeys, AssetWallet, 1, 0)] = true
+	server.failed[testAddress(t, rootKeys, AssetWallet, 3, 0)] = true
+
+	params := &RecoveryInput{
+		Chains:     []string{common.BitcoinChain},
+		WalletType: AssetWallet,
+		Nodes:      map[string]string{common.BitcoinChain: server.URL},
+		GapLimit:   5,
+	}
+	assert.NoError(t, checkDiscoverParams(params))
+
+	// the address found before the failure is kept
+	result := discoverChilds(context.Background(), params, rootKeys)
+	assert.Len(t, result.Keys, 1)
+	assert.Equal(t, 1, result.Keys[0].VaultIndex)
+	assert.Len(t, result.Errors, 1)
+	assert.Equal(t, 3, result.Errors[0].VaultIndex)
+	assert.Equal(t, code.NetworkErr, result.Errors[0].Code)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result = discoverChilds(ctx, params, rootKeys)
+	assert.Empty(t, result.Keys)
+	assert.Len(t, result.Errors, 1)
+}
+
+func TestDiscoverCancel(t *testing.T) {
+	// the node never answers, only the canceled context ends the query
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	params := &RecoveryInput{
+		Chains:     []string{common.BitcoinChain},
+		WalletType: AssetWallet,
+		Nodes:      map[string]string{common.BitcoinChain: server.URL},
+		GapLimit:   1,
+	}
+	assert.NoError(t, checkDiscoverParams(params))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	result := discoverChilds(ctx, params, newTestRootKeys())
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Empty(t, result.Keys)
+	assert.Len(t, result.Errors, 1)
+}
+
+func TestDiscoverParams(t *testing.T) {
+	for _, chain := range []string{common.DogeChain, common.BitcoinCashChain, common.TronChain} {
+		params := &RecoveryInput{Chains: []string{chain}}
+		assert.Error(t, checkDiscoverParams(params), chain)
+	}
+	params := &RecoveryInput{Chains: []string{common.EthereumChain}}
+	assert.Error(t, checkDiscoverParams(params))
+	params.Nodes = map[string]string{common.EthereumChain: "http://localhost:8545"}
+	assert.NoError(t, checkDiscoverParams(params))
+	params.GapLimit = -1
+	assert.Error(t, checkDiscoverParams(params))
+}
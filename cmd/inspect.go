@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"archive/zip"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+
+	"github.com/alecthomas/gometalinter/_linters/src/gopkg.in/yaml.v2"
+	ecies "github.com/ecies/go/v2"
+
+	"recovery-tool/common"
+	"recovery-tool/common/code"
+	"recovery-tool/crypto/secure"
+)
+
+// EntryReport describes a backup entry without its private shares
+type EntryReport struct {
+	Archive    string `yaml:"archive"`
+	Entry      string `yaml:"entry"`
+	Version    int    `yaml:"version,omitempty"`
+	Shares     int    `yaml:"shares"`
+	ChainCodes int    `yaml:"chain_codes"`
+	UserPubKey string `yaml:"user_pub_key,omitempty"` // only decrypted when the keys are supplied
+	Code       string `yaml:"code,omitempty"`
+	Error      string `yaml:"error,omitempty"`
+}
+
+type InspectReport struct {
+	Entries []*EntryReport `yaml:"entries"`
+	Valid   int            `yaml:"valid"`
+	Invalid int            `yaml:"invalid"`
+}
+
+// InspectCmd prints the report of the archives, and fails if any entry is invalid.
+// The keys are the paths of the key files or prompt, they are optional but must be supplied together.
+func InspectCmd(zipPath, eciesKeyPath, rsaKeyPath string) error {
+	var eciesPrivKey string
+	var err error
+	if len(eciesKeyPath) > 0 {
+		if eciesPrivKey, err = readKeyArg("ecies_private_key", eciesKeyPath, false); err != nil {
+			return err
+		}
+	}
+	var rsaPrivKey string
+	if len(rsaKeyPath) > 0 {
+		if rsaPrivKey, err = readKeyArg("rsa_private_key", rsaKeyPath, true); err != nil {
+			return err
+		}
+	}
+
+	report, err := InspectBackups(zipPath, eciesPrivKey, rsaPrivKey)
+	if err != nil {
+		return err
+	}
+
+	yamlData, err := yaml.Marshal(report)
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(yamlData))
+
+	if report.Invalid > 0 {
+		return code.NewI18nError(code.FailedToParseDataErr, fmt.Sprintf("%d of %d backup entries are invalid", report.Invalid, len(report.Entries)))
+	}
+	return nil
+}
+
+// InspectBackups checks every entry of the archives (a zip file or a directory of them).
+// Only user_pub_key is decrypted, and only when both keys are supplied, hbc_private_keys are never decrypted.
+func InspectBackups(zipPath, eciesPrivKeyHex, rsaPrivKeyPem string) (*InspectReport, error) {
+	if (len(eciesPrivKeyHex) > 0) != (len(rsaPrivKeyPem) > 0) {
+		return nil, code.NewI18nError(code.ParamErr, "ECIES and RSA keys must be supplied together")
+	}
+
+	var eciesPrivKey *ecies.PrivateKey
+	var rsaPrivKey *rsa.PrivateKey
+	var err error
+	if len(eciesPrivKeyHex) > 0 {
+		eciesPrivKey, rsaPrivKey, err = loadDecryptionKeys(eciesPrivKeyHex, rsaPrivKeyPem, nil)
+		if err != nil {
+			return nil, err
+		}
+		defer secure.WipeBigInt(eciesPrivKey.D)
+		defer wipeRsaPrivKey(rsaPrivKey)
+	}
+
+	archives, err := listBackupArchives([]string{zipPath})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &InspectReport{Entries: make([]*EntryReport, 0)}
+	for _, archive := range archives {
+		zf, err := zip.OpenReader(archive)
+		if err != nil {
+			common.Logger.Errorf("open backup %s failed: %s", archive, err)
+			entry := &EntryReport{Archive: archive}
+			entry.setError(code.NewI18nError(code.FileFormatErr, "zip file format error"))
+			report.add(entry)
+			continue
+		}
+
+		for _, file := range zf.File {
+			if !file.FileInfo().IsDir() {
+				report.add(inspectEntry(archive, file, eciesPrivKey, rsaPrivKey))
+			}
+		}
+		zf.Close()
+	}
+	return report, nil
+}
+
+func (r *InspectReport) add(entry *EntryReport) {
+	r.Entries = append(r.Entries, entry)
+	if entry.Code == "" {
+		r.Valid++
+	} else {
+		r.Invalid++
+	}
+}
+
+func inspectEntry(archive string, file *zip.File, eciesPrivKey *ecies.PrivateKey, rsaPrivKey *rsa.PrivateKey) *EntryReport {
+	entry := &EntryReport{Archive: archive, Entry: file.Name}
+
+	fileBytes, err := common.ReadAll(file)
+	if err != nil {
+		entry.setError(code.NewI18nError(code.FileFormatErr, err.Error()))
+		return entry
+	}
+
+	// the counts are reported even if the entry fails the checks of parseTeam
+	raw := encryptedTeam{}
+	if err = json.Unmarshal(fileBytes, &raw); err == nil {
+		entry.Version = raw.Version
+		entry.Shares = len(raw.HbcPrivKeys)
+		entry.ChainCodes = len(raw.HbcChainCodes)
+	}
+
+	team, err := parseTeam(fileBytes)
+	if err != nil {
+		entry.setError(err)
+		return entry
+	}
+	entry.Version = team.Version
+
+	if eciesPrivKey != nil {
+		entry.UserPubKey, err = decryptUserPubKey(team.UserPubKey, eciesPrivKey, rsaPrivKey)
+		if err != nil {
+			entry.setError(err)
+		}
+	}
+	return entry
+}
+
+func (e *EntryReport) setError(err error) {
+	i18nErr := asI18nError(err)
+	e.Code = i18nErr.Code
+	e.Error = i18nErr.Msg
+}
@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/alecthomas/gometalinter/_linters/src/gopkg.in/yaml.v2"
+	ecies "github.com/ecies/go/v2"
+
+	"recovery-tool/common"
+	"recovery-tool/common/code"
+	"recovery-tool/crypto"
+	"recovery-tool/crypto/secure"
+)
+
+// KeygenRsaBits is the size of the generated RSA key
+const KeygenRsaBits = 4096
+
+// the files written by keygen, the private ones with mode 0600
+const (
+	EciesPrivKeyFile = "ecies_private_key.pem"
+	EciesPubKeyFile  = "ecies_public_key.hex"
+	RsaPrivKeyFile   = "rsa_private_key.pem"
+	RsaPubKeyFile    = "rsa_public_key.pem"
+)
+
+// KeygenRecord is printed for the ceremony record, it holds no private key
+type KeygenRecord struct {
+	CreatedAt              string   `yaml:"created_at"`
+	EciesPubKey            string   `yaml:"ecies_public_key"`             // compressed secp256k1 in hex
+	EciesPubKeyFingerprint string   `yaml:"ecies_public_key_fingerprint"` // SHA-256 of the compressed key
+	RsaBits                int      `yaml:"rsa_bits"`
+	RsaPubKeyFingerprint   string   `yaml:"rsa_public_key_fingerprint"` // SHA-256 of the PKIX DER
+	PasswordProtected      bool     `yaml:"password_protected"`
+	Files                  []string `yaml:"files"`
+}
+
+// KeygenCmd generates the ECIES and RSA recovery keys into outputDir and prints the record of their fingerprints.
+// The private keys are PKCS#8 PEM, encrypted with the passwords from RECOVERY_ECIES_KEY_PASSWORD and
+// RECOVERY_RSA_KEY_PASSWORD (or prompted) if encryptKeys. The public keys are what the backups are encrypted to.
+func KeygenCmd(outputDir string, encryptKeys bool) error {
+	paths := make(map[string]string)
+	for _, name := range []string{EciesPrivKeyFile, EciesPubKeyFile, RsaPrivKeyFile, RsaPubKeyFile} {
+		paths[name] = filepath.Join(outputDir, name)
+		// fail before generating the keys, createKeyFile still refuses a file created in the meantime
+		if _, err := os.Stat(paths[name]); err == nil {
+			return keyExistsError(paths[name])
+		}
+	}
+	if err := os.MkdirAll(outputDir, 0700); err != nil {
+		return code.NewI18nError(code.ParamErr, fmt.Sprintf("create %s failed: %s", outputDir, err))
+	}
+
+	var eciesPassword, rsaPassword []byte
+	if encryptKeys {
+		var err error
+		if eciesPassword, err = readNewKeyPassword("ecies_private_key", EciesKeyPasswordEnv); err != nil {
+			return err
+		}
+		defer secure.Wipe(eciesPassword)
+		if rsaPassword, err = readNewKeyPassword("rsa_private_key", RsaKeyPasswordEnv); err != nil {
+			return err
+		}
+		defer secure.Wipe(rsaPassword)
+	}
+
+	common.Logger.Infof("generating the %d bits RSA key and the secp256k1 ECIES key", KeygenRsaBits)
+	eciesPrivKey, err := ecies.GenerateKey()
+	if err != nil {
+		return code.NewI18nError(code.SystemErr, fmt.Sprintf("generate ecies key failed: %s", err))
+	}
+	rsaPrivKey, err := rsa.GenerateKey(rand.Reader, KeygenRsaBits)
+	if err != nil {
+		secure.WipeBigInt(eciesPrivKey.D)
+		return code.NewI18nError(code.SystemErr, fmt.Sprintf("generate rsa key failed: %s", err))
+	}
+	generated := &parsedParams{EciesPrivKey: eciesPrivKey, RsaPrivKey: rsaPrivKey}
+	defer generated.wipeDecryptionKeys()
+
+	eciesPem, err := crypto.MarshalEciesPrivKey(eciesPrivKey, eciesPassword)
+	if err != nil {
+		return code.NewI18nError(code.SystemErr, fmt.Sprintf("marshal ecies key failed: %s", err))
+	}
+	defer secure.Wipe(eciesPem)
+	rsaPem, err := crypto.MarshalRsaPrivKey(rsaPrivKey, rsaPassword)
+	if err != nil {
+		return code.NewI18nError(code.SystemErr, fmt.Sprintf("marshal rsa key failed: %s", err))
+	}
+	defer secure.Wipe(rsaPem)
+	rsaPubPem, err := crypto.MarshalRsaPubKey(&rsaPrivKey.PublicKey)
+	if err != nil {
+		return code.NewI18nError(code.SystemErr, fmt.Sprintf("marshal rsa public key failed: %s", err))
+	}
+
+	if err = checkGeneratedKeys(eciesPem, eciesPassword, rsaPem, rsaPassword, eciesPrivKey.PublicKey, &rsaPrivKey.PublicKey); err != nil {
+		return err
+	}
+
+	if err = createKeyFile(paths[EciesPrivKeyFile], eciesPem, 0600); err != nil {
+		return err
+	}
+	if err = createKeyFile(paths[RsaPrivKeyFile], rsaPem, 0600); err != nil {
+		return err
+	}
+	eciesPubKey := eciesPrivKey.PublicKey.Hex(true)
+	if err = createKeyFile(paths[EciesPubKeyFile], []byte(eciesPubKey+"\n"), 0644); err != nil {
+		return err
+	}
+	if err = createKeyFile(paths[RsaPubKeyFile], rsaPubPem, 0644); err != nil {
+		return err
+	}
+
+	rsaFingerprint, err := crypto.RsaPubKeyFingerprint(&rsaPrivKey.PublicKey)
+	if err != nil {
+		return err
+	}
+	record := &KeygenRecord{
+		CreatedAt:              time.Now().UTC().Format(time.RFC3339),
+		EciesPubKey:            eciesPubKey,
+		EciesPubKeyFingerprint: crypto.EciesPubKeyFingerprint(eciesPrivKey.PublicKey),
+		RsaBits:                KeygenRsaBits,
+		RsaPubKeyFingerprint:   rsaFingerprint,
+		PasswordProtected:      encryptKeys,
+		Files:                  []string{paths[EciesPrivKeyFile], paths[EciesPubKeyFile], paths[RsaPrivKeyFile], paths[RsaPubKeyFile]},
+	}
+	yamlData, err := yaml.Marshal(record)
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(yamlData))
+	return nil
+}
+
+// createKeyFile writes a generated key into a new file, keygen never overwrites a key
+func createKeyFile(path string, data []byte, perm os.FileMode) error {
+	err := createFile(path, data, perm)
+	if os.IsExist(err) {
+		return keyExistsError(path)
+	}
+	return err
+}
+
+func keyExistsError(path string) error {
+	return code.NewI18nError(code.ParamErr, fmt.Sprintf("%s already exists, keygen never overwrites a key", path))
+}
+
+// checkGeneratedKeys loads the written private keys back as recover does, and decrypts a share encrypted
+// to the public keys the same way as the backups
+func checkGeneratedKeys(eciesPem, eciesPassword, rsaPem, rsaPassword []byte, eciesPubKey *ecies.PublicKey, rsaPubKey *rsa.PublicKey) error {
+	eciesPrivKey, err := crypto.LoadEciesPrivKey(string(eciesPem), func() ([]byte, error) { return eciesPassword, nil })
+	if err != nil {
+		return keyError(code.EciesPrivKeyErr, "generated ecies key", err)
+	}
+	rsaPrivKey, err := crypto.LoadRsaPrivKey(string(rsaPem), func() ([]byte, error) { return rsaPassword, nil })
+	if err != nil {
+		secure.WipeBigInt(eciesPrivKey.D)
+		return keyError(code.RsaPrivKeyErr, "generated rsa key", err)
+	}
+	loaded := &parsedParams{EciesPrivKey: eciesPrivKey, RsaPrivKey: rsaPrivKey}
+	defer loaded.wipeDecryptionKeys()
+
+	share := make([]byte, 32)
+	if _, err = rand.Read(share); err != nil {
+		return err
+	}
+	encrypted, err := ecies.Encrypt(eciesPubKey, share)
+	if err != nil {
+		return code.NewI18nError(code.SystemErr, fmt.Sprintf("ecies encrypt failed: %s", err))
+	}
+	if encrypted, err = crypto.RsaEncryptOAEP(rsaPubKey, encrypted); err != nil {
+		return code.NewI18nError(code.SystemErr, fmt.Sprintf("rsa encrypt failed: %s", err))
+	}
+
+	team := &encryptedTeam{HbcPrivKeys: []string{hex.EncodeToString(encrypted)}, HbcChainCodes: []string{hex.EncodeToString(encrypted)}}
+	privs, err := decryptHbcPrivs(team, eciesPrivKey, rsaPrivKey)
+	if err != nil {
+		return err
+	}
+	defer wipeRootKeys(privs)
+	if !bytes.Equal(privs[0].ChainCode, share) {
+		return code.NewI18nError(code.SystemErr, "the generated keys failed to decrypt a test share")
+	}
+	return nil
+}
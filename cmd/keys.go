@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	ecies "github.com/ecies/go/v2"
+	"golang.org/x/term"
+
+	"recovery-tool/common/code"
+	"recovery-tool/crypto"
+	"recovery-tool/crypto/secure"
+)
+
+// The passwords of the encrypted decryption keys are read from these before prompting on the terminal
+const (
+	EciesKeyPasswordEnv = "RECOVERY_ECIES_KEY_PASSWORD"
+	RsaKeyPasswordEnv   = "RECOVERY_RSA_KEY_PASSWORD"
+)
+
+// keyPasswords remembers the passwords of the encrypted keys, so a key parsed again is not prompted again.
+// A nil keyPasswords remembers nothing.
+type keyPasswords struct {
+	mu        sync.Mutex
+	passwords map[string][]byte
+}
+
+func newKeyPasswords() *keyPasswords {
+	return &keyPasswords{passwords: make(map[string][]byte)}
+}
+
+// loadKey calls load with the PasswordFunc of the key name, which reads env or prompts on the terminal.
+// The password is remembered only once the key loads with it, a remembered one which fails to load
+// the key is forgotten, and the passwords not remembered are wiped.
+func (p *keyPasswords) loadKey(name, env string, load func(password crypto.PasswordFunc) error) error {
+	if p != nil {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+	}
+
+	var password []byte
+	remembered := false
+	err := load(func() ([]byte, error) {
+		if p != nil {
+			if password, remembered = p.passwords[name]; remembered {
+				return password, nil
+			}
+		}
+		var err error
+		password, err = readKeyPassword(name, env)
+		return password, err
+	})
+
+	switch {
+	case password == nil:
+	case err != nil:
+		if remembered {
+			delete(p.passwords, name)
+		}
+		secure.Wipe(password)
+	case p == nil:
+		secure.Wipe(password)
+	case !remembered:
+		p.passwords[name] = password
+	}
+	return err
+}
+
+func (p *keyPasswords) wipe() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for name, password := range p.passwords {
+		secure.Wipe(password)
+		delete(p.passwords, name)
+	}
+}
+
+func readKeyPassword(name, env string) ([]byte, error) {
+	if password := os.Getenv(env); len(password) > 0 {
+		return []byte(password), nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, fmt.Errorf("%w, no terminal to read it, set %s", crypto.ErrKeyPasswordRequired, env)
+	}
+	fmt.Fprintf(os.Stderr, "Password of %s: ", name)
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("%w, read it failed: %s", crypto.ErrKeyPasswordRequired, err)
+	}
+	return password, nil
+}
+
+// readNewKeyPassword reads the password of a new key from env, or prompts twice on the terminal to confirm it
+func readNewKeyPassword(name, env string) ([]byte, error) {
+	if password := os.Getenv(env); len(password) > 0 {
+		return []byte(password), nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, code.NewI18nError(code.KeyPasswordErr, fmt.Sprintf("no terminal to read the password of %s, set %s", name, env))
+	}
+	fmt.Fprintf(os.Stderr, "New password of %s: ", name)
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, code.NewI18nError(code.KeyPasswordErr, fmt.Sprintf("read password of %s failed: %s", name, err))
+	}
+	if len(password) == 0 {
+		return nil, code.NewI18nError(code.KeyPasswordErr, fmt.Sprintf("password of %s cannot be empty", name))
+	}
+
+	fmt.Fprintf(os.Stderr, "Confirm password of %s: ", name)
+	confirmed, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	defer secure.Wipe(confirmed)
+	if err != nil {
+		secure.Wipe(password)
+		return nil, code.NewI18nError(code.KeyPasswordErr, fmt.Sprintf("read password of %s failed: %s", name, err))
+	}
+	if !bytes.Equal(confirmed, password) {
+		secure.Wipe(password)
+		return nil, code.NewI18nError(code.KeyPasswordErr, fmt.Sprintf("passwords of %s do not match", name))
+	}
+	return password, nil
+}
+
+// loadDecryptionKeys loads the ECIES and RSA private keys of the backups, in any format of the key loader
+func loadDecryptionKeys(eciesKey, rsaKey string, passwords *keyPasswords) (*ecies.PrivateKey, *rsa.PrivateKey, error) {
+	eciesPrivKey, err := loadEciesPrivKey(eciesKey, passwords)
+	if err != nil {
+		return nil, nil, err
+	}
+	rsaPrivKey, err := loadRsaPrivKey(rsaKey, passwords)
+	if err != nil {
+		secure.WipeBigInt(eciesPrivKey.D)
+		return nil, nil, err
+	}
+	return eciesPrivKey, rsaPrivKey, nil
+}
+
+func loadEciesPrivKey(data string, passwords *keyPasswords) (key *ecies.PrivateKey, err error) {
+	err = passwords.loadKey("ecies_private_key", EciesKeyPasswordEnv, func(password crypto.PasswordFunc) error {
+		key, err = crypto.LoadEciesPrivKey(data, password)
+		return err
+	})
+	if err != nil {
+		return nil, keyError(code.EciesPrivKeyErr, "ecies_private_key", err)
+	}
+	return key, nil
+}
+
+func loadRsaPrivKey(data string, passwords *keyPasswords) (key *rsa.PrivateKey, err error) {
+	err = passwords.loadKey("rsa_private_key", RsaKeyPasswordEnv, func(password crypto.PasswordFunc) error {
+		key, err = crypto.LoadRsaPrivKey(data, password)
+		return err
+	})
+	if err != nil {
+		return nil, keyError(code.RsaPrivKeyErr, "rsa_private_key", err)
+	}
+	return key, nil
+}
+
+// keyError tells the unsupported format, the wrong password and the wrong key type apart from a malformed key
+func keyError(malformedCode, name string, err error) error {
+	errCode := malformedCode
+	switch {
+	case errors.Is(err, crypto.ErrKeyFormat):
+		errCode = code.KeyFormatErr
+	case errors.Is(err, crypto.ErrKeyPassword), errors.Is(err, crypto.ErrKeyPasswordRequired):
+		errCode = code.KeyPasswordErr
+	case errors.Is(err, crypto.ErrKeyType):
+		errCode = code.KeyTypeErr
+	}
+	return code.NewI18nError(errCode, fmt.Sprintf("%s: %s", name, err))
+}
+
+// readKeyArg reads the key named by a command line argument, the path of its key file or prompt to type it.
+// The key itself is not accepted, as the command lines are kept in the shell history and seen by other processes.
+func readKeyArg(name, arg string, multiline bool) (string, error) {
+	if arg == SecretFromPrompt {
+		return (&secretParam{name: name, from: arg, multiline: multiline}).prompt()
+	}
+	info, err := os.Stat(arg)
+	if err != nil || info.IsDir() {
+		return "", code.NewI18nError(code.ParamErr, fmt.Sprintf("%s must be the path of its key file or %s, the key itself is not accepted on the command line", name, SecretFromPrompt))
+	}
+	return readSecretFile(name, arg)
+}
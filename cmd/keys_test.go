@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"testing"
+
+	ecies "github.com/ecies/go/v2"
+	"github.com/stretchr/testify/assert"
+
+	"recovery-tool/common/code"
+	"recovery-tool/crypto"
+)
+
+func TestKeyPasswords(t *testing.T) {
+	eciesPrivKey, err := ecies.GenerateKey()
+	assert.NoError(t, err)
+	custodianKey, err := crypto.MarshalEciesPrivKey(eciesPrivKey, []byte("custodian"))
+	assert.NoError(t, err)
+	otherKey, err := crypto.MarshalEciesPrivKey(eciesPrivKey, []byte("other"))
+	assert.NoError(t, err)
+
+	// a wrong password is not remembered
+	passwords := newKeyPasswords()
+	t.Setenv(EciesKeyPasswordEnv, "wrong")
+	_, err = loadEciesPrivKey(string(custodianKey), passwords)
+	assert.Equal(t, code.KeyPasswordErr, asI18nError(err).Code)
+	assert.Empty(t, passwords.passwords)
+
+	t.Setenv(EciesKeyPasswordEnv, "custodian")
+	key, err := loadEciesPrivKey(string(custodianKey), passwords)
+	assert.NoError(t, err)
+	assert.True(t, eciesPrivKey.Equals(key))
+	assert.Equal(t, []byte("custodian"), passwords.passwords["ecies_private_key"])
+
+	// the remembered password is used without reading env again, and forgotten once it fails
+	t.Setenv(EciesKeyPasswordEnv, "")
+	key, err = loadEciesPrivKey(string(custodianKey), passwords)
+	assert.NoError(t, err)
+	assert.True(t, eciesPrivKey.Equals(key))
+	_, err = loadEciesPrivKey(string(otherKey), passwords)
+	assert.Equal(t, code.KeyPasswordErr, asI18nError(err).Code)
+	assert.Empty(t, passwords.passwords)
+
+	t.Setenv(EciesKeyPasswordEnv, "other")
+	key, err = loadEciesPrivKey(string(otherKey), nil)
+	assert.NoError(t, err)
+	assert.True(t, eciesPrivKey.Equals(key))
+}
@@ -0,0 +1,698 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/gometalinter/_linters/src/gopkg.in/yaml.v2"
+	ecies "github.com/ecies/go/v2"
+
+	"recovery-tool/common"
+	"recovery-tool/common/code"
+	"recovery-tool/crypto"
+	"recovery-tool/crypto/hdwallet"
+	"recovery-tool/crypto/secure"
+	"recovery-tool/crypto/shamir"
+)
+
+const keyShareVersion = 1
+
+// share data encodings
+const (
+	ShareEncodingHex      = "hex"      // lines of 16 bytes in groups of 4 hex digits
+	ShareEncodingMnemonic = "mnemonic" // a 24-word english mnemonic for every 32 bytes, the last zero padded
+)
+
+const (
+	shareHexLineBytes   = 16
+	shareMnemonicBytes  = 32
+	shareChecksumBytes  = 4
+	shareSplitIDBytes   = 8
+	sharePassphraseName = "share %d" // the passphrase of the shares of custodian %d
+)
+
+// SharePassphraseEnvPrefix followed by the share index is read for the passphrase of the shares before prompting,
+// ShareKeyPasswordEnv for the password of an encrypted custodian key
+const (
+	SharePassphraseEnvPrefix = "RECOVERY_SHARE_PASSPHRASE_"
+	ShareKeyPasswordEnv      = "RECOVERY_SHARE_KEY_PASSWORD"
+)
+
+// KeyShare is a Shamir share of a recovery key, as written by split-key. Shares of one split have the same
+// split_id, and the key reconstructed from them is checked against the public key fingerprint.
+type KeyShare struct {
+	Version     int      `yaml:"version"`
+	Key         string   `yaml:"key"` // ecies_private_key or rsa_private_key
+	SplitID     string   `yaml:"split_id"`
+	Threshold   int      `yaml:"threshold"`
+	Shares      int      `yaml:"shares"`
+	Index       int      `yaml:"index"` // 1 to shares
+	Fingerprint string   `yaml:"public_key_fingerprint"`
+	Encoding    string   `yaml:"encoding"`
+	Length      int      `yaml:"length"`   // bytes of the share data
+	Checksum    string   `yaml:"checksum"` // the first 4 bytes of the SHA-256 of the share data in hex, against typos
+	Data        []string `yaml:"data"`
+}
+
+// KeyShareFile is a share file given to the recovery instead of a key
+type KeyShareFile struct {
+	Path string `yaml:"path"`
+	// The passphrase, or the custodian private key, of an encrypted share: file:<path>, env:<name>, stdin or prompt (default)
+	KeyFrom string `yaml:"key_from"`
+}
+
+// SplitRecord is printed for the ceremony record, it holds no share
+type SplitRecord struct {
+	CreatedAt  string            `yaml:"created_at"`
+	SplitID    string            `yaml:"split_id"`
+	Threshold  int               `yaml:"threshold"`
+	Shares     int               `yaml:"shares"`
+	Encoding   string            `yaml:"encoding"`
+	Encryption string            `yaml:"encryption,omitempty"` // passphrase, ecies or rsa, per custodian
+	Keys       []*SplitKeyRecord `yaml:"keys"`
+}
+
+type SplitKeyRecord struct {
+	Key         string   `yaml:"key"`
+	Fingerprint string   `yaml:"public_key_fingerprint"`
+	Files       []string `yaml:"files"` // the share of index i is Files[i-1]
+}
+
+// splitKey is a key to split and what its shares are checked against
+type splitKey struct {
+	name        string
+	secret      []byte // the ECIES scalar, or the PKCS#8 DER of the RSA key
+	fingerprint string
+}
+
+// SplitKeyCmd splits the ECIES and RSA keys, either may be empty, into n share files of outputDir, any threshold
+// of which reconstruct the key. Share i of both keys is for custodian i, encrypted to recipients[i-1] or with
+// a passphrase of custodian i if encrypt is set. The keys are given as by the recover params, or the paths of their files.
+func SplitKeyCmd(eciesKey, rsaKey string, threshold, n int, outputDir, encoding, encrypt string, recipients []string) error {
+	if len(eciesKey) == 0 && len(rsaKey) == 0 {
+		return code.NewI18nError(code.ParamErr, "no key to split, set the ECIES key or the RSA key")
+	}
+	if threshold < 2 || threshold > n || n > shamir.MaxShares {
+		return code.NewI18nError(code.ParamErr, fmt.Sprintf("invalid %d of %d shares, requires 2 <= k <= n <= %d", threshold, n, shamir.MaxShares))
+	}
+	switch encoding {
+	case ShareEncodingHex, ShareEncodingMnemonic:
+	default:
+		return code.NewI18nError(code.ParamErr, fmt.Sprintf("unsupported share encoding: %s, use hex or mnemonic", encoding))
+	}
+	writers, err := newShareWriters(encrypt, recipients, n)
+	if err != nil {
+		return err
+	}
+
+	passwords := newKeyPasswords()
+	defer passwords.wipe()
+	var keys []*splitKey
+	defer func() {
+		for _, key := range keys {
+			secure.Wipe(key.secret)
+		}
+	}()
+	if len(eciesKey) > 0 {
+		key, err := eciesSplitKey(eciesKey, passwords)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+	if len(rsaKey) > 0 {
+		key, err := rsaSplitKey(rsaKey, passwords)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+
+	ext := "yaml"
+	if len(encrypt) > 0 {
+		ext = "json"
+	}
+	record := &SplitRecord{
+		CreatedAt:  time.Now().UTC().Format(time.RFC3339),
+		Threshold:  threshold,
+		Shares:     n,
+		Encoding:   encoding,
+		Encryption: encrypt,
+	}
+	for _, key := range keys {
+		keyRecord := &SplitKeyRecord{Key: key.name, Fingerprint: key.fingerprint}
+		for i := 1; i <= n; i++ {
+			path := filepath.Join(outputDir, fmt.Sprintf("%s.share%d-of-%d.%s", key.name, i, n, ext))
+			// fail before splitting, the exclusive create still refuses a share created in the meantime
+			if _, err := os.Stat(path); err == nil {
+				return shareExistsError(path)
+			}
+			keyRecord.Files = append(keyRecord.Files, path)
+		}
+		record.Keys = append(record.Keys, keyRecord)
+	}
+
+	splitID := make([]byte, shareSplitIDBytes)
+	if _, err = rand.Read(splitID); err != nil {
+		return err
+	}
+	record.SplitID = hex.EncodeToString(splitID)
+
+	shareFiles := make([][][]byte, len(keys))
+	defer func() {
+		for _, files := range shareFiles {
+			for _, file := range files {
+				secure.Wipe(file)
+			}
+		}
+	}()
+	for k, key := range keys {
+		if shareFiles[k], err = splitKeyShares(key, record, encoding); err != nil {
+			return err
+		}
+	}
+
+	if err = os.MkdirAll(outputDir, 0700); err != nil {
+		return code.NewI18nError(code.ParamErr, fmt.Sprintf("create %s failed: %s", outputDir, err))
+	}
+	defer writers.wipe()
+	if err = writeShareFiles(record, shareFiles, writers); err != nil {
+		return err
+	}
+
+	yamlData, err := yaml.Marshal(record)
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(yamlData))
+	return nil
+}
+
+// writeShareFiles writes the share files of the record, custodian by custodian. The files already written
+// are removed on a failure, so they don't refuse a retry.
+func writeShareFiles(record *SplitRecord, shareFiles [][][]byte, writers *shareWriters) (err error) {
+	var written []string
+	defer func() {
+		if err == nil {
+			return
+		}
+		for _, path := range written {
+			if removeErr := os.Remove(path); removeErr != nil {
+				common.Logger.Errorf("remove share file %s failed: %s", path, removeErr)
+			}
+		}
+	}()
+
+	for i := 1; i <= record.Shares; i++ {
+		for k, keyRecord := range record.Keys {
+			data, err := writers.seal(i, shareFiles[k][i-1])
+			if err != nil {
+				return err
+			}
+			path := keyRecord.Files[i-1]
+			if err = createFile(path, data, 0600); err != nil {
+				if os.IsExist(err) {
+					return shareExistsError(path)
+				}
+				return err
+			}
+			written = append(written, path)
+		}
+	}
+	return nil
+}
+
+func shareExistsError(path string) error {
+	return code.NewI18nError(code.ParamErr, fmt.Sprintf("%s already exists, split-key never overwrites a share", path))
+}
+
+func eciesSplitKey(arg string, passwords *keyPasswords) (*splitKey, error) {
+	data, err := readKeyArg("ecies_private_key", arg, false)
+	if err != nil {
+		return nil, err
+	}
+	privKey, err := loadEciesPrivKey(data, passwords)
+	if err != nil {
+		return nil, err
+	}
+	defer secure.WipeBigInt(privKey.D)
+	secret := make([]byte, 32)
+	privKey.D.FillBytes(secret)
+	return &splitKey{
+		name:        "ecies_private_key",
+		secret:      secret,
+		fingerprint: crypto.EciesPubKeyFingerprint(privKey.PublicKey),
+	}, nil
+}
+
+func rsaSplitKey(arg string, passwords *keyPasswords) (*splitKey, error) {
+	data, err := readKeyArg("rsa_private_key", arg, true)
+	if err != nil {
+		return nil, err
+	}
+	privKey, err := loadRsaPrivKey(data, passwords)
+	if err != nil {
+		return nil, err
+	}
+	defer wipeRsaPrivKey(privKey)
+	der, err := x509.MarshalPKCS8PrivateKey(privKey)
+	if err != nil {
+		return nil, code.NewI18nError(code.RsaPrivKeyErr, fmt.Sprintf("marshal rsa key failed: %s", err))
+	}
+	fingerprint, err := crypto.RsaPubKeyFingerprint(&privKey.PublicKey)
+	if err != nil {
+		secure.Wipe(der)
+		return nil, err
+	}
+	return &splitKey{name: "rsa_private_key", secret: der, fingerprint: fingerprint}, nil
+}
+
+// splitKeyShares splits the key and returns the yaml of its share files, after checking that
+// the first and the last threshold shares reconstruct the key
+func splitKeyShares(key *splitKey, record *SplitRecord, encoding string) ([][]byte, error) {
+	shares, err := shamir.Split(key.secret, record.Threshold, record.Shares)
+	if err != nil {
+		return nil, code.NewI18nError(code.SystemErr, fmt.Sprintf("split %s failed: %s", key.name, err))
+	}
+	defer func() {
+		for _, share := range shares {
+			secure.Wipe(share.Data)
+		}
+	}()
+	for _, subset := range [][]*shamir.Share{shares[:record.Threshold], shares[len(shares)-record.Threshold:]} {
+		combined, err := shamir.Combine(subset)
+		if err != nil {
+			return nil, code.NewI18nError(code.SystemErr, fmt.Sprintf("check the shares of %s failed: %s", key.name, err))
+		}
+		matched := bytes.Equal(combined, key.secret)
+		secure.Wipe(combined)
+		if !matched {
+			return nil, code.NewI18nError(code.SystemErr, fmt.Sprintf("the shares of %s failed to reconstruct it", key.name))
+		}
+	}
+
+	files := make([][]byte, len(shares))
+	for i, share := range shares {
+		lines, err := encodeShareData(share.Data, encoding)
+		if err != nil {
+			return nil, code.NewI18nError(code.SystemErr, fmt.Sprintf("encode the share of %s failed: %s", key.name, err))
+		}
+		if files[i], err = yaml.Marshal(&KeyShare{
+			Version:     keyShareVersion,
+			Key:         key.name,
+			SplitID:     record.SplitID,
+			Threshold:   record.Threshold,
+			Shares:      record.Shares,
+			Index:       int(share.Index),
+			Fingerprint: key.fingerprint,
+			Encoding:    encoding,
+			Length:      len(share.Data),
+			Checksum:    shareChecksum(share.Data),
+			Data:        lines,
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// shareWriters encrypts the share files of each custodian, or leaves them plain if mode is empty
+type shareWriters struct {
+	mode        string
+	passphrases map[int][]byte
+	eciesKeys   []*ecies.PublicKey
+	rsaKeys     []*rsa.PublicKey
+}
+
+// newShareWriters reads the n recipient public keys, in hex or PEM or the paths of their files, before anything is split
+func newShareWriters(mode string, recipients []string, n int) (*shareWriters, error) {
+	w := &shareWriters{mode: mode, passphrases: make(map[int][]byte)}
+	switch mode {
+	case "", OutputPassphrase:
+		if len(recipients) > 0 {
+			return nil, code.NewI18nError(code.ParamErr, "recipients are only used to encrypt the shares to ecies or rsa keys")
+		}
+		return w, nil
+	case OutputEcies, OutputRsa:
+	default:
+		return nil, code.NewI18nError(code.ParamErr, fmt.Sprintf("unsupported share encryption: %s, use passphrase, ecies or rsa", mode))
+	}
+	if len(recipients) != n {
+		return nil, code.NewI18nError(code.ParamErr, fmt.Sprintf("%d recipients given, one for each of the %d shares is required", len(recipients), n))
+	}
+
+	for i, recipient := range recipients {
+		key, err := readRecipient(strings.TrimSpace(recipient))
+		if err != nil {
+			return nil, err
+		}
+		if mode == OutputEcies {
+			pubKey, err := ecies.NewPublicKeyFromHex(strings.TrimSpace(key))
+			if err != nil {
+				return nil, code.NewI18nError(code.ParamErr, fmt.Sprintf("invalid ecies recipient of share %d: %s", i+1, err))
+			}
+			w.eciesKeys = append(w.eciesKeys, pubKey)
+		} else {
+			pubKey, err := crypto.ParseRsaPubKey(key)
+			if err != nil {
+				return nil, code.NewI18nError(code.ParamErr, fmt.Sprintf("invalid rsa recipient of share %d: %s", i+1, err))
+			}
+			w.rsaKeys = append(w.rsaKeys, pubKey)
+		}
+	}
+	return w, nil
+}
+
+// seal returns the share file of custodian index, the plain yaml or the json of its envelope
+func (w *shareWriters) seal(index int, data []byte) ([]byte, error) {
+	var envelope *crypto.Envelope
+	var err error
+	switch w.mode {
+	case "":
+		return data, nil
+	case OutputPassphrase:
+		passphrase, ok := w.passphrases[index]
+		if !ok {
+			if passphrase, err = readNewKeyPassword(fmt.Sprintf(sharePassphraseName, index), SharePassphraseEnvPrefix+strconv.Itoa(index)); err != nil {
+				return nil, err
+			}
+			w.passphrases[index] = passphrase
+		}
+		envelope, err = crypto.SealWithPassphrase(data, passphrase)
+	case OutputEcies:
+		envelope, err = crypto.SealToEcies(data, w.eciesKeys[index-1])
+	case OutputRsa:
+		envelope, err = crypto.SealToRsa(data, w.rsaKeys[index-1])
+	}
+	if err != nil {
+		return nil, code.NewI18nError(code.SystemErr, fmt.Sprintf("encrypt share %d failed: %s", index, err))
+	}
+	return json.MarshalIndent(envelope, "", "  ")
+}
+
+func (w *shareWriters) wipe() {
+	for index, passphrase := range w.passphrases {
+		secure.Wipe(passphrase)
+		delete(w.passphrases, index)
+	}
+}
+
+func encodeShareData(data []byte, encoding string) ([]string, error) {
+	var lines []string
+	switch encoding {
+	case ShareEncodingHex:
+		for start := 0; start < len(data); start += shareHexLineBytes {
+			end := start + shareHexLineBytes
+			if end > len(data) {
+				end = len(data)
+			}
+			var groups []string
+			for i := start; i < end; i += 2 {
+				groups = append(groups, hex.EncodeToString(data[i:minInt(i+2, end)]))
+			}
+			lines = append(lines, strings.Join(groups, " "))
+		}
+	case ShareEncodingMnemonic:
+		chunk := make([]byte, shareMnemonicBytes)
+		defer secure.Wipe(chunk)
+		for start := 0; start < len(data); start += shareMnemonicBytes {
+			secure.Wipe(chunk)
+			copy(chunk, data[start:])
+			mnemonic, err := hdwallet.EntropyToMnemonic(chunk, hdwallet.English)
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, mnemonic)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported share encoding: %s", encoding)
+	}
+	return lines, nil
+}
+
+func decodeShareData(lines []string, encoding string, length int) ([]byte, error) {
+	var data []byte
+	switch encoding {
+	case ShareEncodingHex:
+		for i, line := range lines {
+			decoded, err := hex.DecodeString(strings.Join(strings.Fields(line), ""))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", i+1, err)
+			}
+			data = append(data, decoded...)
+			secure.Wipe(decoded)
+		}
+	case ShareEncodingMnemonic:
+		for i, line := range lines {
+			decoded, err := hdwallet.MnemonicToEntropy(line, hdwallet.English)
+			if err != nil {
+				return nil, fmt.Errorf("mnemonic %d: %s", i+1, err)
+			}
+			data = append(data, decoded...)
+			secure.Wipe(decoded)
+		}
+		// the zero padding of the last mnemonic
+		if length > 0 && length <= len(data) && len(data)-length < shareMnemonicBytes {
+			secure.Wipe(data[length:])
+			data = data[:length]
+		}
+	default:
+		return nil, fmt.Errorf("unsupported share encoding: %s", encoding)
+	}
+	if len(data) != length {
+		secure.Wipe(data)
+		return nil, fmt.Errorf("%d bytes decoded, the length is %d", len(data), length)
+	}
+	return data, nil
+}
+
+func shareChecksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:shareChecksumBytes])
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// loadKeyShares reconstructs the keys given as share files, in memory only.
+// readStdin tells whether a secret of the params was already read from stdin.
+func (params *RecoveryInput) loadKeyShares(readStdin bool) error {
+	keys := []struct {
+		name   string
+		value  *string
+		shares []*KeyShareFile
+	}{
+		{name: "ecies_private_key", value: &params.EciesPrivKey, shares: params.EciesPrivKeyShares},
+		{name: "rsa_private_key", value: &params.RsaPrivKey, shares: params.RsaPrivKeyShares},
+	}
+	for _, key := range keys {
+		if len(key.shares) == 0 {
+			continue
+		}
+		if len(*key.value) > 0 {
+			return code.NewI18nError(code.ParamErr, fmt.Sprintf("%s_shares cannot be set together with %s or %s_from", key.name, key.name, key.name))
+		}
+
+		value, err := reconstructKey(key.name, key.shares, &readStdin)
+		if err != nil {
+			return err
+		}
+		*key.value = value
+	}
+	return nil
+}
+
+// reconstructKey reads the share files of the key name and combines them, the share data is wiped on return
+func reconstructKey(name string, files []*KeyShareFile, readStdin *bool) (string, error) {
+	shares := make([]*KeyShare, 0, len(files))
+	var data [][]byte
+	defer func() {
+		for _, d := range data {
+			secure.Wipe(d)
+		}
+	}()
+	for _, file := range files {
+		share, shareData, err := readKeyShare(name, file, readStdin)
+		if err != nil {
+			return "", err
+		}
+		shares = append(shares, share)
+		data = append(data, shareData)
+	}
+	return combineKeyShares(name, shares, data)
+}
+
+// readKeyShare reads and checks a share file of the key name, decrypting it if encrypted, and returns the share and its data
+func readKeyShare(name string, file *KeyShareFile, readStdin *bool) (*KeyShare, []byte, error) {
+	data, err := ioutil.ReadFile(file.Path)
+	if err != nil {
+		return nil, nil, code.NewI18nError(code.FileNotFound, fmt.Sprintf("read share file %s failed: %s", file.Path, err))
+	}
+	defer secure.Wipe(data)
+
+	plain := data
+	if envelope, err := crypto.ParseEnvelope(data); err == nil {
+		if plain, err = openShareEnvelope(envelope, file, readStdin); err != nil {
+			return nil, nil, err
+		}
+		defer secure.Wipe(plain)
+	} else if len(file.KeyFrom) > 0 {
+		common.Logger.Warnf("share file %s is not encrypted, its key_from is ignored", file.Path)
+	}
+
+	share := &KeyShare{}
+	if err = yaml.UnmarshalStrict(plain, share); err != nil {
+		return nil, nil, code.NewI18nError(code.FileFormatErr, fmt.Sprintf("parse share file %s failed: %s", file.Path, err))
+	}
+	if share.Version != keyShareVersion {
+		return nil, nil, code.NewI18nError(code.KeyShareErr, fmt.Sprintf("unsupported version %d of share file %s", share.Version, file.Path))
+	}
+	if share.Key != name {
+		return nil, nil, code.NewI18nError(code.KeyShareErr, fmt.Sprintf("share file %s is a share of %s, not %s", file.Path, share.Key, name))
+	}
+	shareData, err := decodeShareData(share.Data, share.Encoding, share.Length)
+	if err != nil {
+		return nil, nil, code.NewI18nError(code.KeyShareErr, fmt.Sprintf("decode share file %s failed: %s", file.Path, err))
+	}
+	if shareChecksum(shareData) != share.Checksum {
+		secure.Wipe(shareData)
+		return nil, nil, code.NewI18nError(code.KeyShareErr, fmt.Sprintf("checksum of share file %s does not match, check its data for typos", file.Path))
+	}
+	share.Data = nil
+	return share, shareData, nil
+}
+
+// openShareEnvelope decrypts an encrypted share with the passphrase or the custodian private key read from key_from
+func openShareEnvelope(envelope *crypto.Envelope, file *KeyShareFile, readStdin *bool) ([]byte, error) {
+	var value string
+	secret := &secretParam{value: &value, from: file.KeyFrom, multiline: envelope.Kind == crypto.EnvelopeRsa}
+	switch envelope.Kind {
+	case crypto.EnvelopePassphrase:
+		secret.name = fmt.Sprintf("passphrase of share %s", file.Path)
+	case crypto.EnvelopeEcies, crypto.EnvelopeRsa:
+		secret.name = fmt.Sprintf("%s private key of share %s", envelope.Kind, file.Path)
+	default:
+		return nil, code.NewI18nError(code.FileFormatErr, fmt.Sprintf("unsupported encryption of share file %s: %s", file.Path, envelope.Kind))
+	}
+	if len(secret.from) == 0 {
+		secret.from = SecretFromPrompt
+	}
+	if secret.from == SecretFromStdin {
+		if *readStdin {
+			return nil, code.NewI18nError(code.ParamErr, "only one secret can be read from stdin")
+		}
+		*readStdin = true
+	}
+	value, err := secret.read()
+	if err != nil {
+		return nil, err
+	}
+
+	var plain []byte
+	switch envelope.Kind {
+	case crypto.EnvelopePassphrase:
+		passphrase := []byte(value)
+		defer secure.Wipe(passphrase)
+		plain, err = envelope.OpenWithPassphrase(passphrase)
+	case crypto.EnvelopeEcies:
+		var privKey *ecies.PrivateKey
+		loadErr := (*keyPasswords)(nil).loadKey(secret.name, ShareKeyPasswordEnv, func(password crypto.PasswordFunc) (err error) {
+			privKey, err = crypto.LoadEciesPrivKey(value, password)
+			return err
+		})
+		if loadErr != nil {
+			return nil, keyError(code.EciesPrivKeyErr, secret.name, loadErr)
+		}
+		defer secure.WipeBigInt(privKey.D)
+		plain, err = envelope.OpenWithEcies(privKey)
+	case crypto.EnvelopeRsa:
+		var privKey *rsa.PrivateKey
+		loadErr := (*keyPasswords)(nil).loadKey(secret.name, ShareKeyPasswordEnv, func(password crypto.PasswordFunc) (err error) {
+			privKey, err = crypto.LoadRsaPrivKey(value, password)
+			return err
+		})
+		if loadErr != nil {
+			return nil, keyError(code.RsaPrivKeyErr, secret.name, loadErr)
+		}
+		defer wipeRsaPrivKey(privKey)
+		plain, err = envelope.OpenWithRsa(privKey)
+	}
+	if err != nil {
+		return nil, code.NewI18nError(code.KeyShareErr, fmt.Sprintf("decrypt share file %s failed: %s", file.Path, err))
+	}
+	return plain, nil
+}
+
+// combineKeyShares reconstructs the key from the shares of one split, and returns it as the params would hold it,
+// after checking it against the public key fingerprint of the shares
+func combineKeyShares(name string, shares []*KeyShare, data [][]byte) (string, error) {
+	first := shares[0]
+	for _, share := range shares[1:] {
+		if share.SplitID != first.SplitID || share.Threshold != first.Threshold || share.Shares != first.Shares || share.Fingerprint != first.Fingerprint {
+			return "", code.NewI18nError(code.KeyShareErr, fmt.Sprintf("the shares of %s are from different splits", name))
+		}
+	}
+	if len(shares) < first.Threshold {
+		return "", code.NewI18nError(code.KeyShareErr, fmt.Sprintf("%d shares of %s given, %d of %d are required", len(shares), name, first.Threshold, first.Shares))
+	}
+
+	shamirShares := make([]*shamir.Share, len(shares))
+	for i, share := range shares {
+		if share.Index < 1 || share.Index > first.Shares {
+			return "", code.NewI18nError(code.KeyShareErr, fmt.Sprintf("invalid index %d of the shares of %s", share.Index, name))
+		}
+		shamirShares[i] = &shamir.Share{Index: byte(share.Index), Data: data[i]}
+	}
+	combined, err := shamir.Combine(shamirShares)
+	if err != nil {
+		return "", code.NewI18nError(code.KeyShareErr, fmt.Sprintf("combine the shares of %s failed: %s", name, err))
+	}
+	secretBuf := secure.Copy(combined)
+	defer secretBuf.Wipe()
+	secret := secretBuf.Bytes()
+
+	var value, fingerprint string
+	switch name {
+	case "ecies_private_key":
+		privKey := ecies.NewPrivateKeyFromBytes(secret)
+		defer secure.WipeBigInt(privKey.D)
+		fingerprint = crypto.EciesPubKeyFingerprint(privKey.PublicKey)
+		value = hex.EncodeToString(secret)
+	case "rsa_private_key":
+		key, err := x509.ParsePKCS8PrivateKey(secret)
+		if err != nil {
+			return "", code.NewI18nError(code.KeyShareErr, fmt.Sprintf("the shares of %s do not reconstruct a key, a share is wrong: %s", name, err))
+		}
+		privKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return "", code.NewI18nError(code.KeyShareErr, fmt.Sprintf("the shares of %s reconstruct a %T", name, key))
+		}
+		defer wipeRsaPrivKey(privKey)
+		if fingerprint, err = crypto.RsaPubKeyFingerprint(&privKey.PublicKey); err != nil {
+			return "", err
+		}
+		value = string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: secret}))
+	}
+	if fingerprint != first.Fingerprint {
+		return "", code.NewI18nError(code.KeyShareErr, fmt.Sprintf("the key reconstructed from the shares of %s does not match their public key fingerprint, a share is wrong", name))
+	}
+	common.Logger.Infof("reconstructed %s from %d of %d shares", name, len(shares), first.Shares)
+	return value, nil
+}
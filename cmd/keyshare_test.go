@@ -0,0 +1,359 @@
+package cmd
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/gometalinter/_linters/src/gopkg.in/yaml.v2"
+	ecies "github.com/ecies/go/v2"
+	"github.com/stretchr/testify/assert"
+
+	"recovery-tool/common/code"
+	"recovery-tool/crypto"
+)
+
+// writeSplitKeys writes the keys to split as the recover params hold them, and returns the paths of their files
+func writeSplitKeys(t *testing.T, keys *backupKeys) (string, string) {
+	eciesPath := writeTestFile(t, "ecies_private_key", eciesKeyHex(keys.ecies))
+	rsaPem := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(keys.rsa)})
+	rsaPath := writeTestFile(t, "rsa_private_key", string(rsaPem))
+	return eciesPath, rsaPath
+}
+
+// eciesKeyHex is the 32 bytes scalar of the key in hex, as the shares reconstruct it
+func eciesKeyHex(key *ecies.PrivateKey) string {
+	return fmt.Sprintf("%064x", key.D)
+}
+
+// shareFiles returns the share files of key written by split-key into dir, for the share indexes
+func shareFiles(dir, key string, n int, ext, keyFrom string, indexes ...int) []*KeyShareFile {
+	var files []*KeyShareFile
+	for _, i := range indexes {
+		path := filepath.Join(dir, fmt.Sprintf("%s.share%d-of-%d.%s", key, i, n, ext))
+		files = append(files, &KeyShareFile{Path: path, KeyFrom: strings.ReplaceAll(keyFrom, "%d", fmt.Sprint(i))})
+	}
+	return files
+}
+
+// assertCombinedKeys checks the keys reconstructed into params against keys
+func assertCombinedKeys(t *testing.T, params *RecoveryInput, keys *backupKeys) {
+	assert.Equal(t, eciesKeyHex(keys.ecies), params.EciesPrivKey)
+	rsaPrivKey, err := crypto.LoadRsaPrivKey(params.RsaPrivKey, nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, keys.rsa.D, rsaPrivKey.D)
+	}
+}
+
+func TestSplitKeyCmd(t *testing.T) {
+	keys := newBackupKeys(t)
+	eciesPath, rsaPath := writeSplitKeys(t, keys)
+
+	for _, encoding := range []string{ShareEncodingHex, ShareEncodingMnemonic} {
+		t.Run(encoding, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "shares")
+			assert.NoError(t, SplitKeyCmd(eciesPath, rsaPath, 3, 5, dir, encoding, "", nil))
+			if runtime.GOOS != "windows" {
+				info, err := os.Stat(shareFiles(dir, "rsa_private_key", 5, "yaml", "", 4)[0].Path)
+				assert.NoError(t, err)
+				assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+			}
+
+			params := &RecoveryInput{
+				EciesPrivKeyShares: shareFiles(dir, "ecies_private_key", 5, "yaml", "", 5, 1, 3),
+				RsaPrivKeyShares:   shareFiles(dir, "rsa_private_key", 5, "yaml", "", 2, 3, 4, 5),
+			}
+			assert.NoError(t, params.loadKeyShares(false))
+			assertCombinedKeys(t, params, keys)
+
+			// a share is never overwritten
+			err := SplitKeyCmd(eciesPath, "", 3, 5, dir, encoding, "", nil)
+			assert.Equal(t, code.ParamErr, asI18nError(err).Code)
+		})
+	}
+
+	tests := []struct {
+		name       string
+		eciesKey   string
+		rsaKey     string
+		threshold  int
+		n          int
+		encoding   string
+		encrypt    string
+		recipients []string
+	}{
+		{name: "no key", threshold: 2, n: 3, encoding: ShareEncodingHex},
+		{name: "threshold of one", eciesKey: eciesPath, threshold: 1, n: 3, encoding: ShareEncodingHex},
+		{name: "threshold above the shares", eciesKey: eciesPath, threshold: 4, n: 3, encoding: ShareEncodingHex},
+		{name: "encoding", eciesKey: eciesPath, threshold: 2, n: 3, encoding: "base64"},
+		{name: "encryption", eciesKey: eciesPath, threshold: 2, n: 3, encoding: ShareEncodingHex, encrypt: "aes"},
+		{name: "recipients of a passphrase", eciesKey: eciesPath, threshold: 2, n: 2, encoding: ShareEncodingHex, encrypt: OutputPassphrase, recipients: []string{"a", "b"}},
+		{name: "missing recipient", eciesKey: eciesPath, threshold: 2, n: 3, encoding: ShareEncodingHex, encrypt: OutputEcies, recipients: []string{"a", "b"}},
+		{name: "key on the command line", eciesKey: eciesKeyHex(keys.ecies), threshold: 2, n: 3, encoding: ShareEncodingHex},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			err := SplitKeyCmd(test.eciesKey, test.rsaKey, test.threshold, test.n, dir, test.encoding, test.encrypt, test.recipients)
+			assert.Equal(t, code.ParamErr, asI18nError(err).Code)
+			entries, _ := os.ReadDir(dir)
+			assert.Empty(t, entries)
+		})
+	}
+
+	// the shares written before a failure are removed, a dangling link passes the check before splitting
+	// but fails the exclusive create
+	if runtime.GOOS != "windows" {
+		dir := t.TempDir()
+		blocking := shareFiles(dir, "rsa_private_key", 3, "yaml", "", 2)[0].Path
+		assert.NoError(t, os.Symlink(filepath.Join(dir, "missing"), blocking))
+		err := SplitKeyCmd(eciesPath, rsaPath, 2, 3, dir, ShareEncodingHex, "", nil)
+		assert.Equal(t, code.ParamErr, asI18nError(err).Code)
+		entries, _ := os.ReadDir(dir)
+		assert.Len(t, entries, 1)
+
+		assert.NoError(t, os.Remove(blocking))
+		assert.NoError(t, SplitKeyCmd(eciesPath, rsaPath, 2, 3, dir, ShareEncodingHex, "", nil))
+		entries, _ = os.ReadDir(dir)
+		assert.Len(t, entries, 6)
+	}
+}
+
+func TestSplitKeyEnvelopes(t *testing.T) {
+	keys := newBackupKeys(t)
+	eciesPath, rsaPath := writeSplitKeys(t, keys)
+
+	t.Run("passphrase", func(t *testing.T) {
+		for i := 1; i <= 3; i++ {
+			t.Setenv(fmt.Sprintf("%s%d", SharePassphraseEnvPrefix, i), fmt.Sprintf("custodian %d", i))
+		}
+		dir := t.TempDir()
+		assert.NoError(t, SplitKeyCmd(eciesPath, rsaPath, 2, 3, dir, ShareEncodingMnemonic, OutputPassphrase, nil))
+
+		keyFrom := SecretFromEnv + SharePassphraseEnvPrefix + "%d"
+		params := &RecoveryInput{
+			EciesPrivKeyShares: shareFiles(dir, "ecies_private_key", 3, "json", keyFrom, 1, 3),
+			RsaPrivKeyShares:   shareFiles(dir, "rsa_private_key", 3, "json", keyFrom, 2, 3),
+		}
+		assert.NoError(t, params.loadKeyShares(false))
+		assertCombinedKeys(t, params, keys)
+
+		// the passphrase of another custodian
+		params = &RecoveryInput{EciesPrivKeyShares: shareFiles(dir, "ecies_private_key", 3, "json", keyFrom, 1, 3)}
+		params.EciesPrivKeyShares[1].KeyFrom = SecretFromEnv + SharePassphraseEnvPrefix + "1"
+		assert.Equal(t, code.KeyShareErr, asI18nError(params.loadKeyShares(false)).Code)
+	})
+
+	t.Run("ecies", func(t *testing.T) {
+		var recipients []string
+		custodianDir := t.TempDir()
+		for i := 1; i <= 3; i++ {
+			custodian, err := ecies.GenerateKey()
+			assert.NoError(t, err)
+			recipients = append(recipients, custodian.PublicKey.Hex(true))
+			path := filepath.Join(custodianDir, fmt.Sprintf("custodian%d", i))
+			assert.NoError(t, os.WriteFile(path, []byte(eciesKeyHex(custodian)), 0600))
+		}
+		dir := t.TempDir()
+		assert.NoError(t, SplitKeyCmd(eciesPath, "", 2, 3, dir, ShareEncodingHex, OutputEcies, recipients))
+
+		keyFrom := SecretFromFile + filepath.Join(custodianDir, "custodian%d")
+		params := &RecoveryInput{EciesPrivKeyShares: shareFiles(dir, "ecies_private_key", 3, "json", keyFrom, 2, 1)}
+		assert.NoError(t, params.loadKeyShares(false))
+		assert.Equal(t, eciesKeyHex(keys.ecies), params.EciesPrivKey)
+
+		// the key of a share is read from stdin, once
+		setStdin(t, recipientKey(t, custodianDir, 1))
+		params = &RecoveryInput{EciesPrivKeyShares: shareFiles(dir, "ecies_private_key", 3, "json", keyFrom, 1, 2)}
+		params.EciesPrivKeyShares[0].KeyFrom = SecretFromStdin
+		assert.NoError(t, params.loadKeyShares(false))
+		assert.Equal(t, eciesKeyHex(keys.ecies), params.EciesPrivKey)
+
+		setStdin(t, recipientKey(t, custodianDir, 1))
+		params = &RecoveryInput{EciesPrivKeyShares: shareFiles(dir, "ecies_private_key", 3, "json", SecretFromStdin, 1, 2)}
+		err := params.loadKeyShares(false)
+		i18nErr := asI18nError(err)
+		assert.Equal(t, code.ParamErr, i18nErr.Code)
+		assert.Contains(t, i18nErr.Msg, "stdin")
+
+		// a secret of the params was already read from stdin
+		params = &RecoveryInput{EciesPrivKeyShares: shareFiles(dir, "ecies_private_key", 3, "json", keyFrom, 1, 2)}
+		params.EciesPrivKeyShares[1].KeyFrom = SecretFromStdin
+		assert.Equal(t, code.ParamErr, asI18nError(params.loadKeyShares(true)).Code)
+	})
+
+	t.Run("rsa", func(t *testing.T) {
+		var recipients []string
+		custodianDir := t.TempDir()
+		for i := 1; i <= 2; i++ {
+			custodian := newBackupKeys(t).rsa
+			pubPem, err := crypto.MarshalRsaPubKey(&custodian.PublicKey)
+			assert.NoError(t, err)
+			// a recipient is the public key or the path of its file
+			if i == 1 {
+				recipients = append(recipients, string(pubPem))
+			} else {
+				recipients = append(recipients, writeTestFile(t, "recipient.pem", string(pubPem)))
+			}
+			privPem := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(custodian)})
+			assert.NoError(t, os.WriteFile(filepath.Join(custodianDir, fmt.Sprintf("custodian%d", i)), privPem, 0600))
+		}
+		dir := t.TempDir()
+		assert.NoError(t, SplitKeyCmd("", rsaPath, 2, 2, dir, ShareEncodingMnemonic, OutputRsa, recipients))
+
+		keyFrom := SecretFromFile + filepath.Join(custodianDir, "custodian%d")
+		params := &RecoveryInput{RsaPrivKeyShares: shareFiles(dir, "rsa_private_key", 2, "json", keyFrom, 1, 2)}
+		assert.NoError(t, params.loadKeyShares(false))
+		rsaPrivKey, err := crypto.LoadRsaPrivKey(params.RsaPrivKey, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, keys.rsa.D, rsaPrivKey.D)
+
+		// the shares of the rsa key are not for the ecies key
+		params = &RecoveryInput{EciesPrivKeyShares: shareFiles(dir, "rsa_private_key", 2, "json", keyFrom, 1, 2)}
+		assert.Equal(t, code.KeyShareErr, asI18nError(params.loadKeyShares(false)).Code)
+	})
+}
+
+// recipientKey reads the private key of custodian i written by the test
+func recipientKey(t *testing.T, dir string, i int) string {
+	data, err := os.ReadFile(filepath.Join(dir, fmt.Sprintf("custodian%d", i)))
+	assert.NoError(t, err)
+	return string(data)
+}
+
+func TestLoadKeyShares(t *testing.T) {
+	keys := newBackupKeys(t)
+	eciesPath, _ := writeSplitKeys(t, keys)
+	dir, otherDir := t.TempDir(), t.TempDir()
+	assert.NoError(t, SplitKeyCmd(eciesPath, "", 2, 3, dir, ShareEncodingHex, "", nil))
+	assert.NoError(t, SplitKeyCmd(eciesPath, "", 2, 3, otherDir, ShareEncodingHex, "", nil))
+
+	// a typo in the data fails the checksum
+	typo := shareFiles(dir, "ecies_private_key", 3, "yaml", "", 3)[0]
+	data, err := os.ReadFile(typo.Path)
+	assert.NoError(t, err)
+	share := &KeyShare{}
+	assert.NoError(t, yaml.Unmarshal(data, share))
+	if share.Data[0][0] == '0' {
+		share.Data[0] = "1" + share.Data[0][1:]
+	} else {
+		share.Data[0] = "0" + share.Data[0][1:]
+	}
+	data, err = yaml.Marshal(share)
+	assert.NoError(t, err)
+	typo.Path = writeTestFile(t, "typo.yaml", string(data))
+
+	tests := []struct {
+		name    string
+		params  *RecoveryInput
+		errCode string
+		errMsg  string
+	}{
+		{
+			name:    "below the threshold",
+			params:  &RecoveryInput{EciesPrivKeyShares: shareFiles(dir, "ecies_private_key", 3, "yaml", "", 2)},
+			errCode: code.KeyShareErr,
+			errMsg:  "1 shares of ecies_private_key given, 2 of 3 are required",
+		},
+		{
+			name: "different splits",
+			params: &RecoveryInput{EciesPrivKeyShares: append(shareFiles(dir, "ecies_private_key", 3, "yaml", "", 1),
+				shareFiles(otherDir, "ecies_private_key", 3, "yaml", "", 2)...)},
+			errCode: code.KeyShareErr,
+			errMsg:  "different splits",
+		},
+		{
+			name:    "checksum",
+			params:  &RecoveryInput{EciesPrivKeyShares: append(shareFiles(dir, "ecies_private_key", 3, "yaml", "", 1), typo)},
+			errCode: code.KeyShareErr,
+			errMsg:  "checksum",
+		},
+		{
+			name:    "missing file",
+			params:  &RecoveryInput{EciesPrivKeyShares: shareFiles(dir, "ecies_private_key", 4, "yaml", "", 1, 2)},
+			errCode: code.FileNotFound,
+		},
+		{
+			name:    "not a share",
+			params:  &RecoveryInput{EciesPrivKeyShares: []*KeyShareFile{{Path: eciesPath}}},
+			errCode: code.FileFormatErr,
+		},
+		{
+			name: "set together with the key",
+			params: &RecoveryInput{EciesPrivKey: eciesKeyHex(keys.ecies),
+				EciesPrivKeyShares: shareFiles(dir, "ecies_private_key", 3, "yaml", "", 1, 2)},
+			errCode: code.ParamErr,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			i18nErr := asI18nError(test.params.loadKeyShares(false))
+			assert.Equal(t, test.errCode, i18nErr.Code)
+			assert.Contains(t, i18nErr.Msg, test.errMsg)
+		})
+	}
+
+	// the shares of either split reconstruct the key, and the key_from of a plain share is ignored
+	params := &RecoveryInput{EciesPrivKeyShares: shareFiles(otherDir, "ecies_private_key", 3, "yaml", SecretFromStdin, 3, 1)}
+	assert.NoError(t, params.loadKeyShares(true))
+	assert.Equal(t, eciesKeyHex(keys.ecies), params.EciesPrivKey)
+}
+
+func TestShareData(t *testing.T) {
+	data := make([]byte, 33)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	// hex lines of 16 bytes in groups of 2 bytes, the last group and line may be short
+	lines, err := encodeShareData(data, ShareEncodingHex)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"0001 0203 0405 0607 0809 0a0b 0c0d 0e0f",
+		"1011 1213 1415 1617 1819 1a1b 1c1d 1e1f",
+		"20",
+	}, lines)
+	decoded, err := decodeShareData([]string{" 00010203 0405 0607 0809 0A0B 0c0d0e0f", "1011 1213 1415 1617 1819 1a1b 1c1d 1e1f", "20 "}, ShareEncodingHex, len(data))
+	assert.NoError(t, err)
+	assert.Equal(t, data, decoded)
+	_, err = decodeShareData(lines, ShareEncodingHex, len(data)+1)
+	assert.Error(t, err)
+	_, err = decodeShareData([]string{"0001 020"}, ShareEncodingHex, 3)
+	assert.Error(t, err)
+
+	// a 24-word mnemonic for every 32 bytes, the last one zero padded
+	lines, err = encodeShareData(data, ShareEncodingMnemonic)
+	assert.NoError(t, err)
+	if assert.Len(t, lines, 2) {
+		assert.Len(t, strings.Fields(lines[0]), 24)
+		padded := make([]byte, 32)
+		padded[0] = 32
+		expected, err := encodeShareData(padded, ShareEncodingMnemonic)
+		assert.NoError(t, err)
+		assert.Equal(t, expected[0], lines[1])
+	}
+	decoded, err = decodeShareData(lines, ShareEncodingMnemonic, len(data))
+	assert.NoError(t, err)
+	assert.Equal(t, data, decoded)
+	lines, err = encodeShareData(data[:32], ShareEncodingMnemonic)
+	assert.NoError(t, err)
+	assert.Len(t, lines, 1)
+
+	// the padding is at most one mnemonic
+	_, err = decodeShareData(lines, ShareEncodingMnemonic, 0)
+	assert.Error(t, err)
+	_, err = decodeShareData(lines, ShareEncodingMnemonic, 33)
+	assert.Error(t, err)
+	_, err = decodeShareData([]string{strings.Replace(lines[0], strings.Fields(lines[0])[0], "zzz", 1)}, ShareEncodingMnemonic, 32)
+	assert.Error(t, err)
+
+	_, err = encodeShareData(data, "base64")
+	assert.Error(t, err)
+	_, err = decodeShareData(lines, "base64", 32)
+	assert.Error(t, err)
+}
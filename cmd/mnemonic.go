@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"archive/zip"
+	"fmt"
+	"math/big"
+
+	"recovery-tool/common"
+	"recovery-tool/common/code"
+	"recovery-tool/crypto/hdwallet"
+	"recovery-tool/crypto/secure"
+)
+
+// MnemonicFix is the mistyped word of the mnemonic, corrected by fix_mnemonic.
+// The words are only written to the output file, the json returned over the FFI has the position only.
+type MnemonicFix struct {
+	Position  int    `yaml:"position" json:"position"` // starts from 1
+	Word      string `yaml:"word" json:"-"`
+	Corrected string `yaml:"corrected" json:"-"`
+}
+
+// mnemonicErrMsg explains why the mnemonic failed to create the seed, e.g. the unknown words and their suggestions
+func mnemonicErrMsg(params *RecoveryInput, err error) string {
+	diagnosis, diagnoseErr := hdwallet.DiagnoseMnemonic(params.UserMnemonic, params.MnemonicLanguage)
+	if diagnoseErr != nil || diagnosis.Valid() {
+		return err.Error()
+	}
+	return diagnosis.String()
+}
+
+// mnemonicFixable tells whether a single mistyped word of the mnemonic may have caused err
+func mnemonicFixable(err error) bool {
+	i18nErr, ok := err.(*code.I18nError)
+	return ok && (i18nErr.Code == code.MnemonicErr || i18nErr.Code == code.MnemonicNotMatch)
+}
+
+// fixMnemonic substitutes each word of the mnemonic (or only the unknown word) with the words of a valid checksum,
+// until the user pubkey of one matches a team in the backups. The mnemonic of params is replaced with the match.
+func fixMnemonic(params *RecoveryInput, cause error) error {
+	i18nErr := asI18nError(cause)
+	common.Logger.Infof("searching the single word corrections of the mnemonic in the backups")
+
+	userPubKeys, err := backupUserPubKeys(params)
+	if err != nil {
+		return err
+	}
+
+	var corrected string
+	fix, err := hdwallet.FixSingleWord(params.UserMnemonic, params.MnemonicLanguage, func(candidate string) bool {
+		userPrivKey, userChainCode, err := common.CalcMasterPrivWithPassphrase(candidate, params.MnemonicPassphrase, params.MnemonicLanguage)
+		if err != nil {
+			return false
+		}
+		scalar := new(big.Int).SetBytes(userPrivKey[:])
+		secure.Wipe(userPrivKey[:])
+		secure.Wipe(userChainCode[:])
+		userPubKey := calcUserPubKey(scalar)
+		secure.WipeBigInt(scalar)
+		if !userPubKeys[userPubKey] {
+			return false
+		}
+		corrected = candidate
+		return true
+	})
+	if err != nil {
+		return code.NewI18nError(code.MnemonicErr, err.Error())
+	}
+	if fix == nil {
+		return code.NewI18nError(i18nErr.Code, fmt.Sprintf("%s. No single word correction matches the backups either", i18nErr.Msg))
+	}
+
+	common.Logger.Warnf("word %d of the mnemonic is mistyped, recovering with its correction, see mnemonic_fix in the output", fix.Position)
+	params.UserMnemonic = corrected
+	params.mnemonicFix = &MnemonicFix{Position: fix.Position, Word: fix.Word, Corrected: fix.Corrected}
+	return nil
+}
+
+// backupUserPubKeys decrypts the user pubkeys of every entry of the backups, the invalid entries are skipped
+func backupUserPubKeys(params *RecoveryInput) (map[string]bool, error) {
+	eciesPrivKey, rsaPrivKey, err := loadDecryptionKeys(params.EciesPrivKey, params.RsaPrivKey, params.keyPasswords)
+	if err != nil {
+		return nil, err
+	}
+	decryptionKeys := &parsedParams{EciesPrivKey: eciesPrivKey, RsaPrivKey: rsaPrivKey}
+	defer decryptionKeys.wipeDecryptionKeys()
+
+	archives, err := listBackupArchives(params.zipPaths())
+	if err != nil {
+		return nil, err
+	}
+
+	userPubKeys := make(map[string]bool)
+	for _, archive := range archives {
+		zf, err := zip.OpenReader(archive)
+		if err != nil {
+			common.Logger.Errorf("open backup %s failed: %s", archive, err)
+			continue
+		}
+		for _, file := range zf.File {
+			if file.FileInfo().IsDir() {
+				continue
+			}
+			entry := inspectEntry(archive, file, eciesPrivKey, rsaPrivKey)
+			if entry.Code == "" {
+				userPubKeys[entry.UserPubKey] = true
+			}
+		}
+		zf.Close()
+	}
+	return userPubKeys, nil
+}
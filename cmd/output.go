@@ -0,0 +1,263 @@
+package cmd
+
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	ecies "github.com/ecies/go/v2"
+	"golang.org/x/term"
+
+	"recovery-tool/common"
+	"recovery-tool/common/code"
+	"recovery-tool/crypto"
+)
+
+// output encryption modes
+const (
+	OutputPlaintext  = "plaintext"
+	OutputPassphrase = crypto.EnvelopePassphrase
+	OutputEcies      = crypto.EnvelopeEcies
+	OutputRsa        = crypto.EnvelopeRsa
+)
+
+// OutputPassphraseEnv is read for the passphrase of the output before prompting on the terminal
+const OutputPassphraseEnv = "RECOVERY_OUTPUT_PASSPHRASE"
+
+// OutputEncryption is how the output file is protected, a plaintext file holding private keys must be chosen explicitly
+type OutputEncryption struct {
+	Mode string `yaml:"mode"` // plaintext, passphrase, ecies or rsa
+	// The ECIES public key in hex, or the RSA public key PEM, or the path of a file holding either
+	Recipient string `yaml:"recipient"`
+}
+
+// outputWriter writes the output files, encrypted unless the mode is plaintext
+type outputWriter struct {
+	mode        string
+	passphrase  []byte
+	eciesPubKey *ecies.PublicKey
+	rsaPubKey   *rsa.PublicKey
+}
+
+// newOutputWriter checks the mode and reads the passphrase or the recipient key, before anything is recovered.
+// Without a mode, only an output holding no secret can be written, as plaintext: neither private keys nor,
+// with fixMnemonic, the mistyped and corrected words of the mnemonic.
+func newOutputWriter(enc OutputEncryption, addressesOnly, fixMnemonic bool) (*outputWriter, error) {
+	w := &outputWriter{mode: enc.Mode}
+	var err error
+	switch enc.Mode {
+	case "":
+		if !addressesOnly {
+			return nil, code.NewI18nError(code.ParamErr, "the output holds private keys, set output_encryption or run with -plaintext")
+		}
+		if fixMnemonic {
+			return nil, code.NewI18nError(code.ParamErr, "the output may hold the corrected words of the mnemonic, set output_encryption or run with -plaintext")
+		}
+		w.mode = OutputPlaintext
+	case OutputPlaintext:
+	case OutputPassphrase:
+		if w.passphrase, err = readPassphrase("Output passphrase: ", true); err != nil {
+			return nil, err
+		}
+	case OutputEcies:
+		recipient, err := readRecipient(enc.Recipient)
+		if err != nil {
+			return nil, err
+		}
+		if w.eciesPubKey, err = ecies.NewPublicKeyFromHex(strings.TrimSpace(recipient)); err != nil {
+			return nil, code.NewI18nError(code.ParamErr, fmt.Sprintf("invalid ecies recipient: %s", err))
+		}
+	case OutputRsa:
+		recipient, err := readRecipient(enc.Recipient)
+		if err != nil {
+			return nil, err
+		}
+		if w.rsaPubKey, err = crypto.ParseRsaPubKey(recipient); err != nil {
+			return nil, code.NewI18nError(code.ParamErr, fmt.Sprintf("invalid rsa recipient: %s", err))
+		}
+	default:
+		return nil, code.NewI18nError(code.ParamErr, fmt.Sprintf("unsupported output encryption: %s", enc.Mode))
+	}
+	return w, nil
+}
+
+// write writes data with mode 0600, as an encrypted envelope unless the mode is plaintext
+func (w *outputWriter) write(data []byte, outputPath string) error {
+	var envelope *crypto.Envelope
+	var err error
+	switch w.mode {
+	case OutputPlaintext:
+		return writePrivateFile(outputPath, data)
+	case OutputPassphrase:
+		envelope, err = crypto.SealWithPassphrase(data, w.passphrase)
+	case OutputEcies:
+		envelope, err = crypto.SealToEcies(data, w.eciesPubKey)
+	case OutputRsa:
+		envelope, err = crypto.SealToRsa(data, w.rsaPubKey)
+	}
+	if err != nil {
+		return code.NewI18nError(code.SystemErr, fmt.Sprintf("encrypt output failed: %s", err))
+	}
+
+	envelopeData, err := json.MarshalIndent(envelope, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writePrivateFile(outputPath, envelopeData)
+}
+
+// writePrivateFile writes a file readable by the owner only. The mode of an existing file is tightened
+// on the open file before the data is written, as the mode passed to open only applies to a new file.
+func writePrivateFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		common.Logger.Errorf("unable to open the file: %s", err)
+		return err
+	}
+	if err = f.Chmod(0600); err == nil {
+		_, err = f.Write(data)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		common.Logger.Errorf("unable to write data into the file")
+		return err
+	}
+	return nil
+}
+
+// createFile writes data into a new file with perm, it never replaces an existing file: the exclusive
+// create fails with an error satisfying os.IsExist, even if the file appeared after an earlier check.
+func createFile(path string, data []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		common.Logger.Errorf("unable to write data into the file")
+		return err
+	}
+	return nil
+}
+
+// DecryptOutputCmd decrypts an encrypted output file into outputPath, with the key matching its mode.
+// The passphrase is read from RECOVERY_OUTPUT_PASSPHRASE or the terminal.
+func DecryptOutputCmd(inputPath, outputPath, eciesKeyPath, rsaKeyPath string) error {
+	data, err := ioutil.ReadFile(inputPath)
+	if err != nil {
+		return code.NewI18nError(code.FileNotFound, fmt.Sprintf("read encrypted output failed: %s", err))
+	}
+	envelope, err := crypto.ParseEnvelope(data)
+	if err != nil {
+		return code.NewI18nError(code.FileFormatErr, fmt.Sprintf("parse encrypted output failed: %s", err))
+	}
+
+	plain, err := openEnvelope(envelope, eciesKeyPath, rsaKeyPath)
+	if err != nil {
+		return err
+	}
+	return writePrivateFile(outputPath, plain)
+}
+
+func openEnvelope(envelope *crypto.Envelope, eciesKeyPath, rsaKeyPath string) ([]byte, error) {
+	var plain []byte
+	var err error
+	switch envelope.Kind {
+	case OutputPassphrase:
+		var passphrase []byte
+		if passphrase, err = readPassphrase("Output passphrase: ", false); err != nil {
+			return nil, err
+		}
+		plain, err = envelope.OpenWithPassphrase(passphrase)
+	case OutputEcies:
+		if len(eciesKeyPath) == 0 {
+			return nil, code.NewI18nError(code.EciesKeyNotEmpty, "the output is encrypted to an ECIES key, ECIES key cannot be empty")
+		}
+		var eciesKey string
+		if eciesKey, err = readKeyArg("ecies_private_key", eciesKeyPath, false); err != nil {
+			return nil, err
+		}
+		var eciesPrivKey *ecies.PrivateKey
+		if eciesPrivKey, err = loadEciesPrivKey(eciesKey, nil); err != nil {
+			return nil, err
+		}
+		plain, err = envelope.OpenWithEcies(eciesPrivKey)
+	case OutputRsa:
+		if len(rsaKeyPath) == 0 {
+			return nil, code.NewI18nError(code.RSAKeyNotEmpty, "the output is encrypted to an RSA key, RSA key cannot be empty")
+		}
+		var rsaKey string
+		if rsaKey, err = readKeyArg("rsa_private_key", rsaKeyPath, true); err != nil {
+			return nil, err
+		}
+		var rsaPrivKey *rsa.PrivateKey
+		if rsaPrivKey, err = loadRsaPrivKey(rsaKey, nil); err != nil {
+			return nil, err
+		}
+		plain, err = envelope.OpenWithRsa(rsaPrivKey)
+	default:
+		return nil, code.NewI18nError(code.FileFormatErr, fmt.Sprintf("unsupported encryption of output: %s", envelope.Kind))
+	}
+	if err != nil {
+		return nil, code.NewI18nError(code.DecryptOutputErr, err.Error())
+	}
+	return plain, nil
+}
+
+// readRecipient returns the recipient key, read from the file if it is a path
+func readRecipient(recipient string) (string, error) {
+	if len(recipient) == 0 {
+		return "", code.NewI18nError(code.ParamErr, "output encryption recipient cannot be empty")
+	}
+	if info, err := os.Stat(recipient); err == nil && !info.IsDir() {
+		data, err := ioutil.ReadFile(recipient)
+		if err != nil {
+			return "", code.NewI18nError(code.FileNotFound, fmt.Sprintf("read recipient failed: %s", err))
+		}
+		return string(data), nil
+	}
+	return recipient, nil
+}
+
+// readPassphrase reads the passphrase from OutputPassphraseEnv, or prompts on the terminal, twice to confirm a new one
+func readPassphrase(prompt string, confirm bool) ([]byte, error) {
+	if passphrase := os.Getenv(OutputPassphraseEnv); len(passphrase) > 0 {
+		return []byte(passphrase), nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, code.NewI18nError(code.ParamErr, fmt.Sprintf("no terminal to read the passphrase, set %s", OutputPassphraseEnv))
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	passphrase, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, code.NewI18nError(code.ParamErr, fmt.Sprintf("read passphrase failed: %s", err))
+	}
+	if len(passphrase) == 0 {
+		return nil, code.NewI18nError(code.ParamErr, "passphrase cannot be empty")
+	}
+	if !confirm {
+		return passphrase, nil
+	}
+
+	fmt.Fprint(os.Stderr, "Confirm passphrase: ")
+	confirmed, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, code.NewI18nError(code.ParamErr, fmt.Sprintf("read passphrase failed: %s", err))
+	}
+	if string(confirmed) != string(passphrase) {
+		return nil, code.NewI18nError(code.ParamErr, "passphrases do not match")
+	}
+	return passphrase, nil
+}
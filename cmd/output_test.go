@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"recovery-tool/common/code"
+)
+
+func TestWritePrivateFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not enforced on windows")
+	}
+
+	path := filepath.Join(t.TempDir(), "output.yaml")
+	assert.NoError(t, writePrivateFile(path, []byte("secret")))
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// an existing readable file is tightened and truncated
+	assert.NoError(t, os.WriteFile(path, []byte("a longer public content"), 0644))
+	assert.NoError(t, os.Chmod(path, 0644))
+	assert.NoError(t, writePrivateFile(path, []byte("secret")))
+	info, err = os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", string(data))
+
+	assert.Error(t, writePrivateFile(filepath.Join(path, "output.yaml"), []byte("secret")))
+}
+
+func TestCreateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "key.pem")
+	assert.NoError(t, createFile(path, []byte("secret"), 0600))
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(path)
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+
+	// an existing file is never replaced
+	err := createFile(path, []byte("other"), 0600)
+	assert.True(t, os.IsExist(err), err)
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", string(data))
+
+	err = createKeyFile(path, []byte("other"), 0600)
+	assert.Equal(t, code.ParamErr, asI18nError(err).Code)
+}
+
+func TestNewOutputWriter(t *testing.T) {
+	// only an output holding no secret falls back to plaintext
+	w, err := newOutputWriter(OutputEncryption{}, true, false)
+	assert.NoError(t, err)
+	assert.Equal(t, OutputPlaintext, w.mode)
+	_, err = newOutputWriter(OutputEncryption{}, false, false)
+	assert.Equal(t, code.ParamErr, asI18nError(err).Code)
+	_, err = newOutputWriter(OutputEncryption{}, true, true)
+	assert.Equal(t, code.ParamErr, asI18nError(err).Code)
+
+	w, err = newOutputWriter(OutputEncryption{Mode: OutputPlaintext}, true, true)
+	assert.NoError(t, err)
+	assert.Equal(t, OutputPlaintext, w.mode)
+	_, err = newOutputWriter(OutputEncryption{Mode: "aes"}, true, false)
+	assert.Equal(t, code.ParamErr, asI18nError(err).Code)
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"recovery-tool/common"
+	"recovery-tool/common/code"
+	"recovery-tool/crypto/secure"
+)
+
+// RawCoin is a coin type without named chain, its keys are derived without address.
+// In yaml it is either a coin type such as `9000`, or `{coin: 9000, sign_kind: eddsa}`.
+type RawCoin struct {
+	Coin     int    `yaml:"coin"`
+	SignKind string `yaml:"sign_kind"` // ecdsa (default) or eddsa
+}
+
+func (c *RawCoin) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&c.Coin); err == nil {
+		return nil
+	}
+	type plain RawCoin
+	return unmarshal((*plain)(c))
+}
+
+func (c RawCoin) String() string {
+	return fmt.Sprintf("coin %d (%s)", c.Coin, c.SignKind)
+}
+
+// checkRawCoins sets the default sign kind and removes the duplicated coins, keeping the input order
+func checkRawCoins(params *RecoveryInput) error {
+	coins := make([]RawCoin, 0, len(params.CoinType))
+	coinMap := make(map[RawCoin]struct{})
+	for _, coin := range params.CoinType {
+		if coin.Coin < 0 || coin.Coin > common.MaxIndex {
+			return code.NewI18nError(code.CoinTypeParamErr, fmt.Sprintf("coin type out of range: %d", coin.Coin))
+		}
+		switch coin.SignKind {
+		case "":
+			coin.SignKind = common.EcdsaSign
+		case common.EcdsaSign, common.EddsaSign:
+		default:
+			return code.NewI18nError(code.CoinTypeParamErr, fmt.Sprintf("unsupported sign kind of coin %d: %s", coin.Coin, coin.SignKind))
+		}
+		if _, ok := coinMap[coin]; ok {
+			continue
+		}
+		coinMap[coin] = struct{}{}
+		coins = append(coins, coin)
+	}
+	params.CoinType = coins
+	return nil
+}
+
+// deriveRawChild derives the hex keys of a coin type at the same path as the named chains, only the public key with addressesOnly
+func deriveRawChild(walletType string, vaultIndex, addressIndex int, coin RawCoin, rootKeys *common.RootKeys, addressesOnly bool) (*DeriveResult, error) {
+	hdPath := childPath(walletType, vaultIndex, coin.Coin, addressIndex)
+	privKey, pubKey, err := common.DeriveRawChild(rootKeys, hdPath, coin.SignKind)
+	if err != nil {
+		return nil, err
+	}
+
+	coinType := coin.Coin
+	child := &DeriveResult{
+		WalletType:   walletType,
+		VaultIndex:   vaultIndex,
+		CoinType:     &coinType,
+		SignKind:     coin.SignKind,
+		AddressIndex: addressIndex,
+		PubKey:       hex.EncodeToString(pubKey),
+	}
+	if addressesOnly {
+		secure.WipeBigInt(privKey)
+		return child, nil
+	}
+
+	var buf [32]byte
+	child.PrivKey = hex.EncodeToString(privKey.FillBytes(buf[:]))
+	secure.Wipe(buf[:])
+	secure.WipeBigInt(privKey)
+	return child, nil
+}
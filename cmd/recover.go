@@ -1,10 +1,9 @@
 package cmd
 
 import (
-	"archive/zip"
+	"context"
 	"crypto/rsa"
 	"encoding/hex"
-	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"math/big"
@@ -13,37 +12,162 @@ import (
 	"github.com/HcashOrg/hcd/dcrec/edwards"
 	"github.com/alecthomas/gometalinter/_linters/src/gopkg.in/yaml.v2"
 	"github.com/btcsuite/btcd/btcec"
-	"github.com/btcsuite/btcutil"
 	ecies "github.com/ecies/go/v2"
-	"math"
 	"recovery-tool/common"
 	"recovery-tool/common/code"
 	"recovery-tool/crypto"
+	"recovery-tool/crypto/hdwallet"
+	"recovery-tool/crypto/secure"
+	"runtime"
 	"sort"
-	"sync"
 )
 
 const (
 	// 81/WalletType/VaultIndex/CoinType/AddressIndex
-	AssetWalletPath = "81/0/%d/%d/0"
+	AssetWalletPath = "81/0/%d/%d/%d"
 	ApiWalletPath   = "81/1/0/%d/%d"
 )
 
+// wallet type
+const (
+	AssetWallet = "asset"
+	ApiWallet   = "api"
+	AllWallet   = "all" // asset and api
+)
+
 type RecoveryInput struct {
-	ZipPath      string   `yaml:"zip_path"`
-	UserMnemonic string   `yaml:"user_mnemonic"`
-	EciesPrivKey string   `yaml:"ecies_private_key"`
-	RsaPrivKey   string   `yaml:"rsa_private_key"`
-	VaultCount   int      `yaml:"valut_count"`
-	CoinType     []int    `yaml:"coin_type"`
-	Chains       []string `yaml:"chains"`
+	ZipPath      string    `yaml:"zip_path"`  // a zip file, or a directory of zip files
+	ZipPaths     []string  `yaml:"zip_paths"` // more zip files or directories, searched after zip_path
+	UserMnemonic string    `yaml:"user_mnemonic"`
+	EciesPrivKey string    `yaml:"ecies_private_key"`
+	RsaPrivKey   string    `yaml:"rsa_private_key"`
+	VaultCount   int       `yaml:"vault_count"`
+	Vaults       string    `yaml:"vaults"`    // vault indices such as "1,5,10-20", overrides vault_count
+	CoinType     []RawCoin `yaml:"coin_type"` // coin types without named chain, derived without address
+	Chains       []string  `yaml:"chains"`
+	WalletType   string    `yaml:"wallet_type"`   // asset (default), api or all
+	AddressCount int       `yaml:"address_count"` // address count of each vault or api wallet coin, default 1
+	// Explicit address indices such as "0-9,15", overrides address_count
+	AddressIndices string `yaml:"address_indices"`
+
+	// english (default), chinese_simplified, chinese_traditional, japanese, korean, french, italian or spanish
+	MnemonicLanguage   string `yaml:"mnemonic_language"`
+	MnemonicPassphrase string `yaml:"mnemonic_passphrase"` // the optional BIP39 passphrase
+	// Try correcting one mistyped word of the mnemonic against the user pubkeys of the backups
+	FixMnemonic bool `yaml:"fix_mnemonic"`
+
+	// The legacy misspelled name of vault_count, still accepted
+	LegacyVaultCount int `yaml:"valut_count"`
+
+	// Where the secrets are read from instead of the params file: file:<path>, env:<name>, stdin or prompt.
+	// Only read by the command line, see loadSecrets.
+	UserMnemonicFrom       string `yaml:"user_mnemonic_from"`
+	MnemonicPassphraseFrom string `yaml:"mnemonic_passphrase_from"`
+	EciesPrivKeyFrom       string `yaml:"ecies_private_key_from"`
+	RsaPrivKeyFrom         string `yaml:"rsa_private_key_from"`
+
+	// The share files of split-key given instead of the keys, at least the threshold of each.
+	// The keys are reconstructed in memory only, see loadKeyShares.
+	EciesPrivKeyShares []*KeyShareFile `yaml:"ecies_private_key_shares"`
+	RsaPrivKeyShares   []*KeyShareFile `yaml:"rsa_private_key_shares"`
+
+	// Discover used vaults and addresses through the nodes instead of deriving the given ones
+	Discover        bool              `yaml:"discover"`
+	GapLimit        int               `yaml:"gap_limit"`         // unused vaults (or api wallet addresses) in a row before stopping, default 20
+	AddressGapLimit int               `yaml:"address_gap_limit"` // unused addresses of a vault in a row before stopping, default 1
+	Nodes           map[string]string `yaml:"nodes"`             // chain name => node url
+
+	Parallelism int `yaml:"parallelism"` // derive workers, default the number of CPUs
+
+	// Write the addresses and public keys without the private keys, for monitoring
+	AddressesOnly bool `yaml:"addresses_only"`
+
+	ScanWorkers    int  `yaml:"scan_workers"`     // backup decryption workers, default the number of CPUs
+	ScanAllBackups bool `yaml:"scan_all_backups"` // scan past the first matched team to warn about duplicated teams, by default the scan stops at it
+
+	// The team root public keys in hex (compressed secp256k1 and ed25519) and a known address,
+	// checked against the recovered keys before deriving
+	ExpectedEcdsaPubKey string           `yaml:"expected_ecdsa_public_key"`
+	ExpectedEddsaPubKey string           `yaml:"expected_eddsa_public_key"`
+	ExpectedAddress     *ExpectedAddress `yaml:"expected_address"`
+
+	// A CSV or JSON file of expected addresses, only these addresses are derived and checked, no key is written
+	VerifyAddresses string `yaml:"verify_addresses"`
+
+	// How the output file is encrypted, required unless the output holds no private key
+	OutputEncryption OutputEncryption `yaml:"output_encryption"`
+
+	vaultIndices   []int // starts from 1, the same as DeriveResult.VaultIndex
+	addressIndices []int
+
+	expectedAddresses []*ExpectedAddress // loaded from VerifyAddresses
+	rootKeysOnly      bool               // only the root keys are recovered, e.g. for the watch-only bundle
+	mnemonicFix       *MnemonicFix       // set once fix_mnemonic corrected the mnemonic
+	keyPasswords      *keyPasswords      // the passwords of the encrypted decryption keys, while the root keys are recovered
 }
 
 type DeriveResult struct {
-	VaultIndex int    `yaml:"vault_index"`
-	Chain      string `yaml:"chain"`
-	Address    string `yaml:"address"`
-	PrivKey    string `yaml:"private_key"`
+	WalletType   string `yaml:"wallet_type" json:"wallet_type"`
+	VaultIndex   int    `yaml:"vault_index,omitempty" json:"vault_index,omitempty"` // api wallet does not belong to any vault
+	Chain        string `yaml:"chain,omitempty" json:"chain,omitempty"`
+	CoinType     *int   `yaml:"coin_type,omitempty" json:"coin_type,omitempty"` // only set for coin_type entries, which have no chain
+	SignKind     string `yaml:"sign_kind,omitempty" json:"sign_kind,omitempty"`
+	AddressIndex int    `yaml:"address_index" json:"address_index"`
+	Address      string `yaml:"address,omitempty" json:"address,omitempty"`
+	PubKey       string `yaml:"public_key,omitempty" json:"public_key,omitempty"`
+	PrivKey      string `yaml:"private_key,omitempty" json:"private_key,omitempty"` // left out with addresses_only
+	Balance      string `yaml:"balance,omitempty" json:"balance,omitempty"`         // only queried by discovery
+}
+
+func (r *DeriveResult) task() deriveTask {
+	task := deriveTask{walletType: r.WalletType, vaultIndex: r.VaultIndex, chainName: r.Chain}
+	if r.CoinType != nil {
+		task.rawCoin = RawCoin{Coin: *r.CoinType, SignKind: r.SignKind}
+	}
+	return task
+}
+
+// RecoveryResult holds the derived keys, and the errors of the chains (or vaults) failed to derive
+type RecoveryResult struct {
+	AddressesOnly bool            `yaml:"addresses_only,omitempty" json:"addresses_only,omitempty"`
+	MnemonicFix   *MnemonicFix    `yaml:"mnemonic_fix,omitempty" json:"mnemonic_fix,omitempty"` // the word corrected by fix_mnemonic
+	Backups       []*BackupMatch  `yaml:"backups" json:"backups"`                               // the keys are recovered from the first one
+	Keys          []*DeriveResult `yaml:"keys" json:"keys"`
+	Errors        []*DeriveError  `yaml:"errors,omitempty" json:"errors,omitempty"`
+}
+
+type DeriveError struct {
+	WalletType string `yaml:"wallet_type" json:"wallet_type"`
+	VaultIndex int    `yaml:"vault_index,omitempty" json:"vault_index,omitempty"`
+	Chain      string `yaml:"chain,omitempty" json:"chain,omitempty"`
+	CoinType   *int   `yaml:"coin_type,omitempty" json:"coin_type,omitempty"`
+	SignKind   string `yaml:"sign_kind,omitempty" json:"sign_kind,omitempty"`
+	Code       string `yaml:"code" json:"code"`
+	Msg        string `yaml:"message" json:"message"`
+}
+
+func (e *DeriveError) String() string {
+	return e.task().String()
+}
+
+func (e *DeriveError) task() deriveTask {
+	task := deriveTask{walletType: e.WalletType, vaultIndex: e.VaultIndex, chainName: e.Chain}
+	if e.CoinType != nil {
+		task.rawCoin = RawCoin{Coin: *e.CoinType, SignKind: e.SignKind}
+	}
+	return task
+}
+
+// Err returns the errors joined together when nothing was recovered, keeping the code of the first error
+func (r *RecoveryResult) Err() error {
+	if len(r.Keys) > 0 || len(r.Errors) == 0 {
+		return nil
+	}
+	msgs := make([]string, 0, len(r.Errors))
+	for _, deriveErr := range r.Errors {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", deriveErr, deriveErr.Msg))
+	}
+	return code.NewI18nError(r.Errors[0].Code, strings.Join(msgs, "; "))
 }
 
 type parsedParams struct {
@@ -54,91 +178,225 @@ type parsedParams struct {
 	RsaPrivKey        *rsa.PrivateKey
 }
 
-func RecoverKeysCmd(paramsPath string, outputPath string) error {
-	params := loadRecoveryParams(paramsPath)
+// wipeDecryptionKeys zeroes the ECIES and RSA private keys, once the backup is decrypted
+func (parsed *parsedParams) wipeDecryptionKeys() {
+	secure.WipeBigInt(parsed.EciesPrivKey.D)
+	wipeRsaPrivKey(parsed.RsaPrivKey)
+}
+
+// wipeRsaPrivKey zeroes the private values of an RSA key
+func wipeRsaPrivKey(rsaPrivKey *rsa.PrivateKey) {
+	secure.WipeBigInt(rsaPrivKey.D)
+	for _, prime := range rsaPrivKey.Primes {
+		secure.WipeBigInt(prime)
+	}
+	secure.WipeBigInt(rsaPrivKey.Precomputed.Dp)
+	secure.WipeBigInt(rsaPrivKey.Precomputed.Dq)
+	secure.WipeBigInt(rsaPrivKey.Precomputed.Qinv)
+	for _, value := range rsaPrivKey.Precomputed.CRTValues {
+		secure.WipeBigInt(value.Exp)
+		secure.WipeBigInt(value.Coeff)
+	}
+}
+
+// RecoverOptions are the recover flags of the command line, each one set overrides the params
+type RecoverOptions struct {
+	Discover      bool             // discover the used vaults and addresses instead of deriving vault_count vaults
+	VerifyPath    string           // verify the expected addresses of the file instead of writing the keys
+	AddressesOnly bool             // no private key is written
+	FixMnemonic   bool             // search a single mistyped word of the mnemonic against the backups
+	Output        OutputEncryption // encrypt the keys with it instead of the output_encryption of the params
+}
+
+// RecoverKeysCmd writes the recovered keys, or with opts.VerifyPath (or verify_addresses in the params)
+// the report of the expected addresses instead.
+func RecoverKeysCmd(ctx context.Context, paramsPath string, outputPath string, opts RecoverOptions) error {
+	params, err := loadRecoveryParams(paramsPath)
+	if err != nil {
+		return err
+	}
+	if opts.Discover {
+		params.Discover = true
+	}
+	if opts.FixMnemonic {
+		params.FixMnemonic = true
+	}
+	if opts.AddressesOnly {
+		params.AddressesOnly = true
+	}
+	if len(opts.VerifyPath) > 0 {
+		params.VerifyAddresses = opts.VerifyPath
+	}
+	if len(opts.Output.Mode) > 0 {
+		params.OutputEncryption = opts.Output
+	}
+	if params.verifying() {
+		return verifyAddressesCmd(ctx, params, outputPath)
+	}
 
-	result, err := RecoverKeys(params)
+	// fails before the slow recovery if the output cannot be written safely
+	writer, err := newOutputWriter(params.OutputEncryption, params.AddressesOnly, params.FixMnemonic)
+	if err != nil {
+		return err
+	}
+
+	result, err := RecoverKeysWithContext(ctx, params)
 	if err != nil {
 		common.Logger.Errorf("derive keys failed")
 		return err
 	}
 
-	if err = SaveResult(&result, outputPath); err != nil {
+	if err = saveResult(result, outputPath, writer); err != nil {
 		common.Logger.Errorf("save result failed")
 		return err
 	}
+	if len(result.Errors) > 0 {
+		return code.NewI18nError(code.PartialRecoveryErr, fmt.Sprintf("%d derivations failed, see the errors in %s", len(result.Errors), outputPath))
+	}
 	return nil
 }
 
-func RecoverKeys(params RecoveryInput) ([]*DeriveResult, error) {
-	if err := checkParams(params); err != nil {
+func RecoverKeys(params RecoveryInput) (*RecoveryResult, error) {
+	return RecoverKeysWithContext(context.Background(), params)
+}
+
+// RecoverKeysWithContext stops deriving the childs once ctx is done.
+// A failed chain (or vault) does not stop the others, it is reported in the errors of the result.
+// An error is returned only when nothing was recovered. The root keys are wiped before it returns.
+func RecoverKeysWithContext(ctx context.Context, params RecoveryInput) (*RecoveryResult, error) {
+	if err := checkParams(&params); err != nil {
 		return nil, err
 	}
 
-	parsed, err := parseParams(params)
+	privs, backups, err := recoverRootKeys(&params)
 	if err != nil {
 		return nil, err
 	}
+	defer privs.Wipe()
 
-	hbcPrivs, err := findHbcPrivs(params.ZipPath, parsed.UserPubKey, parsed.EciesPrivKey, parsed.RsaPrivKey)
-	if err != nil {
-		common.Logger.Errorf("find hbc private info failed: %s", err)
+	var result *RecoveryResult
+	if params.Discover {
+		result = discoverChilds(ctx, &params, privs)
+	} else {
+		result = concurrentDeriveChilds(ctx, &params, privs)
+	}
+	result.Backups = backups
+	result.MnemonicFix = params.mnemonicFix
+	result.AddressesOnly = params.AddressesOnly
+	for _, deriveErr := range result.Errors {
+		common.Logger.Errorf("derive %s failed: %s", deriveErr, deriveErr.Msg)
+	}
+	if err = result.Err(); err != nil {
 		return nil, err
 	}
+	return result, nil
+}
 
-	eddsaPrivKey := new(big.Int).SetBytes(hbcPrivs[0].PrivKey.Bytes())
-	eddsaPrivKey.Add(eddsaPrivKey, hbcPrivs[1].PrivKey)
-	eddsaPrivKey.Mod(eddsaPrivKey, edwards.Edwards().N)
-	eddsaPrivKey.Add(eddsaPrivKey, parsed.UserPrivKeyScalar)
-	eddsaPrivKey.Mod(eddsaPrivKey, edwards.Edwards().N)
+// recoverRootKeys finds the team of the mnemonic in the backups, and returns the verified root keys of its shares.
+// The caller must wipe the root keys once they are used.
+// With fix_mnemonic, a mnemonic failing the checksum or matching no team is corrected first if a single word is wrong.
+func recoverRootKeys(params *RecoveryInput) (*common.RootKeys, []*BackupMatch, error) {
+	params.keyPasswords = newKeyPasswords()
+	defer params.keyPasswords.wipe()
+
+	parsed, hbcPrivs, backups, err := findTeam(params)
+	if err != nil && mnemonicFixable(err) {
+		if !params.FixMnemonic {
+			i18nErr := asI18nError(err)
+			return nil, nil, code.NewI18nError(i18nErr.Code, fmt.Sprintf("%s. Set fix_mnemonic to search the correction of a mistyped word", i18nErr.Msg))
+		}
+		if err = fixMnemonic(params, err); err == nil {
+			parsed, hbcPrivs, backups, err = findTeam(params)
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	usrShare := &common.RootKey{
+		PrivKey:     parsed.UserPrivKeyScalar,
+		EcdsaPubKey: crypto.ScalarBaseMult(crypto.S256(), parsed.UserPrivKeyScalar),
+		EddsaPubKey: crypto.ScalarBaseMult(crypto.Edwards(), parsed.UserPrivKeyScalar),
+		ChainCode:   parsed.UserChainCode[:],
+	}
+	shares := make([]*common.RootKey, 0, len(hbcPrivs)+1)
+	shares = append(shares, hbcPrivs...)
+	shares = append(shares, usrShare)
+
+	eddsaPrivKey := new(big.Int)
+	for _, share := range shares {
+		eddsaPrivKey.Add(eddsaPrivKey, share.PrivKey)
+		eddsaPrivKey.Mod(eddsaPrivKey, edwards.Edwards().N)
+	}
 
 	privs := &common.RootKeys{
-		HbcShare0: hbcPrivs[0],
-		HbcShare1: hbcPrivs[1],
-		UsrShare: &common.RootKey{
-			PrivKey:     parsed.UserPrivKeyScalar,
-			EcdsaPubKey: crypto.ScalarBaseMult(crypto.S256(), parsed.UserPrivKeyScalar),
-			EddsaPubKey: crypto.ScalarBaseMult(crypto.Edwards(), parsed.UserPrivKeyScalar),
-			ChainCode:   parsed.UserChainCode[:],
-		},
-		// EddsaPubKey: pubKey,
+		Shares:      shares,
 		EddsaPubKey: crypto.ScalarBaseMult(crypto.Edwards(), eddsaPrivKey),
 	}
+	secure.WipeBigInt(eddsaPrivKey)
+	privs.EnableCache()
 
-	keys, err := concurrentDeriveChilds(params.VaultCount, params.Chains, privs)
+	if err = verifyRootKeys(params, backups[0].team, privs); err != nil {
+		common.Logger.Errorf("verify root keys failed: %s", err)
+		privs.Wipe()
+		return nil, nil, err
+	}
+	return privs, backups, nil
+}
+
+// findTeam parses the params and finds the hbc keys of the team of the mnemonic in the backups
+func findTeam(params *RecoveryInput) (*parsedParams, []*common.RootKey, []*BackupMatch, error) {
+	parsed, err := parseParams(*params)
 	if err != nil {
-		common.Logger.Errorf("derive childs failed: %s", err)
-		return nil, err
+		return nil, nil, nil, err
 	}
-	return keys, nil
+
+	hbcPrivs, backups, err := findHbcPrivs(params.zipPaths(), parsed.UserPubKey, parsed.EciesPrivKey, parsed.RsaPrivKey, params.ScanWorkers, !params.ScanAllBackups)
+	parsed.wipeDecryptionKeys()
+	if err != nil {
+		common.Logger.Errorf("find hbc private info failed: %s", err)
+		secure.WipeBigInt(parsed.UserPrivKeyScalar)
+		secure.Wipe(parsed.UserChainCode)
+		return nil, nil, nil, err
+	}
+	return parsed, hbcPrivs, backups, nil
 }
 
-func loadRecoveryParams(path string) RecoveryInput {
+// loadRecoveryParams reads the params file, and the secrets of the *_from params
+func loadRecoveryParams(path string) (RecoveryInput, error) {
+	var params RecoveryInput
 	bytess, err := ioutil.ReadFile(path)
 	if err != nil {
 		common.Logger.Errorf("load params error: %s", err.Error())
-		panic(err)
+		return params, code.NewI18nError(code.FileNotFound, fmt.Sprintf("load params %s failed: %s", path, err))
 	}
+	defer secure.Wipe(bytess)
 
-	var params RecoveryInput
 	if err = yaml.UnmarshalStrict(bytess, &params); err != nil {
 		common.Logger.Errorf("unmarshal params error: %s", err.Error())
-		panic(err)
+		return params, code.NewI18nError(code.FileFormatErr, fmt.Sprintf("parse params %s failed: %s", path, err))
+	}
+	if err = params.loadSecrets(); err != nil {
+		return params, err
 	}
-	return params
+	return params, nil
 }
 
-func checkParams(params RecoveryInput) (err error) {
-	if len(params.ZipPath) <= 0 {
+func checkParams(params *RecoveryInput) (err error) {
+	if len(params.zipPaths()) <= 0 {
 		return code.NewI18nError(code.ParamErr, "SecretKey zip file cannot be empty")
 	}
 
-	userMnemonics := strings.Split(params.UserMnemonic, " ")
-	if len(userMnemonics) != 24 {
-		return code.NewI18nError(code.MnemonicNot24Words, "mnemonic word not 24 words")
+	if len(params.MnemonicLanguage) == 0 {
+		params.MnemonicLanguage = hdwallet.English
 	}
-	for i, word := range userMnemonics {
-		userMnemonics[i] = strings.TrimSpace(word)
+	if !hdwallet.IsLanguageSupported(params.MnemonicLanguage) {
+		return code.NewI18nError(code.ParamErr, fmt.Sprintf("unsupported mnemonic language: %s", params.MnemonicLanguage))
+	}
+	switch len(strings.Fields(hdwallet.NormalizeMnemonic(params.UserMnemonic))) {
+	case 12, 15, 18, 21, 24:
+	default:
+		return code.NewI18nError(code.MnemonicNot24Words, "mnemonic must be 12, 15, 18, 21 or 24 words")
 	}
 
 	if len(params.EciesPrivKey) <= 0 {
@@ -149,13 +407,65 @@ func checkParams(params RecoveryInput) (err error) {
 		return code.NewI18nError(code.RSAKeyNotEmpty, "RSA key cannot be empty")
 	}
 
-	if params.VaultCount <= 0 {
-		return code.NewI18nError(code.VaultCountErr, "VaultCount must >= 1")
+	switch params.WalletType {
+	case "":
+		params.WalletType = AssetWallet
+	case AssetWallet, ApiWallet, AllWallet:
+	default:
+		return code.NewI18nError(code.WalletTypeErr, fmt.Sprintf("unsupported wallet type: %s", params.WalletType))
 	}
 
-	if len(params.Chains) <= 0 {
+	if params.LegacyVaultCount != 0 {
+		if params.VaultCount != 0 && params.VaultCount != params.LegacyVaultCount {
+			return code.NewI18nError(code.VaultCountErr, "vault_count and valut_count differ")
+		}
+		params.VaultCount = params.LegacyVaultCount
+	}
+	if params.hasWallet(AssetWallet) && !params.Discover && params.derivesKeys() {
+		if len(params.Vaults) > 0 {
+			params.vaultIndices, err = common.ParseIndexRange(params.Vaults)
+			if err != nil {
+				return code.NewI18nError(code.VaultIndexParamErr, err.Error())
+			}
+			if params.vaultIndices[0] < 1 {
+				return code.NewI18nError(code.VaultIndexParamErr, "vault index starts from 1")
+			}
+		} else {
+			if params.VaultCount <= 0 {
+				return code.NewI18nError(code.VaultCountErr, "VaultCount must >= 1")
+			}
+			params.vaultIndices = make([]int, params.VaultCount)
+			for i := range params.vaultIndices {
+				params.vaultIndices[i] = i + 1
+			}
+		}
+	}
+
+	if params.AddressCount < 0 {
+		return code.NewI18nError(code.AddressCountErr, "AddressCount must >= 1")
+	}
+	if params.AddressCount == 0 {
+		params.AddressCount = 1
+	}
+
+	if len(params.AddressIndices) > 0 {
+		params.addressIndices, err = common.ParseIndexRange(params.AddressIndices)
+		if err != nil {
+			return code.NewI18nError(code.AddressIndexParamErr, err.Error())
+		}
+	} else {
+		params.addressIndices = make([]int, params.AddressCount)
+		for i := range params.addressIndices {
+			params.addressIndices[i] = i
+		}
+	}
+
+	if len(params.Chains) <= 0 && len(params.CoinType) <= 0 && params.derivesKeys() {
 		return code.NewI18nError(code.ChainNameNotEmpty, "chain name cannot be empty")
 	}
+	if err = checkRawCoins(params); err != nil {
+		return err
+	}
 
 	if len(params.Chains) > 0 {
 		chainMap := make(map[string]struct{})
@@ -171,36 +481,89 @@ func checkParams(params RecoveryInput) (err error) {
 			chains[i] = strings.TrimSpace(chainName)
 			i++
 		}
+		sort.Strings(chains)
 		params.Chains = chains
 	}
 
+	if params.Parallelism < 0 {
+		return code.NewI18nError(code.ParamErr, "parallelism must >= 1")
+	}
+	if params.Parallelism == 0 {
+		params.Parallelism = runtime.NumCPU()
+	}
+
+	if params.ScanWorkers < 0 {
+		return code.NewI18nError(code.ParamErr, "scan workers must >= 1")
+	}
+	if params.ScanWorkers == 0 {
+		params.ScanWorkers = runtime.NumCPU()
+	}
+
+	if err = checkExpectedKeys(params); err != nil {
+		return err
+	}
+
+	if params.Discover {
+		if err = checkDiscoverParams(params); err != nil {
+			return err
+		}
+	}
+
+	if params.verifying() {
+		if err = checkVerifyParams(params); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// derivesKeys tells whether the chains (or coin types) of the vaults are derived, instead of
+// only the expected addresses or the root keys
+func (params *RecoveryInput) derivesKeys() bool {
+	return !params.verifying() && !params.rootKeysOnly
+}
+
+// walletTypes returns the wallet types to be recovered
+func (params *RecoveryInput) walletTypes() []string {
+	if params.WalletType == AllWallet {
+		return []string{AssetWallet, ApiWallet}
+	}
+	return []string{params.WalletType}
+}
+
+func (params *RecoveryInput) hasWallet(walletType string) bool {
+	return params.WalletType == walletType || params.WalletType == AllWallet
+}
+
 func parseParams(params RecoveryInput) (*parsedParams, error) {
-	userPrivKey, userChainCode, err := common.CalcMasterPriv(params.UserMnemonic)
+	userPrivKey, userChainCode, err := common.CalcMasterPrivWithPassphrase(params.UserMnemonic, params.MnemonicPassphrase, params.MnemonicLanguage)
 	if err != nil {
 		common.Logger.Errorf("calc user priv infos failed: %s", err)
-		return nil, code.NewI18nError(code.MnemonicErr, err.Error())
+		return nil, code.NewI18nError(code.MnemonicErr, mnemonicErrMsg(&params, err))
 	}
 	usrPrivKeyScalar := new(big.Int).SetBytes(userPrivKey[:])
+	secure.Wipe(userPrivKey[:])
 	userPubKey := calcUserPubKey(usrPrivKeyScalar)
 	common.Logger.Debugf("user pubkey: %s", userPubKey)
 
-	eciesPrivKey, err := ecies.NewPrivateKeyFromHex(params.EciesPrivKey)
+	eciesPrivKey, err := loadEciesPrivKey(params.EciesPrivKey, params.keyPasswords)
 	if err != nil {
 		common.Logger.Errorf("load ecies privkey failed: %s", err)
-		return nil, code.NewI18nError(code.EciesPrivKeyErr, err.Error())
+		secure.WipeBigInt(usrPrivKeyScalar)
+		return nil, err
 	}
-	common.Logger.Debugf("ecies privkey: %d", eciesPrivKey.D)
+	common.Logger.Debugf("ecies privkey: %s", eciesPrivKey)
 
-	rsaPrivKey, err := crypto.ParseRsaPrivKey(params.RsaPrivKey)
+	rsaPrivKey, err := loadRsaPrivKey(params.RsaPrivKey, params.keyPasswords)
 	if err != nil {
 		common.Logger.Errorf("parse rsa privkey failed: %s", err)
-		return nil, code.NewI18nError(code.RsaPrivKeyErr, err.Error())
+		secure.WipeBigInt(usrPrivKeyScalar)
+		secure.WipeBigInt(eciesPrivKey.D)
+		return nil, err
 	}
 
-	common.Logger.Debugf("rsa privkey: %d, %d", rsaPrivKey.Primes[0], rsaPrivKey.Primes[1])
+	common.Logger.Debugf("rsa privkey: %s", rsaPrivKey)
 
 	return &parsedParams{
 		UserPrivKeyScalar: usrPrivKeyScalar,
@@ -211,18 +574,20 @@ func parseParams(params RecoveryInput) (*parsedParams, error) {
 	}, nil
 }
 
-func SaveResult(childs *[]*DeriveResult, outputPath string) error {
-	yamlData, err := yaml.Marshal(childs)
-	if err != nil {
-		common.Logger.Errorf("yaml marshal result failed: %s", err)
-		return err
+// saveResult writes the result with writer, the private keys are dropped if the result is addresses only
+func saveResult(result *RecoveryResult, outputPath string, writer *outputWriter) error {
+	if result.AddressesOnly {
+		for _, key := range result.Keys {
+			key.PrivKey = ""
+		}
 	}
-	err = ioutil.WriteFile(outputPath, yamlData, 0644)
+
+	yamlData, err := yaml.Marshal(result)
 	if err != nil {
-		common.Logger.Errorf("unable to write data into the file")
+		common.Logger.Errorf("yaml marshal result failed: %s", err)
 		return err
 	}
-	return nil
+	return writer.write(yamlData, outputPath)
 }
 
 func calcUserPubKey(privKey *big.Int) string {
@@ -231,239 +596,3 @@ func calcUserPubKey(privKey *big.Int) string {
 	pubKeyBytes := pubKeyPoint.SerializeCompressed()
 	return hex.EncodeToString(pubKeyBytes)
 }
-
-type encryptedTeam struct {
-	HbcPrivKeys   []string `json:"hbc_private_keys"`
-	HbcChainCodes []string `json:"hbc_chain_codes"`
-	UserPubKey    string   `json:"user_pub_key"`
-}
-
-func findHbcPrivs(
-	zipPath string,
-	userPubKey string,
-	eciesPrivKey *ecies.PrivateKey,
-	rsaPrivKey *rsa.PrivateKey,
-) ([]*common.RootKey, error) {
-	zf, err := zip.OpenReader(zipPath)
-	if err != nil {
-		return nil, code.NewI18nError(code.FileFormatErr, "zip file format error")
-	}
-	defer zf.Close()
-
-	var result []*common.RootKey
-
-	for _, file := range zf.File {
-		fileBytes, err := common.ReadAll(file)
-		if err != nil {
-			return nil, code.NewI18nError(code.FileFormatErr, err.Error())
-		}
-
-		encrypted := encryptedTeam{}
-		err = json.Unmarshal(fileBytes, &encrypted)
-		if err != nil {
-			return nil, code.NewI18nError(code.FailedToParseDataErr, fmt.Sprintf("unmarshal team failed: %s", err.Error()))
-		}
-
-		decryptedUsrPubKey, err := decryptUserPubKey(encrypted.UserPubKey, eciesPrivKey, rsaPrivKey)
-		if err != nil {
-			return nil, err
-		}
-
-		if decryptedUsrPubKey == userPubKey {
-			priv0, err := decryptHbcPriv(encrypted.HbcPrivKeys[0], encrypted.HbcChainCodes[0], eciesPrivKey, rsaPrivKey)
-			if err != nil {
-				return nil, err
-			}
-			priv1, err := decryptHbcPriv(encrypted.HbcPrivKeys[1], encrypted.HbcChainCodes[1], eciesPrivKey, rsaPrivKey)
-			if err != nil {
-				return nil, err
-			}
-
-			result = append(result, priv0)
-			result = append(result, priv1)
-			return result, nil
-		}
-	}
-	return nil, code.NewI18nError(code.MnemonicNotMatch, "mnemonic and zip do not match")
-}
-
-func decryptUserPubKey(userPubKey string, eciesPrivKey *ecies.PrivateKey, rsaPrivKey *rsa.PrivateKey) (string, error) {
-	userPubKeyBytes, err := hex.DecodeString(userPubKey)
-	if err != nil {
-		return "", code.NewI18nError(code.FailedToParseDataErr, fmt.Sprintf("hex decode user pubkey error: %s", err.Error()))
-	}
-
-	decryptedUsrPubKey, err := crypto.RsaDecryptOAEP(rsaPrivKey, userPubKeyBytes)
-	if err != nil {
-		return "", code.NewI18nError(code.RSADecryptBackupDataErr, fmt.Sprintf("rsa decrypt user pubkey error: %s", err.Error()))
-	}
-
-	decryptedUsrPubKey, err = ecies.Decrypt(eciesPrivKey, decryptedUsrPubKey)
-	if err != nil {
-		return "", code.NewI18nError(code.EciesDecryptBackupDataErr, fmt.Sprintf("ecies decrypt user pubkey error: %s", err.Error()))
-	}
-
-	return hex.EncodeToString(decryptedUsrPubKey), nil
-}
-
-func decryptHbcPriv(
-	privKey, chainCode string,
-	eciesPrivKey *ecies.PrivateKey,
-	rsaPrivKey *rsa.PrivateKey,
-) (*common.RootKey, error) {
-	privKeyBytes, err := hex.DecodeString(privKey)
-	if err != nil {
-		return nil, code.NewI18nError(code.FailedToParseDataErr, fmt.Sprintf("hex decode privkey failed: %s", err.Error()))
-	}
-	chainCodeBytes, err := hex.DecodeString(chainCode)
-	if err != nil {
-		return nil, code.NewI18nError(code.FailedToParseDataErr, fmt.Sprintf("hex decode chaincode failed: %s", err.Error()))
-	}
-
-	decryptedPrivKey, err := crypto.RsaDecryptOAEP(rsaPrivKey, privKeyBytes)
-	if err != nil {
-		return nil, code.NewI18nError(code.RSADecryptBackupDataErr, fmt.Sprintf("rsa decode privkey failed: %s", err.Error()))
-	}
-	decryptedChainCode, err := crypto.RsaDecryptOAEP(rsaPrivKey, chainCodeBytes)
-	if err != nil {
-		return nil, code.NewI18nError(code.RSADecryptBackupDataErr, fmt.Sprintf("rsa decode chaincode failed: %s", err.Error()))
-	}
-
-	decryptedPrivKey, err = ecies.Decrypt(eciesPrivKey, decryptedPrivKey)
-	if err != nil {
-		return nil, code.NewI18nError(code.EciesDecryptBackupDataErr, fmt.Sprintf("ecies decode privkey failed: %s", err.Error()))
-	}
-	decryptedChainCode, err = ecies.Decrypt(eciesPrivKey, decryptedChainCode)
-	if err != nil {
-		return nil, code.NewI18nError(code.EciesDecryptBackupDataErr, fmt.Sprintf("ecies decode chaincode failed: %s", err.Error()))
-	}
-
-	privateKey := new(big.Int).SetBytes(decryptedPrivKey)
-
-	return &common.RootKey{
-		PrivKey:     privateKey,
-		EcdsaPubKey: crypto.ScalarBaseMult(crypto.S256(), privateKey),
-		EddsaPubKey: crypto.ScalarBaseMult(crypto.Edwards(), privateKey),
-		ChainCode:   decryptedChainCode,
-	}, nil
-}
-
-func concurrentDeriveChilds(vaultCount int, chains []string, rootKeys *common.RootKeys) ([]*DeriveResult, error) {
-	deriveResult := make([]*DeriveResult, 0)
-
-	var lock sync.Mutex
-
-	var pError error
-
-	chainTotal := len(chains)
-	maxThread := 20
-	currentThread := 0
-	for i := 0; i <= int(math.Ceil(float64(chainTotal)/float64(maxThread))); i++ {
-		wg := &sync.WaitGroup{}
-		for j := 0; j < maxThread; j++ {
-			if currentThread >= chainTotal {
-				break
-			}
-
-			chainName := chains[currentThread]
-
-			wg.Add(1)
-			go func(chainName string) {
-				defer wg.Done()
-
-				vaultDeriveResult, err := deriveVaultChild(vaultCount, chainName, rootKeys)
-				if err != nil {
-					pError = err
-					return
-				}
-
-				lock.Lock()
-				deriveResult = append(deriveResult, vaultDeriveResult...)
-				lock.Unlock()
-
-			}(chainName)
-
-			currentThread++
-		}
-
-		wg.Wait()
-	}
-
-	if pError != nil {
-		return nil, pError
-	}
-
-	sortByVaultIndex := func(i, j int) bool {
-		return deriveResult[i].VaultIndex < deriveResult[j].VaultIndex
-	}
-
-	sort.Slice(deriveResult, sortByVaultIndex)
-
-	vaultResult := make(map[int][]*DeriveResult)
-	for _, item := range deriveResult {
-		vaultResult[item.VaultIndex] = append(vaultResult[item.VaultIndex], item)
-	}
-
-	deriveResult = make([]*DeriveResult, 0)
-	for vaultIndex := 1; vaultIndex <= vaultCount; vaultIndex++ {
-		if len(vaultResult[vaultIndex]) <= 0 {
-			continue
-		}
-		sort.Slice(vaultResult[vaultIndex], func(i, j int) bool {
-			return vaultResult[vaultIndex][i].Chain < vaultResult[vaultIndex][j].Chain
-		})
-		deriveResult = append(deriveResult, vaultResult[vaultIndex]...)
-	}
-
-	return deriveResult, nil
-}
-
-func deriveVaultChild(vaultCount int, chainName string, rootKeys *common.RootKeys) ([]*DeriveResult, error) {
-	deriveResult := make([]*DeriveResult, 0)
-	coinInfo, _ := common.ChainInfos[chainName]
-
-	for vaultIndex := 0; vaultIndex < vaultCount; vaultIndex++ {
-		hdPath := fmt.Sprintf(AssetWalletPath, vaultIndex, coinInfo.CoinType) // Only support asset wallet for now
-		privKey, address, err := common.DeriveChild(rootKeys, hdPath, int(coinInfo.CoinType))
-		if err != nil {
-			return nil, err
-		}
-
-		var buf [32]byte
-		privKeyBytes := privKey.FillBytes(buf[:])
-
-		deriveResult = append(deriveResult, &DeriveResult{
-			VaultIndex: vaultIndex + 1,
-			Chain:      chainName,
-			Address:    address,
-			PrivKey:    formatPrivKey(coinInfo.CoinType, privKeyBytes),
-		})
-
-	}
-	return deriveResult, nil
-}
-
-func formatPrivKey(coinType uint32, privKeyBytes []byte) string {
-	if coinType == common.BTC || coinType == common.LTC || coinType == common.DOGE || coinType == common.BCH {
-		wif := &btcutil.WIF{}
-		priv, _ := btcec.PrivKeyFromBytes(btcec.S256(), privKeyBytes)
-
-		switch coinType {
-		case common.BTC:
-			param := &common.BTCParams
-			wif, _ = btcutil.NewWIF(priv, param, true)
-		case common.DOGE:
-			param := &common.DOGEParams
-			wif, _ = btcutil.NewWIF(priv, param, true)
-		case common.LTC:
-			param := &common.LTCParams
-			wif, _ = btcutil.NewWIF(priv, param, true)
-		case common.BCH:
-			param := &common.BCHParams
-			wif, _ = btcutil.NewWIF(priv, param, true)
-		}
-		return wif.String()
-	}
-
-	return hex.EncodeToString(privKeyBytes)
-}
@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/gometalinter/_linters/src/gopkg.in/yaml.v2"
+
+	"github.com/stretchr/testify/assert"
+
+	"recovery-tool/common"
+	"recovery-tool/common/code"
+)
+
+// loadTestParams loads the params of input.yaml, recovering the test archive
+func loadTestParams(t *testing.T) RecoveryInput {
+	params, err := loadRecoveryParams("../input.yaml")
+	assert.NoError(t, err)
+	params.ZipPath = "../" + params.ZipPath
+	params.Chains = []string{common.BitcoinChain, common.SolanaChain}
+	return params
+}
+
+// scalarWords returns the words of the scalars, which are still readable once the scalars are wiped
+func scalarWords(scalars ...*big.Int) [][]big.Word {
+	words := make([][]big.Word, 0, len(scalars))
+	for _, scalar := range scalars {
+		words = append(words, scalar.Bits())
+	}
+	return words
+}
+
+func assertZeroWords(t *testing.T, words [][]big.Word) {
+	for i, scalar := range words {
+		assert.NotEmpty(t, scalar, "scalar %d", i)
+		for _, word := range scalar {
+			assert.Zero(t, word, "scalar %d", i)
+		}
+	}
+}
+
+func TestRecoverKeys(t *testing.T) {
+	result, err := RecoverKeys(loadTestParams(t))
+	assert.NoError(t, err)
+	assert.Empty(t, result.Errors)
+	if assert.Len(t, result.Keys, 2) {
+		assert.Equal(t, "1KqwEg4wKkvMhBRwxqRpdHreJstDp4r5zS", result.Keys[0].Address)
+		assert.NotEmpty(t, result.Keys[1].PrivKey)
+	}
+
+	params := loadTestParams(t)
+	params.UserMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+	_, err = RecoverKeys(params)
+	assert.Equal(t, code.MnemonicNotMatch, asI18nError(err).Code)
+}
+
+func TestRecoverKeysCmd(t *testing.T) {
+	data, err := yaml.Marshal(loadTestParams(t))
+	assert.NoError(t, err)
+	paramsPath := writeTestFile(t, "input.yaml", string(data))
+
+	// the keys are not written without an output mode
+	outputPath := filepath.Join(t.TempDir(), "output.yaml")
+	err = RecoverKeysCmd(context.Background(), paramsPath, outputPath, RecoverOptions{})
+	assert.Equal(t, code.ParamErr, asI18nError(err).Code)
+
+	assert.NoError(t, RecoverKeysCmd(context.Background(), paramsPath, outputPath, RecoverOptions{AddressesOnly: true}))
+	result := &RecoveryResult{}
+	data, err = os.ReadFile(outputPath)
+	assert.NoError(t, err)
+	assert.NoError(t, yaml.Unmarshal(data, result))
+	assert.Len(t, result.Keys, 2)
+	for _, key := range result.Keys {
+		assert.NotEmpty(t, key.Address)
+		assert.Empty(t, key.PrivKey)
+	}
+
+	verifyPath := writeTestFile(t, "addresses.csv", "vault,chain,address\n1,Bitcoin,1KqwEg4wKkvMhBRwxqRpdHreJstDp4r5zS\n")
+	assert.NoError(t, RecoverKeysCmd(context.Background(), paramsPath, outputPath, RecoverOptions{VerifyPath: verifyPath}))
+	data, err = os.ReadFile(outputPath)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "passed: 1\n")
+}
+
+func TestRecoverRootKeysWipe(t *testing.T) {
+	params := loadTestParams(t)
+	assert.NoError(t, checkParams(&params))
+	privs, _, err := recoverRootKeys(&params)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var scalars []*big.Int
+	var chainCodes [][]byte
+	for _, share := range privs.Shares {
+		scalars = append(scalars, share.PrivKey)
+		chainCodes = append(chainCodes, share.ChainCode)
+	}
+	words := scalarWords(scalars...)
+	result := concurrentDeriveChilds(context.Background(), &params, privs)
+	assert.Len(t, result.Keys, 2)
+
+	// the shares of the hbc keys and of the user, and the derive cache filled above
+	privs.Wipe()
+	assertZeroWords(t, words)
+	for _, chainCode := range chainCodes {
+		assert.Equal(t, make([]byte, len(chainCode)), chainCode)
+	}
+}
+
+func TestWipeDecryptionKeys(t *testing.T) {
+	keys := newBackupKeys(t)
+	rsaKey := keys.rsa
+	words := scalarWords(keys.ecies.D, rsaKey.D, rsaKey.Primes[0], rsaKey.Primes[1],
+		rsaKey.Precomputed.Dp, rsaKey.Precomputed.Dq, rsaKey.Precomputed.Qinv)
+
+	(&parsedParams{EciesPrivKey: keys.ecies, RsaPrivKey: keys.rsa}).wipeDecryptionKeys()
+	assertZeroWords(t, words)
+}
+
+func TestRecoverKeysFixMnemonic(t *testing.T) {
+	params := loadTestParams(t)
+	params.UserMnemonic = strings.Replace(params.UserMnemonic, "garlic", "garlik", 1)
+	_, err := RecoverKeys(params)
+	i18nErr := asI18nError(err)
+	assert.Equal(t, code.MnemonicErr, i18nErr.Code)
+	assert.NotContains(t, i18nErr.Msg, "garlik")
+	assert.Contains(t, i18nErr.Msg, "word 2 ")
+
+	params.FixMnemonic = true
+	result, err := RecoverKeys(params)
+	assert.NoError(t, err)
+	assert.Equal(t, &MnemonicFix{Position: 2, Word: "garlik", Corrected: "garlic"}, result.MnemonicFix)
+
+	// the words are written to the output file, but not to the json of the FFI
+	yamlData, err := yaml.Marshal(result)
+	assert.NoError(t, err)
+	assert.Contains(t, string(yamlData), "corrected: garlic")
+	jsonData, err := json.Marshal(result)
+	assert.NoError(t, err)
+	assert.Contains(t, string(jsonData), `"mnemonic_fix":{"position":2}`)
+	assert.NotContains(t, string(jsonData), "garli")
+}
@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+
+	"recovery-tool/common"
+	"recovery-tool/common/code"
+	"recovery-tool/crypto/secure"
+)
+
+// secret sources of the *_from params, instead of writing the secrets into the params file
+const (
+	SecretFromFile   = "file:"  // file:<path>, the whole file, surrounding spaces trimmed
+	SecretFromEnv    = "env:"   // env:<name>, an environment variable
+	SecretFromStdin  = "stdin"  // everything read from stdin, only one secret can be read from it
+	SecretFromPrompt = "prompt" // typed on the terminal without echo
+)
+
+// the last line of a PEM key typed on the prompt
+const pemEndMarker = "-----END "
+
+// secretParam is a secret field of the params and where it is read from
+type secretParam struct {
+	name      string // the yaml name
+	value     *string
+	from      string
+	multiline bool // a PEM key, prompted line by line until its end marker
+}
+
+func (params *RecoveryInput) secretParams() []*secretParam {
+	return []*secretParam{
+		{name: "user_mnemonic", value: &params.UserMnemonic, from: params.UserMnemonicFrom},
+		{name: "mnemonic_passphrase", value: &params.MnemonicPassphrase, from: params.MnemonicPassphraseFrom},
+		{name: "ecies_private_key", value: &params.EciesPrivKey, from: params.EciesPrivKeyFrom},
+		{name: "rsa_private_key", value: &params.RsaPrivKey, from: params.RsaPrivKeyFrom, multiline: true},
+	}
+}
+
+// loadSecrets reads the secrets of the *_from params, and reconstructs the keys of the *_shares params.
+// A secret cannot be both written in the params and read from a source.
+func (params *RecoveryInput) loadSecrets() error {
+	readStdin := false
+	for _, secret := range params.secretParams() {
+		if len(secret.from) == 0 {
+			continue
+		}
+		if len(*secret.value) > 0 {
+			return code.NewI18nError(code.ParamErr, fmt.Sprintf("%s and %s_from cannot be set together", secret.name, secret.name))
+		}
+		if secret.from == SecretFromStdin {
+			if readStdin {
+				return code.NewI18nError(code.ParamErr, "only one secret can be read from stdin")
+			}
+			readStdin = true
+		}
+
+		value, err := secret.read()
+		if err != nil {
+			return err
+		}
+		if len(value) == 0 {
+			return code.NewI18nError(code.ParamErr, fmt.Sprintf("%s read from %s is empty", secret.name, secret.from))
+		}
+		*secret.value = value
+	}
+	return params.loadKeyShares(readStdin)
+}
+
+func (secret *secretParam) read() (string, error) {
+	switch {
+	case strings.HasPrefix(secret.from, SecretFromFile):
+		return readSecretFile(secret.name, strings.TrimPrefix(secret.from, SecretFromFile))
+	case strings.HasPrefix(secret.from, SecretFromEnv):
+		name := strings.TrimPrefix(secret.from, SecretFromEnv)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", code.NewI18nError(code.ParamErr, fmt.Sprintf("environment variable %s of %s is not set", name, secret.name))
+		}
+		return strings.TrimSpace(value), nil
+	case secret.from == SecretFromStdin:
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", code.NewI18nError(code.ParamErr, fmt.Sprintf("read %s from stdin failed: %s", secret.name, err))
+		}
+		defer secure.Wipe(data)
+		return strings.TrimSpace(string(data)), nil
+	case secret.from == SecretFromPrompt:
+		return secret.prompt()
+	}
+	return "", code.NewI18nError(code.ParamErr, fmt.Sprintf("unsupported source of %s: %s, use file:<path>, env:<name>, stdin or prompt", secret.name, secret.from))
+}
+
+func readSecretFile(name, path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", code.NewI18nError(code.FileNotFound, fmt.Sprintf("%s file not found: %s", name, path))
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		common.Logger.Warnf("%s file %s is readable by other users, mode %s", name, path, info.Mode().Perm())
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", code.NewI18nError(code.FileNotFound, fmt.Sprintf("read %s file %s failed: %s", name, path, err))
+	}
+	defer secure.Wipe(data)
+	return strings.TrimSpace(string(data)), nil
+}
+
+// prompt reads the secret on the terminal without echo, a PEM key is read line by line until its end marker
+func (secret *secretParam) prompt() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", code.NewI18nError(code.ParamErr, fmt.Sprintf("no terminal to prompt %s, read it from a file, an environment variable or stdin", secret.name))
+	}
+	if secret.multiline {
+		fmt.Fprintf(os.Stderr, "Enter %s, ending with its %s line:\n", secret.name, strings.TrimSpace(pemEndMarker))
+	} else {
+		fmt.Fprintf(os.Stderr, "Enter %s: ", secret.name)
+	}
+
+	var sb strings.Builder
+	for {
+		line, err := term.ReadPassword(fd)
+		if err != nil {
+			fmt.Fprintln(os.Stderr)
+			return "", code.NewI18nError(code.ParamErr, fmt.Sprintf("read %s failed: %s", secret.name, err))
+		}
+		sb.Write(line)
+		end := !secret.multiline || strings.HasPrefix(strings.TrimSpace(string(line)), pemEndMarker)
+		secure.Wipe(line)
+		if end {
+			break
+		}
+		sb.WriteByte('\n')
+	}
+	fmt.Fprintln(os.Stderr)
+	return strings.TrimSpace(sb.String()), nil
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"recovery-tool/common/code"
+)
+
+// setStdin replaces os.Stdin with a file of content until the test ends
+func setStdin(t *testing.T, content string) {
+	stdin := os.Stdin
+	f, err := os.Open(writeTestFile(t, "stdin", content))
+	assert.NoError(t, err)
+	os.Stdin = f
+	t.Cleanup(func() {
+		os.Stdin = stdin
+		f.Close()
+	})
+}
+
+func TestLoadSecrets(t *testing.T) {
+	mnemonicFile := writeTestFile(t, "mnemonic", "  amused garlic window\n")
+	emptyFile := writeTestFile(t, "empty", "\n")
+	t.Setenv("RECOVERY_TEST_ECIES_KEY", " ea5db436 \n")
+	t.Setenv("RECOVERY_TEST_EMPTY", "")
+
+	tests := []struct {
+		name     string
+		params   RecoveryInput
+		stdin    string
+		mnemonic string
+		ecies    string
+		errCode  string
+	}{
+		{name: "file", params: RecoveryInput{UserMnemonicFrom: "file:" + mnemonicFile}, mnemonic: "amused garlic window"},
+		{name: "env", params: RecoveryInput{EciesPrivKeyFrom: "env:RECOVERY_TEST_ECIES_KEY"}, ecies: "ea5db436"},
+		{name: "stdin", params: RecoveryInput{UserMnemonicFrom: "stdin"}, stdin: "amused garlic window\n", mnemonic: "amused garlic window"},
+		{
+			name:     "every source",
+			params:   RecoveryInput{UserMnemonicFrom: "stdin", EciesPrivKeyFrom: "env:RECOVERY_TEST_ECIES_KEY"},
+			stdin:    "amused garlic window",
+			mnemonic: "amused garlic window",
+			ecies:    "ea5db436",
+		},
+		{name: "written", params: RecoveryInput{UserMnemonic: "amused", EciesPrivKey: "ea5db436"}, mnemonic: "amused", ecies: "ea5db436"},
+		{name: "prompt without terminal", params: RecoveryInput{UserMnemonicFrom: "prompt"}, errCode: code.ParamErr},
+		{name: "missing file", params: RecoveryInput{UserMnemonicFrom: "file:" + mnemonicFile + ".missing"}, errCode: code.FileNotFound},
+		{name: "unset env", params: RecoveryInput{EciesPrivKeyFrom: "env:RECOVERY_TEST_UNSET"}, errCode: code.ParamErr},
+		{name: "empty env", params: RecoveryInput{EciesPrivKeyFrom: "env:RECOVERY_TEST_EMPTY"}, errCode: code.ParamErr},
+		{name: "empty file", params: RecoveryInput{RsaPrivKeyFrom: "file:" + emptyFile}, errCode: code.ParamErr},
+		{name: "empty stdin", params: RecoveryInput{MnemonicPassphraseFrom: "stdin"}, errCode: code.ParamErr},
+		{name: "unsupported source", params: RecoveryInput{UserMnemonicFrom: "http://example.com"}, errCode: code.ParamErr},
+		{name: "mnemonic set together", params: RecoveryInput{UserMnemonic: "amused", UserMnemonicFrom: "stdin"}, errCode: code.ParamErr},
+		{name: "rsa key set together", params: RecoveryInput{RsaPrivKey: "pem", RsaPrivKeyFrom: "file:" + mnemonicFile}, errCode: code.ParamErr},
+		{
+			name:    "shares set together",
+			params:  RecoveryInput{EciesPrivKey: "ea5db436", EciesPrivKeyShares: []*KeyShareFile{{Path: mnemonicFile}}},
+			errCode: code.ParamErr,
+		},
+		{
+			name:    "two secrets from stdin",
+			params:  RecoveryInput{UserMnemonicFrom: "stdin", MnemonicPassphraseFrom: "stdin"},
+			stdin:   "amused garlic window",
+			errCode: code.ParamErr,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setStdin(t, test.stdin)
+			params := test.params
+			err := params.loadSecrets()
+			if test.errCode != "" {
+				assert.Equal(t, test.errCode, asI18nError(err).Code)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.mnemonic, params.UserMnemonic)
+			assert.Equal(t, test.ecies, params.EciesPrivKey)
+		})
+	}
+}
+
+func TestLoadRecoveryParams(t *testing.T) {
+	mnemonicFile := writeTestFile(t, "mnemonic", "amused garlic window")
+	params, err := loadRecoveryParams(writeTestFile(t, "input.yaml", "zip_path: a.zip\nvault_count: 2\nuser_mnemonic_from: file:"+mnemonicFile+"\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, "amused garlic window", params.UserMnemonic)
+	assert.Equal(t, 2, params.VaultCount)
+
+	_, err = loadRecoveryParams(filepath.Join(t.TempDir(), "input.yaml"))
+	assert.Equal(t, code.FileNotFound, asI18nError(err).Code)
+	_, err = loadRecoveryParams(writeTestFile(t, "input.yaml", "zip_path: [a.zip\n"))
+	assert.Equal(t, code.FileFormatErr, asI18nError(err).Code)
+	_, err = loadRecoveryParams(writeTestFile(t, "input.yaml", "zip_path: a.zip\nunknown_field: 1\n"))
+	assert.Equal(t, code.FileFormatErr, asI18nError(err).Code)
+	_, err = loadRecoveryParams(writeTestFile(t, "input.yaml", "user_mnemonic: amused\nuser_mnemonic_from: stdin\n"))
+	assert.Equal(t, code.ParamErr, asI18nError(err).Code)
+}
+
+func TestVaultCount(t *testing.T) {
+	tests := []struct {
+		name        string
+		vaultCount  int
+		legacyCount int
+		vaults      int
+		errCode     string
+	}{
+		{name: "vault_count", vaultCount: 3, vaults: 3},
+		{name: "valut_count", legacyCount: 2, vaults: 2},
+		{name: "both equal", vaultCount: 4, legacyCount: 4, vaults: 4},
+		{name: "both differ", vaultCount: 4, legacyCount: 5, errCode: code.VaultCountErr},
+		{name: "neither", errCode: code.VaultCountErr},
+		{name: "negative", vaultCount: -1, errCode: code.VaultCountErr},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			params := loadTestParams(t)
+			params.VaultCount = test.vaultCount
+			params.LegacyVaultCount = test.legacyCount
+			err := checkParams(&params)
+			if test.errCode != "" {
+				assert.Equal(t, test.errCode, asI18nError(err).Code)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.vaults, params.VaultCount)
+			assert.Len(t, params.vaultIndices, test.vaults)
+		})
+	}
+}
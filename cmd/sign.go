@@ -1,7 +1,6 @@
 package cmd
 
 import (
-	"encoding/hex"
 	"fmt"
 
 	"github.com/shopspring/decimal"
@@ -13,10 +12,12 @@ import (
 )
 
 func Sign(chain, url, privkey, toAddr, amount, coinAddress string) (string, error) {
-	priv, err := hex.DecodeString(privkey)
+	privBuf, err := decodePrivKey(privkey)
 	if err != nil {
-		return "", code.NewI18nError(code.PrivkeyInvalid, "The private key should be in hexadecimal format")
+		return "", err
 	}
+	defer privBuf.Wipe()
+	priv := privBuf.Bytes()
 
 	if toAddr == "" {
 		return "", code.NewI18nError(code.DstAddrNotEmpty, "The target address cannot be empty, please re-enter.")
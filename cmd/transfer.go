@@ -9,16 +9,28 @@ import (
 
 	"recovery-tool/common"
 	"recovery-tool/common/code"
+	"recovery-tool/crypto/secure"
 	"recovery-tool/tx/apt"
 	"recovery-tool/tx/dot"
 	"recovery-tool/tx/sol"
 )
 
-func Transfer(chain, url, privkey, toAddr, amount, coinAddress string) (string, error) {
+// decodePrivKey decodes a hex private key into a secret buffer, which the caller wipes
+func decodePrivKey(privkey string) (*secure.Buffer, error) {
 	priv, err := hex.DecodeString(privkey)
 	if err != nil {
-		return "", code.NewI18nError(code.PrivkeyInvalid, "The private key should be in hexadecimal format")
+		return nil, code.NewI18nError(code.PrivkeyInvalid, "The private key should be in hexadecimal format")
+	}
+	return secure.Copy(priv), nil
+}
+
+func Transfer(chain, url, privkey, toAddr, amount, coinAddress string) (string, error) {
+	privBuf, err := decodePrivKey(privkey)
+	if err != nil {
+		return "", err
 	}
+	defer privBuf.Wipe()
+	priv := privBuf.Bytes()
 
 	if toAddr == "" {
 		return "", code.NewI18nError(code.DstAddrNotEmpty, "The target address cannot be empty, please re-enter.")
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"recovery-tool/common/code"
+)
+
+func TestDecodePrivKey(t *testing.T) {
+	privKey := "0f2020d5f3ff4a08919d6e5f9058c47946dffaa620ea10e0d884c078dfa6ba23"
+	buf, err := decodePrivKey(privKey)
+	assert.NoError(t, err)
+	assert.Equal(t, privKey, hex.EncodeToString(buf.Bytes()))
+	buf.Wipe()
+	assert.Nil(t, buf.Bytes())
+
+	_, err = decodePrivKey("not hex")
+	assert.Equal(t, code.PrivkeyInvalid, asI18nError(err).Code)
+}
+
+func TestTransferErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	privKey := "0f2020d5f3ff4a08919d6e5f9058c47946dffaa620ea10e0d884c078dfa6ba23"
+	for _, chain := range []string{"sol", "apt"} {
+		_, err := Transfer(chain, server.URL, privKey, "0xc1044f9290dd287b6824842953b2b25efb3edc02d695b2f267e59cab248437c9", "1", "")
+		assert.Error(t, err, chain)
+		_, err = Sign(chain, server.URL, privKey, "0xc1044f9290dd287b6824842953b2b25efb3edc02d695b2f267e59cab248437c9", "1", "")
+		assert.Error(t, err, chain)
+	}
+
+	_, err := Transfer("sol", server.URL, privKey, "", "1", "")
+	assert.Equal(t, code.DstAddrNotEmpty, asI18nError(err).Code)
+	_, err = Transfer("sol", server.URL, "not hex", "address", "1", "")
+	assert.Equal(t, code.PrivkeyInvalid, asI18nError(err).Code)
+	_, err = Sign("btc", server.URL, privKey, "address", "1", "")
+	assert.Equal(t, code.ChainParamErr, asI18nError(err).Code)
+}
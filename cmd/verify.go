@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec"
+
+	"recovery-tool/common"
+	"recovery-tool/common/code"
+)
+
+// ExpectedAddress is an address known to belong to the team, such as a deposit address
+type ExpectedAddress struct {
+	WalletType   string `yaml:"wallet_type" json:"wallet_type"`                     // asset (default) or api
+	VaultIndex   int    `yaml:"vault_index,omitempty" json:"vault_index,omitempty"` // starts from 1, ignored by api wallets
+	Chain        string `yaml:"chain" json:"chain"`
+	AddressIndex int    `yaml:"address_index" json:"address_index"`
+	Address      string `yaml:"address" json:"address"`
+}
+
+func (a *ExpectedAddress) String() string {
+	return fmt.Sprintf("%s address %d", deriveTask{walletType: a.WalletType, vaultIndex: a.VaultIndex, chainName: a.Chain}, a.AddressIndex)
+}
+
+func (a *ExpectedAddress) check() error {
+	if err := a.checkPath("expected address"); err != nil {
+		return err
+	}
+	if len(a.Address) == 0 {
+		return code.NewI18nError(code.ParamErr, "expected address cannot be empty")
+	}
+	return nil
+}
+
+// checkPath checks the fields locating the address, and defaults the wallet type to asset.
+// name is the address in the messages, e.g. expected address.
+func (a *ExpectedAddress) checkPath(name string) error {
+	switch a.WalletType {
+	case "":
+		a.WalletType = AssetWallet
+	case AssetWallet, ApiWallet:
+	default:
+		return code.NewI18nError(code.WalletTypeErr, fmt.Sprintf("unsupported wallet type of %s: %s", name, a.WalletType))
+	}
+	if a.WalletType == AssetWallet && a.VaultIndex < 1 {
+		return code.NewI18nError(code.VaultIndexParamErr, fmt.Sprintf("vault index of %s starts from 1", name))
+	}
+	if a.WalletType == ApiWallet {
+		a.VaultIndex = 0
+	}
+	if _, ok := common.ChainInfos[a.Chain]; !ok {
+		return code.NewI18nError(code.ChainParamErr, fmt.Sprintf("unsupported chain of %s: %s", name, a.Chain))
+	}
+	if a.AddressIndex < 0 {
+		return code.NewI18nError(code.AddressIndexParamErr, fmt.Sprintf("address index of %s must >= 0", name))
+	}
+	return nil
+}
+
+// verify derives the key of the address and compares the address, returning the derived one
+func (a *ExpectedAddress) verify(rootKeys *common.RootKeys) (string, bool, error) {
+	child, err := deriveChild(a.WalletType, a.VaultIndex, a.AddressIndex, a.Chain, rootKeys, true)
+	if err != nil {
+		return "", false, err
+	}
+	return child.Address, sameAddress(child.Address, a.Address), nil
+}
+
+// sameAddress compares hex addresses (e.g. 0x...) case-insensitively, as they may be checksummed or not
+func sameAddress(a, b string) bool {
+	if strings.HasPrefix(a, "0x") && strings.HasPrefix(b, "0x") {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+func checkExpectedKeys(params *RecoveryInput) error {
+	if len(params.ExpectedEcdsaPubKey) > 0 {
+		if _, err := parseEcdsaRootPubKey(params.ExpectedEcdsaPubKey); err != nil {
+			return code.NewI18nError(code.ParamErr, fmt.Sprintf("invalid expected ecdsa public key: %s", err))
+		}
+	}
+	if len(params.ExpectedEddsaPubKey) > 0 {
+		if _, err := parseEddsaRootPubKey(params.ExpectedEddsaPubKey); err != nil {
+			return code.NewI18nError(code.ParamErr, fmt.Sprintf("invalid expected eddsa public key: %s", err))
+		}
+	}
+	if params.ExpectedAddress != nil {
+		return params.ExpectedAddress.check()
+	}
+	return nil
+}
+
+// parseEcdsaRootPubKey returns the compressed form of a compressed or uncompressed secp256k1 public key in hex
+func parseEcdsaRootPubKey(pubKey string) ([]byte, error) {
+	pubKeyBytes, err := hex.DecodeString(strings.TrimPrefix(pubKey, "0x"))
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := btcec.ParsePubKey(pubKeyBytes, btcec.S256())
+	if err != nil {
+		return nil, err
+	}
+	return parsed.SerializeCompressed(), nil
+}
+
+func parseEddsaRootPubKey(pubKey string) ([]byte, error) {
+	pubKeyBytes, err := hex.DecodeString(strings.TrimPrefix(pubKey, "0x"))
+	if err != nil {
+		return nil, err
+	}
+	if len(pubKeyBytes) != 32 {
+		return nil, fmt.Errorf("invalid length: %d", len(pubKeyBytes))
+	}
+	return pubKeyBytes, nil
+}
+
+// verifyRootKeys checks the sum of the recovered shares against the team public keys in the backup entry
+// and in the input, and against the expected address, so that a corrupted share or a wrong archive
+// fails before any key is written. Nothing is checked if neither supplies them.
+func verifyRootKeys(params *RecoveryInput, team *encryptedTeam, rootKeys *common.RootKeys) error {
+	ecdsaPubKey, eddsaPubKey := rootKeys.RootPubKeys()
+
+	type expectedPubKey struct {
+		source   string
+		pubKey   string
+		parse    func(string) ([]byte, error)
+		computed []byte
+	}
+	expected := make([]expectedPubKey, 0, 4)
+	if team != nil {
+		expected = append(expected,
+			expectedPubKey{"backup ecdsa public key", team.EcdsaPubKey, parseEcdsaRootPubKey, ecdsaPubKey},
+			expectedPubKey{"backup eddsa public key", team.EddsaPubKey, parseEddsaRootPubKey, eddsaPubKey})
+	}
+	expected = append(expected,
+		expectedPubKey{"expected ecdsa public key", params.ExpectedEcdsaPubKey, parseEcdsaRootPubKey, ecdsaPubKey},
+		expectedPubKey{"expected eddsa public key", params.ExpectedEddsaPubKey, parseEddsaRootPubKey, eddsaPubKey})
+
+	for _, e := range expected {
+		if len(e.pubKey) == 0 {
+			continue
+		}
+		pubKey, err := e.parse(e.pubKey)
+		if err != nil {
+			return code.NewI18nError(code.FailedToParseDataErr, fmt.Sprintf("parse %s failed: %s", e.source, err))
+		}
+		if !bytes.Equal(pubKey, e.computed) {
+			return code.NewI18nError(code.RootKeyMismatchErr, fmt.Sprintf("recovered root public key %x does not match the %s %s", e.computed, e.source, e.pubKey))
+		}
+		common.Logger.Infof("recovered root keys match the %s", e.source)
+	}
+
+	if params.ExpectedAddress != nil {
+		address, ok, err := params.ExpectedAddress.verify(rootKeys)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return code.NewI18nError(code.RootKeyMismatchErr, fmt.Sprintf("recovered %s is %s, not the expected %s", params.ExpectedAddress, address, params.ExpectedAddress.Address))
+		}
+		common.Logger.Infof("recovered root keys match the expected %s", params.ExpectedAddress)
+	}
+	return nil
+}
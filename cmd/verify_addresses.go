@@ -0,0 +1,263 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/alecthomas/gometalinter/_linters/src/gopkg.in/yaml.v2"
+
+	"recovery-tool/common"
+	"recovery-tool/common/code"
+)
+
+// address check results
+const (
+	AddressPass = "pass"
+	AddressFail = "fail"
+)
+
+// AddressCheck is the result of an expected address, it never holds the private key
+type AddressCheck struct {
+	ExpectedAddress `yaml:",inline"`
+	Derived         string `yaml:"derived_address,omitempty"`
+	Result          string `yaml:"result"` // pass or fail
+	Error           string `yaml:"error,omitempty"`
+}
+
+// VerifyReport is the result of the verify_addresses mode
+type VerifyReport struct {
+	Backups   []*BackupMatch  `yaml:"backups"`
+	Addresses []*AddressCheck `yaml:"addresses"`
+	Passed    int             `yaml:"passed"`
+	Failed    int             `yaml:"failed"`
+}
+
+func (params *RecoveryInput) verifying() bool {
+	return len(params.VerifyAddresses) > 0
+}
+
+func checkVerifyParams(params *RecoveryInput) (err error) {
+	if params.Discover {
+		return code.NewI18nError(code.ParamErr, "verify_addresses cannot be used with discover")
+	}
+
+	params.expectedAddresses, err = loadExpectedAddresses(params.VerifyAddresses)
+	if err != nil {
+		return err
+	}
+	if len(params.expectedAddresses) == 0 {
+		return code.NewI18nError(code.ParamErr, fmt.Sprintf("no address in %s", params.VerifyAddresses))
+	}
+	for i, expected := range params.expectedAddresses {
+		if err = expected.check(); err != nil {
+			i18nErr := asI18nError(err)
+			return code.NewI18nError(i18nErr.Code, fmt.Sprintf("row %d of %s: %s", i+1, params.VerifyAddresses, i18nErr.Msg))
+		}
+	}
+	return nil
+}
+
+// loadExpectedAddresses reads a JSON array of ExpectedAddress, or a CSV with a header row.
+// The columns (or the JSON fields) are wallet_type (optional), vault (or vault_index), chain, address_index (optional) and address.
+func loadExpectedAddresses(path string) ([]*ExpectedAddress, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, code.NewI18nError(code.FileNotFound, fmt.Sprintf("read expected addresses failed: %s", err))
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return loadExpectedAddressesJson(path, data)
+	}
+
+	reader := csv.NewReader(strings.NewReader(string(data)))
+	reader.TrimLeadingSpace = true
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, code.NewI18nError(code.FileFormatErr, fmt.Sprintf("read expected addresses csv failed: %s", err))
+	}
+	if len(rows) == 0 {
+		return nil, code.NewI18nError(code.FileFormatErr, "expected addresses csv has no header")
+	}
+
+	columns := make(map[string]int)
+	for i, name := range rows[0] {
+		columns[expectedColumn(name)] = i
+	}
+	for _, name := range []string{"chain", "address"} {
+		if _, ok := columns[name]; !ok {
+			return nil, code.NewI18nError(code.FileFormatErr, fmt.Sprintf("expected addresses csv has no %s column", name))
+		}
+	}
+
+	addresses := make([]*ExpectedAddress, 0, len(rows)-1)
+	for i, row := range rows[1:] {
+		field := func(name string) string {
+			if index, ok := columns[name]; ok {
+				return strings.TrimSpace(row[index])
+			}
+			return ""
+		}
+		number := func(name string) (int, error) {
+			if value := field(name); value != "" {
+				n, err := strconv.Atoi(value)
+				if err != nil {
+					return 0, code.NewI18nError(code.FileFormatErr, fmt.Sprintf("row %d of %s: invalid %s: %s", i+1, path, name, value))
+				}
+				return n, nil
+			}
+			return 0, nil
+		}
+
+		expected := &ExpectedAddress{WalletType: field("wallet_type"), Chain: field("chain"), Address: field("address")}
+		if expected.VaultIndex, err = number("vault_index"); err != nil {
+			return nil, err
+		}
+		if expected.AddressIndex, err = number("address_index"); err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, expected)
+	}
+	return addresses, nil
+}
+
+// loadExpectedAddressesJson reads the JSON array, the field names are matched like the CSV columns
+func loadExpectedAddressesJson(path string, data []byte) ([]*ExpectedAddress, error) {
+	rows := make([]map[string]json.RawMessage, 0)
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return nil, code.NewI18nError(code.FileFormatErr, fmt.Sprintf("unmarshal expected addresses failed: %s", err))
+	}
+
+	addresses := make([]*ExpectedAddress, 0, len(rows))
+	for i, row := range rows {
+		fields := make(map[string]json.RawMessage, len(row))
+		for name, value := range row {
+			column := expectedColumn(name)
+			if _, ok := fields[column]; ok {
+				return nil, code.NewI18nError(code.FileFormatErr, fmt.Sprintf("row %d of %s: duplicate %s", i+1, path, column))
+			}
+			fields[column] = value
+		}
+		// the map of raw values marshals without error
+		normalized, _ := json.Marshal(fields)
+
+		expected := &ExpectedAddress{}
+		if err := json.Unmarshal(normalized, expected); err != nil {
+			return nil, code.NewI18nError(code.FileFormatErr, fmt.Sprintf("row %d of %s: %s", i+1, path, err))
+		}
+		addresses = append(addresses, expected)
+	}
+	return addresses, nil
+}
+
+// expectedColumn returns the field of ExpectedAddress named by a CSV column or a JSON field, vault is short for vault_index
+func expectedColumn(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "vault" {
+		return "vault_index"
+	}
+	return name
+}
+
+// VerifyAddressesWithContext derives the keys of the expected addresses in params.VerifyAddresses,
+// and reports whether each derived address matches. The private keys are dropped right after deriving.
+func VerifyAddressesWithContext(ctx context.Context, params RecoveryInput) (*VerifyReport, error) {
+	if !params.verifying() {
+		return nil, code.NewI18nError(code.ParamErr, "verify_addresses cannot be empty")
+	}
+	if err := checkParams(&params); err != nil {
+		return nil, err
+	}
+
+	rootKeys, backups, err := recoverRootKeys(&params)
+	if err != nil {
+		return nil, err
+	}
+	defer rootKeys.Wipe()
+
+	report := &VerifyReport{Backups: backups, Addresses: make([]*AddressCheck, len(params.expectedAddresses))}
+
+	rowCh := make(chan int)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < params.Parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for row := range rowCh {
+				report.Addresses[row] = verifyAddress(ctx, params.expectedAddresses[row], rootKeys)
+			}
+		}()
+	}
+	for row := range params.expectedAddresses {
+		rowCh <- row
+	}
+	close(rowCh)
+	wg.Wait()
+
+	for _, check := range report.Addresses {
+		if check.Result == AddressPass {
+			report.Passed++
+		} else {
+			report.Failed++
+			common.Logger.Errorf("verify %s failed: %s", &check.ExpectedAddress, check.reason())
+		}
+	}
+	common.Logger.Infof("%d of %d addresses match the recovered keys", report.Passed, len(report.Addresses))
+	return report, nil
+}
+
+func verifyAddress(ctx context.Context, expected *ExpectedAddress, rootKeys *common.RootKeys) *AddressCheck {
+	check := &AddressCheck{ExpectedAddress: *expected, Result: AddressFail}
+	if err := ctx.Err(); err != nil {
+		check.Error = err.Error()
+		return check
+	}
+
+	derived, ok, err := expected.verify(rootKeys)
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	check.Derived = derived
+	if ok {
+		check.Result = AddressPass
+	}
+	return check
+}
+
+func (c *AddressCheck) reason() string {
+	if len(c.Error) > 0 {
+		return c.Error
+	}
+	return fmt.Sprintf("derived %s, expected %s", c.Derived, c.Address)
+}
+
+// verifyAddressesCmd writes the report, and fails if any address does not match
+func verifyAddressesCmd(ctx context.Context, params RecoveryInput, outputPath string) error {
+	report, err := VerifyAddressesWithContext(ctx, params)
+	if err != nil {
+		common.Logger.Errorf("verify addresses failed")
+		return err
+	}
+
+	yamlData, err := yaml.Marshal(report)
+	if err != nil {
+		common.Logger.Errorf("yaml marshal report failed: %s", err)
+		return err
+	}
+	// the report lists the addresses of the custody, like the recovery output
+	if err = writePrivateFile(outputPath, yamlData); err != nil {
+		return err
+	}
+
+	if report.Failed > 0 {
+		return code.NewI18nError(code.AddressMismatchErr, fmt.Sprintf("%d of %d addresses do not match, see %s", report.Failed, len(report.Addresses), outputPath))
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"recovery-tool/common"
+	"recovery-tool/common/code"
+)
+
+func writeTestFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestLoadExpectedAddresses(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		content  string
+		expected []*ExpectedAddress
+		errCode  string
+	}{
+		{
+			name: "csv",
+			file: "addresses.csv",
+			content: "wallet_type,vault_index,chain,address_index,address\n" +
+				"asset,1,Ethereum,0,0xA209798360bAbfe34EE6426c5877D08c9301376B\n" +
+				" api, ,Bitcoin, 2, 1KqwEg4wKkvMhBRwxqRpdHreJstDp4r5zS\n",
+			expected: []*ExpectedAddress{
+				{WalletType: AssetWallet, VaultIndex: 1, Chain: common.EthereumChain, Address: "0xA209798360bAbfe34EE6426c5877D08c9301376B"},
+				{WalletType: ApiWallet, Chain: common.BitcoinChain, AddressIndex: 2, Address: "1KqwEg4wKkvMhBRwxqRpdHreJstDp4r5zS"},
+			},
+		},
+		{
+			name:    "csv with the vault column and without the optional ones",
+			file:    "addresses.csv",
+			content: "Address,Chain,Vault\n1KqwEg4wKkvMhBRwxqRpdHreJstDp4r5zS,Bitcoin,3\n",
+			expected: []*ExpectedAddress{
+				{VaultIndex: 3, Chain: common.BitcoinChain, Address: "1KqwEg4wKkvMhBRwxqRpdHreJstDp4r5zS"},
+			},
+		},
+		{
+			name:     "csv header only",
+			file:     "addresses.csv",
+			content:  "vault,chain,address\n",
+			expected: []*ExpectedAddress{},
+		},
+		{
+			name:    "json",
+			file:    "addresses.JSON",
+			content: `[{"vault_index":2,"chain":"Solana","address_index":1,"address":"abc"},{"wallet_type":"api","chain":"Bitcoin","address":"def"}]`,
+			expected: []*ExpectedAddress{
+				{VaultIndex: 2, Chain: common.SolanaChain, AddressIndex: 1, Address: "abc"},
+				{WalletType: ApiWallet, Chain: common.BitcoinChain, Address: "def"},
+			},
+		},
+		{
+			name:    "json with the vault field",
+			file:    "addresses.json",
+			content: `[{"Vault":3,"chain":"Bitcoin","address":"abc"}]`,
+			expected: []*ExpectedAddress{
+				{VaultIndex: 3, Chain: common.BitcoinChain, Address: "abc"},
+			},
+		},
+		{name: "invalid json", file: "addresses.json", content: `{"chain":"Bitcoin"}`, errCode: code.FileFormatErr},
+		{name: "invalid json vault", file: "addresses.json", content: `[{"vault":"one","chain":"Bitcoin","address":"abc"}]`, errCode: code.FileFormatErr},
+		{name: "duplicate json vault", file: "addresses.json", content: `[{"vault":1,"vault_index":2,"chain":"Bitcoin","address":"abc"}]`, errCode: code.FileFormatErr},
+		{name: "empty csv", file: "addresses.csv", content: "", errCode: code.FileFormatErr},
+		{name: "no address column", file: "addresses.csv", content: "vault,chain\n1,Bitcoin\n", errCode: code.FileFormatErr},
+		{name: "no chain column", file: "addresses.csv", content: "vault,address\n1,abc\n", errCode: code.FileFormatErr},
+		{name: "invalid vault", file: "addresses.csv", content: "vault,chain,address\none,Bitcoin,abc\n", errCode: code.FileFormatErr},
+		{name: "invalid address index", file: "addresses.csv", content: "vault,chain,address_index,address\n1,Bitcoin,-,abc\n", errCode: code.FileFormatErr},
+		{name: "ragged csv", file: "addresses.csv", content: "vault,chain,address\n1,Bitcoin\n", errCode: code.FileFormatErr},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			addresses, err := loadExpectedAddresses(writeTestFile(t, test.file, test.content))
+			if test.errCode != "" {
+				assert.Equal(t, test.errCode, asI18nError(err).Code)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, addresses)
+		})
+	}
+
+	_, err := loadExpectedAddresses(filepath.Join(t.TempDir(), "missing.csv"))
+	assert.Equal(t, code.FileNotFound, asI18nError(err).Code)
+}
+
+func TestCheckVerifyParams(t *testing.T) {
+	path := writeTestFile(t, "addresses.csv", "vault,chain,address\n1,Bitcoin,abc\n0,Bitcoin,def\n")
+	err := checkVerifyParams(&RecoveryInput{VerifyAddresses: path})
+	i18nErr := asI18nError(err)
+	assert.Equal(t, code.VaultIndexParamErr, i18nErr.Code)
+	assert.True(t, strings.HasPrefix(i18nErr.Msg, "row 2 of "+path+": "), i18nErr.Msg)
+
+	params := &RecoveryInput{VerifyAddresses: writeTestFile(t, "addresses.csv", "vault,chain,address\n1,Bitcoin,abc\n")}
+	assert.NoError(t, checkVerifyParams(params))
+	assert.Equal(t, AssetWallet, params.expectedAddresses[0].WalletType)
+
+	err = checkVerifyParams(&RecoveryInput{VerifyAddresses: writeTestFile(t, "addresses.csv", "vault,chain,address\n")})
+	assert.Equal(t, code.ParamErr, asI18nError(err).Code)
+	err = checkVerifyParams(&RecoveryInput{VerifyAddresses: path, Discover: true})
+	assert.Equal(t, code.ParamErr, asI18nError(err).Code)
+}
+
+func TestVerifyAddressesCmd(t *testing.T) {
+	params := loadTestParams(t)
+	params.VerifyAddresses = writeTestFile(t, "addresses.csv", "vault,chain,address\n"+
+		"1,Bitcoin,1KqwEg4wKkvMhBRwxqRpdHreJstDp4r5zS\n2,Bitcoin,1KqwEg4wKkvMhBRwxqRpdHreJstDp4r5zS\n")
+	outputPath := filepath.Join(t.TempDir(), "report.yaml")
+	err := verifyAddressesCmd(context.Background(), params, outputPath)
+	assert.Equal(t, code.AddressMismatchErr, asI18nError(err).Code)
+
+	data, err := os.ReadFile(outputPath)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "passed: 1\nfailed: 1\n")
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(outputPath)
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+}
+
+func TestAsI18nError(t *testing.T) {
+	assert.Equal(t, &code.I18nError{Code: code.SystemErr, Msg: "plain"}, asI18nError(errors.New("plain")))
+	err := code.NewI18nError(code.ParamErr, "param")
+	assert.Equal(t, err, asI18nError(err))
+}
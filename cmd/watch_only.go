@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/alecthomas/gometalinter/_linters/src/gopkg.in/yaml.v2"
+
+	"recovery-tool/common"
+	"recovery-tool/common/code"
+)
+
+// ExportWatchOnlyCmd recovers the root keys, and writes their public keys and chain codes only.
+// The chains and vaults of the params are not needed.
+func ExportWatchOnlyCmd(paramsPath, outputPath string) error {
+	params, err := loadRecoveryParams(paramsPath)
+	if err != nil {
+		return err
+	}
+
+	bundle, err := ExportWatchOnly(params)
+	if err != nil {
+		common.Logger.Errorf("export watch-only bundle failed")
+		return err
+	}
+
+	yamlData, err := yaml.Marshal(bundle)
+	if err != nil {
+		common.Logger.Errorf("yaml marshal bundle failed: %s", err)
+		return err
+	}
+	// the chain codes and the public keys reveal all the addresses and the balances
+	return writePrivateFile(outputPath, yamlData)
+}
+
+func ExportWatchOnly(params RecoveryInput) (*common.WatchOnlyBundle, error) {
+	params.rootKeysOnly = true
+	if err := checkParams(&params); err != nil {
+		return nil, err
+	}
+
+	rootKeys, _, err := recoverRootKeys(&params)
+	if err != nil {
+		return nil, err
+	}
+	defer rootKeys.Wipe()
+	return rootKeys.WatchOnly(), nil
+}
+
+// DeriveAddressCmd prints the address of the watch-only bundle, vaultIndex starts from 1 and is ignored by api wallets
+func DeriveAddressCmd(bundlePath, walletType string, vaultIndex int, chainName string, addressIndex int) error {
+	data, err := ioutil.ReadFile(bundlePath)
+	if err != nil {
+		return code.NewI18nError(code.FileNotFound, fmt.Sprintf("read watch-only bundle failed: %s", err))
+	}
+	bundle := &common.WatchOnlyBundle{}
+	if err = yaml.UnmarshalStrict(data, bundle); err != nil {
+		return code.NewI18nError(code.FileFormatErr, fmt.Sprintf("unmarshal watch-only bundle failed: %s", err))
+	}
+
+	child, err := DeriveWatchOnlyAddress(bundle, walletType, vaultIndex, chainName, addressIndex)
+	if err != nil {
+		return err
+	}
+
+	yamlData, err := yaml.Marshal(child)
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(yamlData))
+	return nil
+}
+
+// DeriveWatchOnlyAddress derives an address and its public key from the public data of the bundle
+func DeriveWatchOnlyAddress(bundle *common.WatchOnlyBundle, walletType string, vaultIndex int, chainName string, addressIndex int) (*DeriveResult, error) {
+	target := &ExpectedAddress{WalletType: walletType, VaultIndex: vaultIndex, Chain: chainName, AddressIndex: addressIndex}
+	if err := target.checkPath("address"); err != nil {
+		return nil, err
+	}
+
+	coinType := int(common.ChainInfos[chainName].CoinType)
+	address, pubKey, err := bundle.DeriveAddress(childPath(target.WalletType, target.VaultIndex, coinType, addressIndex), coinType)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DeriveResult{
+		WalletType:   target.WalletType,
+		VaultIndex:   target.VaultIndex,
+		Chain:        chainName,
+		AddressIndex: addressIndex,
+		Address:      address,
+		PubKey:       hex.EncodeToString(pubKey),
+	}, nil
+}
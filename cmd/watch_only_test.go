@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/alecthomas/gometalinter/_linters/src/gopkg.in/yaml.v2"
+	"github.com/stretchr/testify/assert"
+
+	"recovery-tool/common"
+	"recovery-tool/common/code"
+)
+
+func TestDeriveWatchOnlyAddress(t *testing.T) {
+	rootKeys := newTestRootKeys()
+	bundle := rootKeys.WatchOnly()
+
+	for _, chain := range []string{common.BitcoinChain, common.EthereumChain, common.SolanaChain} {
+		child, err := DeriveWatchOnlyAddress(bundle, "", 2, chain, 1)
+		assert.NoError(t, err, chain)
+		expected, err := deriveChild(AssetWallet, 2, 1, chain, rootKeys, true)
+		assert.NoError(t, err, chain)
+		assert.Equal(t, AssetWallet, child.WalletType)
+		assert.Equal(t, expected.Address, child.Address, chain)
+		assert.Equal(t, expected.PubKey, child.PubKey, chain)
+		assert.Empty(t, child.PrivKey)
+	}
+
+	// the vault of an api wallet is ignored
+	child, err := DeriveWatchOnlyAddress(bundle, ApiWallet, 5, common.BitcoinChain, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, child.VaultIndex)
+	assert.Equal(t, testAddress(t, rootKeys, ApiWallet, 0, 0), child.Address)
+
+	tests := []struct {
+		name         string
+		walletType   string
+		vaultIndex   int
+		chain        string
+		addressIndex int
+		errCode      string
+	}{
+		{name: "wallet type", walletType: "vault", vaultIndex: 1, chain: common.BitcoinChain, errCode: code.WalletTypeErr},
+		{name: "vault", walletType: AssetWallet, vaultIndex: 0, chain: common.BitcoinChain, errCode: code.VaultIndexParamErr},
+		{name: "default wallet vault", vaultIndex: -1, chain: common.BitcoinChain, errCode: code.VaultIndexParamErr},
+		{name: "chain", vaultIndex: 1, chain: "Bitcoin SV", errCode: code.ChainParamErr},
+		{name: "address index", walletType: ApiWallet, chain: common.BitcoinChain, addressIndex: -1, errCode: code.AddressIndexParamErr},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := DeriveWatchOnlyAddress(bundle, test.walletType, test.vaultIndex, test.chain, test.addressIndex)
+			i18nErr := asI18nError(err)
+			assert.Equal(t, test.errCode, i18nErr.Code)
+			assert.Contains(t, i18nErr.Msg, "of address")
+		})
+	}
+
+	_, err = DeriveWatchOnlyAddress(&common.WatchOnlyBundle{}, AssetWallet, 1, common.BitcoinChain, 0)
+	assert.Equal(t, code.FailedToParseDataErr, asI18nError(err).Code)
+}
+
+func TestDeriveAddressCmd(t *testing.T) {
+	data, err := yaml.Marshal(newTestRootKeys().WatchOnly())
+	assert.NoError(t, err)
+	path := writeTestFile(t, "watch_only.yaml", string(data))
+
+	assert.NoError(t, DeriveAddressCmd(path, AssetWallet, 1, common.BitcoinChain, 0))
+	err = DeriveAddressCmd(path, AssetWallet, 0, common.BitcoinChain, 0)
+	assert.Equal(t, code.VaultIndexParamErr, asI18nError(err).Code)
+
+	err = DeriveAddressCmd(path+".missing", AssetWallet, 1, common.BitcoinChain, 0)
+	assert.Equal(t, code.FileNotFound, asI18nError(err).Code)
+	err = DeriveAddressCmd(writeTestFile(t, "watch_only.yaml", "shares: []\nunknown: 1\n"), AssetWallet, 1, common.BitcoinChain, 0)
+	assert.Equal(t, code.FileFormatErr, asI18nError(err).Code)
+}
+
+func TestExportWatchOnlyCmd(t *testing.T) {
+	data, err := yaml.Marshal(loadTestParams(t))
+	assert.NoError(t, err)
+	outputPath := filepath.Join(t.TempDir(), "watch_only.yaml")
+	assert.NoError(t, ExportWatchOnlyCmd(writeTestFile(t, "input.yaml", string(data)), outputPath))
+
+	data, err = os.ReadFile(outputPath)
+	assert.NoError(t, err)
+	bundle := &common.WatchOnlyBundle{}
+	assert.NoError(t, yaml.UnmarshalStrict(data, bundle))
+	assert.NotEmpty(t, bundle.Shares)
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(outputPath)
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+}
+
+func TestCheckExpectedAddress(t *testing.T) {
+	err := checkExpectedKeys(&RecoveryInput{ExpectedAddress: &ExpectedAddress{VaultIndex: 1, Chain: "Bitcoin SV", Address: "abc"}})
+	i18nErr := asI18nError(err)
+	assert.Equal(t, code.ChainParamErr, i18nErr.Code)
+	assert.Equal(t, "unsupported chain of expected address: Bitcoin SV", i18nErr.Msg)
+
+	err = checkExpectedKeys(&RecoveryInput{ExpectedAddress: &ExpectedAddress{VaultIndex: 1, Chain: common.BitcoinChain}})
+	assert.Equal(t, code.ParamErr, asI18nError(err).Code)
+
+	expected := &ExpectedAddress{WalletType: ApiWallet, VaultIndex: 3, Chain: common.BitcoinChain, Address: "abc"}
+	assert.NoError(t, checkExpectedKeys(&RecoveryInput{ExpectedAddress: expected}))
+	assert.Equal(t, 0, expected.VaultIndex)
+}
@@ -27,6 +27,19 @@ var (
 	VaultIndexParamErr        = "516"
 	RSAKeyNotEmpty            = "517"
 	FailedToParseDataErr      = "518"
+	WalletTypeErr             = "519"
+	AddressCountErr           = "520"
+	AddressIndexParamErr      = "521"
+	PartialRecoveryErr        = "522" //部分链恢复失败
+	CoinTypeParamErr          = "523"
+	BackupVersionErr          = "524" //备份数据版本不支持
+	RootKeyMismatchErr        = "525" //恢复的密钥与团队公钥不匹配
+	AddressMismatchErr        = "526" //地址与恢复的密钥不匹配
+	DecryptOutputErr          = "527" //解密输出文件失败
+	KeyFormatErr              = "528" //不支持的私钥格式
+	KeyPasswordErr            = "529" //私钥密码错误或缺失
+	KeyTypeErr                = "530" //私钥类型或曲线不符
+	KeyShareErr               = "531" //私钥分片无效或不足
 
 	PrivkeyInvalid         = "601"
 	DstAddrNotEmpty        = "602"
@@ -60,7 +73,7 @@ var I18nMessage = map[string]map[string]string{
 		EciesDecryptBackupDataErr: "ECIES descryption of backup data failed.",
 		DeriveChildPrivErr:        "Child private key derivation failed.",
 		DeriveChildAddressErr:     "Address derivation failed.",
-		MnemonicNot24Words:        "Mnemonic must be 24 words.",
+		MnemonicNot24Words:        "Mnemonic must be 12, 15, 18, 21 or 24 words.",
 		ChainNameNotEmpty:         "Chain name should not be empty.",
 		VaultCountErr:             "Wallet quantity must be greater or equal than 1.",
 		ChainParamErr:             "Chain parameter error",
@@ -69,6 +82,19 @@ var I18nMessage = map[string]map[string]string{
 		FileFormatErr:             "File format error.",
 		VaultIndexParamErr:        "Vault index param error.",
 		FailedToParseDataErr:      "Failed to parse backup data.",
+		WalletTypeErr:             "Wallet type must be asset, api or all.",
+		AddressCountErr:           "Address quantity must be greater or equal than 1.",
+		AddressIndexParamErr:      "Address index param error.",
+		PartialRecoveryErr:        "Some chains failed to recover, see the errors in the result.",
+		CoinTypeParamErr:          "Coin type param error.",
+		BackupVersionErr:          "Unsupported backup data version, please upgrade the tool.",
+		RootKeyMismatchErr:        "The recovered keys do not match the team public key, please check the backup and the mnemonic.",
+		AddressMismatchErr:        "Some addresses do not match the recovered keys, see the report.",
+		DecryptOutputErr:          "Failed to decrypt the output file, please check the passphrase or the key.",
+		KeyFormatErr:              "Unsupported private key format, use PKCS#8, PKCS#1, SEC1, JWK or hex.",
+		KeyPasswordErr:            "The private key is encrypted, the password is wrong or missing.",
+		KeyTypeErr:                "The private key is not of the expected type or curve.",
+		KeyShareErr:               "The key shares are invalid or not enough to reconstruct the key.",
 
 		PrivkeyInvalid:         "The private key format is wrong, please re-enter.",
 		DstAddrNotEmpty:        "The target address cannot be empty, please re-enter.",
@@ -100,7 +126,7 @@ var I18nMessage = map[string]map[string]string{
 		EciesDecryptBackupDataErr: "ECIES解密备份数据失败",
 		DeriveChildPrivErr:        "子私钥推导失败",
 		DeriveChildAddressErr:     "地址推导失败",
-		MnemonicNot24Words:        "助记词必须为24个单词",
+		MnemonicNot24Words:        "助记词必须为12、15、18、21或24个单词",
 		ChainNameNotEmpty:         "链名不能为空",
 		VaultCountErr:             "钱包数量必须大于等于1",
 		ChainParamErr:             "链 参数错误",
@@ -109,6 +135,19 @@ var I18nMessage = map[string]map[string]string{
 		FileFormatErr:             "文件格式错误",
 		VaultIndexParamErr:        "钱包数量 参数错误",
 		FailedToParseDataErr:      "解析备份数据失败",
+		WalletTypeErr:             "钱包类型必须为 asset、api 或 all",
+		AddressCountErr:           "地址数量必须大于等于1",
+		AddressIndexParamErr:      "地址索引 参数错误",
+		PartialRecoveryErr:        "部分链恢复失败，请查看结果中的错误",
+		CoinTypeParamErr:          "币种类型 参数错误",
+		BackupVersionErr:          "不支持的备份数据版本，请升级工具",
+		RootKeyMismatchErr:        "恢复的密钥与团队公钥不匹配，请检查备份与助记词",
+		AddressMismatchErr:        "部分地址与恢复的密钥不匹配，请查看报告",
+		DecryptOutputErr:          "解密输出文件失败，请检查密码或密钥",
+		KeyFormatErr:              "不支持的私钥格式，请使用 PKCS#8、PKCS#1、SEC1、JWK 或十六进制",
+		KeyPasswordErr:            "私钥已加密，密码错误或缺失",
+		KeyTypeErr:                "私钥类型或曲线不符",
+		KeyShareErr:               "私钥分片无效或数量不足，无法重建私钥",
 
 		PrivkeyInvalid:         "私钥格式错误，请重新填写",
 		DstAddrNotEmpty:        "目标地址不能为空，请重新填写",
@@ -1,7 +1,7 @@
 package common
 
 import (
-	"crypto/ecdsa"
+	"crypto/elliptic"
 	"fmt"
 	"math/big"
 	"recovery-tool/common/code"
@@ -11,6 +11,7 @@ import (
 
 	"recovery-tool/crypto"
 	"recovery-tool/crypto/ckd"
+	"recovery-tool/crypto/secure"
 )
 
 type RecoveryData struct {
@@ -19,11 +20,12 @@ type RecoveryData struct {
 	UserPubKey    string
 }
 
+// RootKeys are the shares of a team, the child private key is the sum of the child keys of the shares
 type RootKeys struct {
-	HbcShare0   *RootKey
-	HbcShare1   *RootKey
-	UsrShare    *RootKey
+	Shares      []*RootKey // the hbc shares followed by the user share
 	EddsaPubKey *crypto.ECPoint
+
+	cache *deriveCache
 }
 
 type RootKey struct {
@@ -33,6 +35,37 @@ type RootKey struct {
 	ChainCode   []byte
 }
 
+// sign kinds of the coins
+const (
+	EcdsaSign = "ecdsa"
+	EddsaSign = "eddsa"
+)
+
+// derivePrefixDepth is the depth of the prefix shared by the paths of a vault, i.e. 81/0/<vault>
+const derivePrefixDepth = 3
+
+type deriveCache struct {
+	ecdsa map[*RootKey]*ckd.KeyCache
+	eddsa map[*RootKey]*ckd.KeyCacheD
+}
+
+// EnableCache makes DerivePrivKey reuse the nodes of the prefixes shared between paths instead
+// of deriving every path from the root keys. It must be called before params is used concurrently.
+func (params *RootKeys) EnableCache() {
+	cache := &deriveCache{
+		ecdsa: make(map[*RootKey]*ckd.KeyCache),
+		eddsa: make(map[*RootKey]*ckd.KeyCacheD),
+	}
+	for _, key := range params.Shares {
+		privKeyBytes := key.PrivKey.FillBytes(make([]byte, 32))
+		ecdsaRoot := ckd.NewExtendKey(privKeyBytes, key.EcdsaPubKey, key.EcdsaPubKey, 0, 0, key.ChainCode)
+		eddsaRoot := ckd.NewExtendKeyD(privKeyBytes, key.EddsaPubKey, params.EddsaPubKey, 0, 0, key.ChainCode)
+		cache.ecdsa[key] = ckd.NewKeyCache(ecdsaRoot, derivePrefixDepth)
+		cache.eddsa[key] = ckd.NewKeyCacheD(eddsaRoot, edwards.Edwards(), derivePrefixDepth)
+	}
+	params.cache = cache
+}
+
 func DeriveChild(params *RootKeys, hdPath string, coin int) (*big.Int, string, error) {
 	privKey, err := DerivePrivKey(params, hdPath, coin)
 	if err != nil {
@@ -47,52 +80,101 @@ func DeriveChild(params *RootKeys, hdPath string, coin int) (*big.Int, string, e
 	return privKey, address, nil
 }
 
-func DerivePrivKey(params *RootKeys, hdPath string, coin int) (*big.Int, error) {
-	hbcPrivKey0, n, err := deriveChildPrivKey(params.HbcShare0, hdPath, params.EddsaPubKey, coin)
-	if err != nil {
-		Logger.Errorf("deriveChildPrivKey 0 err: %s", err)
-		return nil, err
+// DeriveRawChild derives the child key of a coin without address encoder, signKind is EcdsaSign or EddsaSign.
+// The public key is compressed secp256k1 for ecdsa, and ed25519 for eddsa.
+func DeriveRawChild(params *RootKeys, hdPath string, signKind string) (*big.Int, []byte, error) {
+	if signKind != EcdsaSign && signKind != EddsaSign {
+		return nil, nil, code.NewI18nError(code.DeriveChildPrivErr, fmt.Sprintf("unsupported sign kind: %s", signKind))
 	}
+	eddsa := signKind == EddsaSign
 
-	hbcPrivKey1, _, err := deriveChildPrivKey(params.HbcShare1, hdPath, params.EddsaPubKey, coin)
+	privKey, err := derivePrivKey(params, hdPath, eddsa)
 	if err != nil {
-		Logger.Errorf("deriveChildPrivKey 1 err: %s", err)
-		return nil, err
+		return nil, nil, code.NewI18nError(code.DeriveChildPrivErr, err.Error())
 	}
 
-	userPrivKey, _, err := deriveChildPrivKey(params.UsrShare, hdPath, params.EddsaPubKey, coin)
-	if err != nil {
-		Logger.Errorf("deriveChildPrivKey 2 err: %s", err)
-		return nil, err
+	return privKey, pubKeyBytes(privKey, eddsa), nil
+}
+
+// PubKeyBytes returns the public key of a child private key of coin, compressed secp256k1 or ed25519
+func PubKeyBytes(privKey *big.Int, coin int) []byte {
+	return pubKeyBytes(privKey, isEddsaCoin(coin))
+}
+
+func pubKeyBytes(privKey *big.Int, eddsa bool) []byte {
+	if eddsa {
+		pubECPoint := crypto.ScalarBaseMult(edwards.Edwards(), privKey)
+		return edwards.NewPublicKey(pubECPoint.X(), pubECPoint.Y()).Serialize()
 	}
+	pubECPoint := crypto.ScalarBaseMult(btcec.S256(), privKey)
+	return elliptic.MarshalCompressed(btcec.S256(), pubECPoint.X(), pubECPoint.Y())
+}
 
-	privateKey := new(big.Int).SetBytes(hbcPrivKey0.Bytes())
+// Wipe zeroes the private keys and chain codes of the shares and the derive cache, params must not be used after it
+func (params *RootKeys) Wipe() {
+	if params.cache != nil {
+		for _, cache := range params.cache.ecdsa {
+			cache.Wipe()
+		}
+		for _, cache := range params.cache.eddsa {
+			cache.Wipe()
+		}
+		params.cache = nil
+	}
+	for _, key := range params.Shares {
+		secure.WipeBigInt(key.PrivKey)
+		secure.Wipe(key.ChainCode)
+	}
+}
 
-	privateKey.Add(privateKey, hbcPrivKey1)
-	privateKey.Mod(privateKey, n)
+func DerivePrivKey(params *RootKeys, hdPath string, coin int) (*big.Int, error) {
+	return derivePrivKey(params, hdPath, isEddsaCoin(coin))
+}
 
-	privateKey.Add(privateKey, userPrivKey)
-	privateKey.Mod(privateKey, n)
+func derivePrivKey(params *RootKeys, hdPath string, eddsa bool) (*big.Int, error) {
+	if len(params.Shares) == 0 {
+		return nil, fmt.Errorf("no share to derive")
+	}
 
+	privateKey := new(big.Int)
+	for i, key := range params.Shares {
+		sharePrivKey, n, err := deriveChildPrivKey(params, key, hdPath, eddsa)
+		if err != nil {
+			Logger.Errorf("deriveChildPrivKey %d err: %s", i, err)
+			return nil, err
+		}
+		privateKey.Add(privateKey, sharePrivKey)
+		privateKey.Mod(privateKey, n)
+		secure.WipeBigInt(sharePrivKey)
+	}
 	return privateKey, nil
 }
 
-func DeriveAddress(privKey *big.Int, hdPath string, coin int) (string, error) {
-	chain := SwitchCoin(uint32(coin))
+// RootPubKeys returns the public keys of the sum of the root shares,
+// compressed secp256k1 for ecdsa and ed25519 for eddsa.
+func (params *RootKeys) RootPubKeys() ([]byte, []byte) {
+	ecdsaPrivKey := new(big.Int)
+	eddsaPrivKey := new(big.Int)
+	for _, key := range params.Shares {
+		ecdsaPrivKey.Add(ecdsaPrivKey, key.PrivKey)
+		ecdsaPrivKey.Mod(ecdsaPrivKey, btcec.S256().N)
+		eddsaPrivKey.Add(eddsaPrivKey, key.PrivKey)
+		eddsaPrivKey.Mod(eddsaPrivKey, edwards.Edwards().N)
+	}
 
+	ecdsaPubKey := crypto.ScalarBaseMult(btcec.S256(), ecdsaPrivKey)
+	eddsaPubKey := crypto.ScalarBaseMult(edwards.Edwards(), eddsaPrivKey)
+	secure.WipeBigInt(ecdsaPrivKey)
+	secure.WipeBigInt(eddsaPrivKey)
+	return elliptic.MarshalCompressed(btcec.S256(), ecdsaPubKey.X(), ecdsaPubKey.Y()),
+		edwards.NewPublicKey(eddsaPubKey.X(), eddsaPubKey.Y()).Serialize()
+}
+
+func DeriveAddress(privKey *big.Int, hdPath string, coin int) (string, error) {
 	if isEddsaCoin(coin) {
-		pubECPoint := crypto.ScalarBaseMult(edwards.Edwards(), privKey)
-		publicKey := edwards.NewPublicKey(pubECPoint.X(), pubECPoint.Y())
-		return SwitchEddsaChainAddress(publicKey, chain)
-	} else {
-		pubECPoint := crypto.ScalarBaseMult(btcec.S256(), privKey)
-		publicKey := &ecdsa.PublicKey{
-			X:     pubECPoint.X(),
-			Y:     pubECPoint.Y(),
-			Curve: btcec.S256(),
-		}
-		return SwitchEcdsaChainAddress(publicKey, chain)
+		return PubKeyAddress(crypto.ScalarBaseMult(edwards.Edwards(), privKey), coin)
 	}
+	return PubKeyAddress(crypto.ScalarBaseMult(btcec.S256(), privKey), coin)
 }
 
 func SwitchCoin(coinType uint32) string {
@@ -134,23 +216,39 @@ func SwitchCoin(coinType uint32) string {
 	return chain
 }
 
-func deriveChildPrivKey(key *RootKey, hdPath string, deducePubKey *crypto.ECPoint, coin int) (*big.Int, *big.Int, error) {
-	var buf [32]byte
-	privKeyBytes := key.PrivKey.FillBytes(buf[:])
+func deriveChildPrivKey(params *RootKeys, key *RootKey, hdPath string, eddsa bool) (*big.Int, *big.Int, error) {
+	// the root share is only serialized without the cache, which holds its own copy
+	var privKeyBytes []byte
+	if params.cache == nil {
+		buf := secure.NewBuffer(32)
+		defer buf.Wipe()
+		privKeyBytes = key.PrivKey.FillBytes(buf.Bytes())
+	}
 
 	var childPrivateKeySlice [32]byte
+	defer secure.Wipe(childPrivateKeySlice[:])
 	var err error
 	var n *big.Int
 
-	if isEddsaCoin(coin) {
+	if eddsa {
 		n = edwards.Edwards().Params().N
-		childPrivateKeySlice, _, err = DeriveEddsaChildPrivKey(privKeyBytes, key.ChainCode, key.EddsaPubKey, deducePubKey, hdPath)
+		if params.cache != nil {
+			childPrivateKeySlice, _, err = params.cache.eddsa[key].DerivePrivateKeyForPathD(hdPath)
+		} else {
+			extendedKey := ckd.NewExtendKeyD(privKeyBytes, key.EddsaPubKey, params.EddsaPubKey, 0, 0, key.ChainCode)
+			childPrivateKeySlice, _, err = ckd.DerivePrivateKeyForPathD(extendedKey, hdPath, edwards.Edwards())
+		}
 	} else {
 		n = btcec.S256().Params().N
-		childPrivateKeySlice, _, err = DeriveEcdsaChildPrivKey(privKeyBytes, key.ChainCode, key.EcdsaPubKey, hdPath)
+		if params.cache != nil {
+			childPrivateKeySlice, _, err = params.cache.ecdsa[key].DerivePrivateKeyForPath(hdPath)
+		} else {
+			extendedKey := ckd.NewExtendKey(privKeyBytes, key.EcdsaPubKey, key.EcdsaPubKey, 0, 0, key.ChainCode)
+			childPrivateKeySlice, _, err = ckd.DerivePrivateKeyForPath(extendedKey, hdPath)
+		}
 	}
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, fmt.Errorf("derive child private err: %s", err.Error())
 	}
 
 	privateKey := new(big.Int).SetBytes(childPrivateKeySlice[:])
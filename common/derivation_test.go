@@ -0,0 +1,191 @@
+package common_test
+
+import (
+	"crypto/elliptic"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"recovery-tool/common"
+	"recovery-tool/crypto"
+)
+
+func newRootKey(privKey int64, chainCode byte) *common.RootKey {
+	priv := big.NewInt(privKey)
+	return &common.RootKey{
+		PrivKey:     priv,
+		EcdsaPubKey: crypto.ScalarBaseMult(crypto.S256(), priv),
+		EddsaPubKey: crypto.ScalarBaseMult(crypto.Edwards(), priv),
+		ChainCode:   []byte{chainCode, 31: chainCode},
+	}
+}
+
+func newRootKeys() *common.RootKeys {
+	return &common.RootKeys{
+		Shares:      []*common.RootKey{newRootKey(0x1234567, 1), newRootKey(0x2345678, 2), newRootKey(0x3456789, 3)},
+		EddsaPubKey: crypto.ScalarBaseMult(crypto.Edwards(), big.NewInt(0x1234567+0x2345678+0x3456789)),
+	}
+}
+
+func TestDeriveChildCache(t *testing.T) {
+	cached := newRootKeys()
+	cached.EnableCache()
+	uncached := newRootKeys()
+
+	for _, chain := range []string{common.EthereumChain, common.BitcoinChain, common.SolanaChain, common.AptostChain} {
+		coin := int(common.ChainInfos[chain].CoinType)
+		for vault := 0; vault < 2; vault++ {
+			for addressIndex := 0; addressIndex < 2; addressIndex++ {
+				hdPath := fmt.Sprintf("81/0/%d/%d/%d", vault, coin, addressIndex)
+				expectedKey, expectedAddress, err := common.DeriveChild(uncached, hdPath, coin)
+				assert.NoError(t, err)
+				privKey, address, err := common.DeriveChild(cached, hdPath, coin)
+				assert.NoError(t, err)
+				assert.Equal(t, expectedKey, privKey, hdPath)
+				assert.Equal(t, expectedAddress, address, hdPath)
+			}
+		}
+	}
+
+	// the same error with or without the cache
+	for _, coin := range []int{60, 501} {
+		_, uncachedErr := common.DerivePrivKey(uncached, "81/0/x/60/0", coin)
+		_, cachedErr := common.DerivePrivKey(cached, "81/0/x/60/0", coin)
+		assert.Error(t, uncachedErr)
+		assert.Equal(t, uncachedErr, cachedErr)
+		assert.Contains(t, uncachedErr.Error(), "derive child private err")
+	}
+}
+
+func TestDerivePrivKeyShares(t *testing.T) {
+	rootKeys := newRootKeys()
+	hdPath := "81/0/0/60/0"
+
+	expected := new(big.Int)
+	for _, share := range rootKeys.Shares {
+		single := &common.RootKeys{Shares: []*common.RootKey{share}, EddsaPubKey: rootKeys.EddsaPubKey}
+		privKey, err := common.DerivePrivKey(single, hdPath, 60)
+		assert.NoError(t, err)
+		expected.Add(expected, privKey)
+		expected.Mod(expected, crypto.S256().Params().N)
+	}
+
+	privKey, err := common.DerivePrivKey(rootKeys, hdPath, 60)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, privKey)
+
+	_, err = common.DerivePrivKey(&common.RootKeys{}, hdPath, 60)
+	assert.Error(t, err)
+}
+
+func TestDeriveRawChild(t *testing.T) {
+	rootKeys := newRootKeys()
+
+	expectedKey, _, err := common.DeriveChild(rootKeys, "81/0/0/60/0", 60)
+	assert.NoError(t, err)
+	privKey, pubKey, err := common.DeriveRawChild(rootKeys, "81/0/0/60/0", common.EcdsaSign)
+	assert.NoError(t, err)
+	assert.Equal(t, expectedKey, privKey)
+	assert.Len(t, pubKey, 33)
+
+	expectedKey, _, err = common.DeriveChild(rootKeys, "81/0/0/501/0", 501)
+	assert.NoError(t, err)
+	privKey, pubKey, err = common.DeriveRawChild(rootKeys, "81/0/0/501/0", common.EddsaSign)
+	assert.NoError(t, err)
+	assert.Equal(t, expectedKey, privKey)
+	assert.Len(t, pubKey, 32)
+
+	_, _, err = common.DeriveRawChild(rootKeys, "81/0/0/9000/0", "schnorr")
+	assert.Error(t, err)
+}
+
+func TestRootPubKeys(t *testing.T) {
+	rootKeys := newRootKeys()
+	sum := big.NewInt(0x1234567 + 0x2345678 + 0x3456789)
+
+	ecdsaPubKey, eddsaPubKey := rootKeys.RootPubKeys()
+	expected := crypto.ScalarBaseMult(crypto.S256(), sum)
+	assert.Equal(t, elliptic.MarshalCompressed(crypto.S256(), expected.X(), expected.Y()), ecdsaPubKey)
+	assert.Len(t, eddsaPubKey, 32)
+
+	// a corrupted share changes both keys
+	rootKeys.Shares[1] = newRootKey(0x2345679, 2)
+	corruptedEcdsa, corruptedEddsa := rootKeys.RootPubKeys()
+	assert.NotEqual(t, ecdsaPubKey, corruptedEcdsa)
+	assert.NotEqual(t, eddsaPubKey, corruptedEddsa)
+}
+
+func TestRootKeysWipe(t *testing.T) {
+	rootKeys := newRootKeys()
+	rootKeys.EnableCache()
+	_, _, err := common.DeriveChild(rootKeys, "81/0/0/60/0", 60)
+	assert.NoError(t, err)
+	_, _, err = common.DeriveChild(rootKeys, "81/0/0/501/0", 501)
+	assert.NoError(t, err)
+
+	var words [][]big.Word
+	for _, key := range rootKeys.Shares {
+		words = append(words, key.PrivKey.Bits())
+	}
+	rootKeys.Wipe()
+	for i, key := range rootKeys.Shares {
+		assert.Equal(t, 0, key.PrivKey.Sign())
+		for _, word := range words[i] {
+			assert.Zero(t, word)
+		}
+		assert.Equal(t, make([]byte, 32), key.ChainCode)
+	}
+}
+
+func TestWatchOnlyBundle(t *testing.T) {
+	rootKeys := newRootKeys()
+	bundle := rootKeys.WatchOnly()
+	assert.Len(t, bundle.Shares, len(rootKeys.Shares))
+
+	for _, chain := range []string{common.EthereumChain, common.BitcoinChain, common.SolanaChain, common.AptostChain} {
+		coin := int(common.ChainInfos[chain].CoinType)
+		for _, hdPath := range []string{fmt.Sprintf("81/0/0/%d/0", coin), fmt.Sprintf("81/0/7/%d/3", coin), fmt.Sprintf("81/1/0/%d/1", coin)} {
+			privKey, expectedAddress, err := common.DeriveChild(rootKeys, hdPath, coin)
+			assert.NoError(t, err)
+			address, pubKey, err := bundle.DeriveAddress(hdPath, coin)
+			assert.NoError(t, err, hdPath)
+			assert.Equal(t, expectedAddress, address, hdPath)
+			assert.Equal(t, common.PubKeyBytes(privKey, coin), pubKey, hdPath)
+		}
+	}
+
+	_, _, err := (&common.WatchOnlyBundle{}).DeriveAddress("81/0/0/60/0", 60)
+	assert.Error(t, err)
+}
+
+// BenchmarkDeriveChilds derives every chain for 1000 vaults per iteration,
+// run it with -benchtime=1x as the eddsa chains take minutes without the cache.
+func BenchmarkDeriveChilds(b *testing.B) {
+	const vaultCount = 1000
+
+	deriveAll := func(b *testing.B, rootKeys *common.RootKeys) {
+		for vault := 0; vault < vaultCount; vault++ {
+			for _, info := range common.ChainInfos {
+				coin := int(info.CoinType)
+				if _, _, err := common.DeriveChild(rootKeys, fmt.Sprintf("81/0/%d/%d/0", vault, coin), coin); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	}
+
+	b.Run("uncached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			deriveAll(b, newRootKeys())
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			rootKeys := newRootKeys()
+			rootKeys.EnableCache()
+			deriveAll(b, rootKeys)
+		}
+	})
+}
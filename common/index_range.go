@@ -0,0 +1,78 @@
+package common
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MaxIndex is the largest non-hardened BIP32 index
+	MaxIndex = 0x80000000 - 1
+
+	// maxIndexRangeSize limits how many indices one range expression can expand to
+	maxIndexRangeSize = 1000000
+)
+
+// ParseIndexRange parses a list of indices and ranges such as "1,5,10-20".
+// The result is sorted in ascending order without duplicates.
+func ParseIndexRange(expr string) ([]int, error) {
+	indexSet := make(map[int]struct{})
+
+	for _, part := range strings.Split(expr, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		var start, end int
+		var err error
+		if bounds := strings.SplitN(part, "-", 2); len(bounds) == 2 {
+			if start, err = parseIndex(bounds[0]); err != nil {
+				return nil, err
+			}
+			if end, err = parseIndex(bounds[1]); err != nil {
+				return nil, err
+			}
+			if start > end {
+				return nil, fmt.Errorf("invalid index range: %s", part)
+			}
+		} else {
+			if start, err = parseIndex(part); err != nil {
+				return nil, err
+			}
+			end = start
+		}
+
+		if len(indexSet)+end-start+1 > maxIndexRangeSize {
+			return nil, fmt.Errorf("too many indices, at most %d", maxIndexRangeSize)
+		}
+		for i := start; i <= end; i++ {
+			indexSet[i] = struct{}{}
+		}
+	}
+
+	if len(indexSet) == 0 {
+		return nil, fmt.Errorf("empty index range: %q", expr)
+	}
+
+	indices := make([]int, 0, len(indexSet))
+	for i := range indexSet {
+		indices = append(indices, i)
+	}
+	sort.Ints(indices)
+	return indices, nil
+}
+
+func parseIndex(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid index: %q", s)
+	}
+	if i < 0 || i > MaxIndex {
+		return 0, fmt.Errorf("index out of range: %d", i)
+	}
+	return i, nil
+}
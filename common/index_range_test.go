@@ -0,0 +1,24 @@
+package common_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"recovery-tool/common"
+)
+
+func TestParseIndexRange(t *testing.T) {
+	indices, err := common.ParseIndexRange("1,5,10-13")
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 5, 10, 11, 12, 13}, indices)
+
+	indices, err = common.ParseIndexRange(" 7 , 3-4, 4 ,7")
+	assert.NoError(t, err)
+	assert.Equal(t, []int{3, 4, 7}, indices)
+
+	for _, expr := range []string{"", ",", "a", "3-1", "-1", "1-", "2147483648", "0-2000000"} {
+		_, err = common.ParseIndexRange(expr)
+		assert.Error(t, err, expr)
+	}
+}
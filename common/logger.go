@@ -8,12 +8,44 @@ package common
 
 import (
 	"github.com/ipfs/go-log"
+	"go.uber.org/zap"
 )
 
-var Logger = log.Logger("recovery")
+// Logger redacts the key material in every message, see Redact
+var Logger = newSecretLogger("recovery")
 
 func init() {
 	if err := log.SetLogLevel("recovery", "info"); err != nil {
 		panic(err)
 	}
 }
+
+// SecretLogger formats the messages with Redact, the underlying logger is not reachable,
+// so no key material can be logged in full
+type SecretLogger struct {
+	logger *zap.SugaredLogger
+}
+
+func newSecretLogger(system string) *SecretLogger {
+	// skips the frame of SecretLogger, to log the location of the caller
+	logger := log.Logger(system).SugaredLogger.Desugar().WithOptions(zap.AddCallerSkip(1)).Sugar()
+	return &SecretLogger{logger: logger}
+}
+
+func (l *SecretLogger) Debugf(format string, args ...interface{}) {
+	if l.logger.Desugar().Core().Enabled(zap.DebugLevel) {
+		l.logger.Debug(Redact(format, args...))
+	}
+}
+
+func (l *SecretLogger) Infof(format string, args ...interface{}) {
+	l.logger.Info(Redact(format, args...))
+}
+
+func (l *SecretLogger) Warnf(format string, args ...interface{}) {
+	l.logger.Warn(Redact(format, args...))
+}
+
+func (l *SecretLogger) Errorf(format string, args ...interface{}) {
+	l.logger.Error(Redact(format, args...))
+}
@@ -4,14 +4,23 @@ import (
 	"fmt"
 
 	"recovery-tool/crypto/hdwallet"
+	"recovery-tool/crypto/secure"
 )
 
+// CalcMasterPriv calculates the master key of an English mnemonic without passphrase
 func CalcMasterPriv(menemonic string) (privKey, chainCode [32]byte, err error) {
-	seed, err := hdwallet.NewSeed(menemonic, "", hdwallet.English)
+	return CalcMasterPrivWithPassphrase(menemonic, "", hdwallet.English)
+}
+
+// CalcMasterPrivWithPassphrase calculates the master key of a mnemonic of language, with the optional BIP39 passphrase
+func CalcMasterPrivWithPassphrase(mnemonic, passphrase, language string) (privKey, chainCode [32]byte, err error) {
+	seed, err := hdwallet.NewSeed(mnemonic, passphrase, language)
 	if err != nil {
 		return privKey, chainCode, fmt.Errorf("create seed err: %s", err.Error())
 	}
+	seedBuf := secure.Copy(seed)
+	defer seedBuf.Wipe()
 
-	privKey, chainCode = hdwallet.ComputeMastersFromSeed(seed)
+	privKey, chainCode = hdwallet.ComputeMastersFromSeed(seedBuf.Bytes())
 	return privKey, chainCode, nil
 }
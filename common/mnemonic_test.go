@@ -2,11 +2,14 @@ package common_test
 
 import (
 	"encoding/hex"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/unicode/norm"
 
 	"recovery-tool/common"
+	"recovery-tool/crypto/hdwallet"
 )
 
 func TestMnemonic(t *testing.T) {
@@ -16,3 +19,36 @@ func TestMnemonic(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, privKey, "9aa5eaa7c63f1e157b94896919dd4327d279b8265c4794100f28b78cae79be7d")
 }
+
+func TestMnemonicLanguages(t *testing.T) {
+	// BIP39 test vectors, with passphrase
+	priv, chainCode, err := common.CalcMasterPrivWithPassphrase("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about", "TREZOR", hdwallet.English)
+	assert.NoError(t, err)
+	seed, _ := hex.DecodeString("c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04")
+	expectedPriv, expectedChainCode := hdwallet.ComputeMastersFromSeed(seed)
+	assert.Equal(t, expectedPriv, priv)
+	assert.Equal(t, expectedChainCode, chainCode)
+
+	// words separated by ideographic spaces, the passphrase is NFKD normalized
+	japanese := strings.Repeat("あいこくしん　", 11) + "あおぞら"
+	seed, err = hdwallet.NewSeed(japanese, "㍍ガバヴァぱばぐゞちぢ十人十色", hdwallet.Japanese)
+	assert.NoError(t, err)
+	assert.Equal(t, "a262d6fb6122ecf45be09c50492b31f92e9beb7d9a845987a02cefda57a15f9c467a17872029a9e92299b5cbdf306e3a0ee620245cbd508959b6cb7ca637bd55", hex.EncodeToString(seed))
+
+	// the composed and decomposed forms of the words are the same mnemonic
+	for _, language := range []string{hdwallet.Spanish, hdwallet.French, hdwallet.Korean, hdwallet.ChineseSimplified} {
+		mnemonic, err := hdwallet.NewMnemonic(18, language)
+		assert.NoError(t, err)
+		decomposed, _, err := common.CalcMasterPrivWithPassphrase(mnemonic, "", language)
+		assert.NoError(t, err, language)
+		composed, _, err := common.CalcMasterPrivWithPassphrase(norm.NFC.String(mnemonic), "", language)
+		assert.NoError(t, err, language)
+		assert.Equal(t, decomposed, composed, language)
+
+		_, _, err = common.CalcMasterPrivWithPassphrase(mnemonic, "", hdwallet.English)
+		assert.Error(t, err, language)
+	}
+
+	_, _, err = common.CalcMasterPrivWithPassphrase(japanese, "", "klingon")
+	assert.Error(t, err)
+}
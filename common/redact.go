@@ -0,0 +1,173 @@
+package common
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/big"
+	"regexp"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/decred/dcrd/dcrec/edwards/v2"
+	ecies "github.com/ecies/go/v2"
+
+	"recovery-tool/crypto/hdwallet"
+	"recovery-tool/crypto/hdwallet/bip39/wordlists"
+)
+
+// the least words of a mnemonic
+const mnemonicMinWords = 12
+
+// Long hex, decimal and base64/base58 runs may be private keys, seeds or signed payloads echoed by the nodes,
+// see isSecretRun for the hex runs that are kept.
+var secretRunPattern = regexp.MustCompile(`[A-Za-z0-9+/_-]{88,}={0,2}|(?:0x)?[0-9a-fA-F]{64,}|[0-9]{40,}`)
+
+var hexRunPattern = regexp.MustCompile(`^(?:0x)?[0-9a-fA-F]+$`)
+
+var decimalRunPattern = regexp.MustCompile(`^[0-9]+$`)
+
+var wordPattern = regexp.MustCompile(`[\p{L}\p{M}]+`)
+
+// mnemonicWords are the words of all the languages, as written in the word lists and NFKD normalized
+var mnemonicWords = func() map[string]bool {
+	words := make(map[string]bool)
+	for _, list := range [][]string{wordlists.English, wordlists.ChineseSimplified, wordlists.ChineseTraditional,
+		wordlists.Japanese, wordlists.Korean, wordlists.French, wordlists.Italian, wordlists.Spanish} {
+		for _, word := range list {
+			words[word] = true
+			words[hdwallet.NormalizeMnemonic(word)] = true
+		}
+	}
+	return words
+}()
+
+// Redact formats the message like fmt.Sprintf, with the key material replaced by fingerprints.
+// The big integers, private keys and byte slices in args are never formatted, then the long hex, decimal
+// and base64 runs and the mnemonics left in the message, e.g. in an error, are replaced as well.
+func Redact(format string, args ...interface{}) string {
+	redacted := make([]interface{}, len(args))
+	for i, arg := range args {
+		redacted[i] = redactArg(arg)
+	}
+	return redactMessage(fmt.Sprintf(format, redacted...))
+}
+
+// Fingerprint is a short hash of data, to tell the secrets apart without revealing them
+func Fingerprint(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:4])
+}
+
+func redactArg(arg interface{}) interface{} {
+	switch v := arg.(type) {
+	case *big.Int:
+		if v == nil {
+			return arg
+		}
+		return redactedArg(redacted("scalar", v.Bytes()))
+	case big.Int:
+		return redactedArg(redacted("scalar", v.Bytes()))
+	case *ecies.PrivateKey:
+		if v == nil {
+			return arg
+		}
+		return redactedArg(redacted("ecies private key", v.PublicKey.Bytes(true)))
+	case *rsa.PrivateKey:
+		if v == nil {
+			return arg
+		}
+		return redactedArg(redacted("rsa private key", v.PublicKey.N.Bytes()))
+	case *ecdsa.PrivateKey:
+		if v == nil || v.X == nil {
+			return redactedArg(redacted("ecdsa private key", nil))
+		}
+		return redactedArg(redacted("ecdsa private key", elliptic.Marshal(v.Curve, v.X, v.Y)))
+	case *btcec.PrivateKey:
+		if v == nil {
+			return arg
+		}
+		return redactedArg(redacted("ecdsa private key", v.PubKey().SerializeCompressed()))
+	case *edwards.PrivateKey:
+		if v == nil {
+			return arg
+		}
+		return redactedArg(redacted("eddsa private key", v.PubKey().Serialize()))
+	case []byte:
+		return redactedArg(redacted("bytes", v))
+	case [32]byte:
+		return redactedArg(redacted("bytes", v[:]))
+	case [64]byte:
+		return redactedArg(redacted("bytes", v[:]))
+	}
+	return arg
+}
+
+// redactedArg is formatted as the redacted text with any verb
+type redactedArg string
+
+func (r redactedArg) Format(f fmt.State, _ rune) {
+	io.WriteString(f, string(r))
+}
+
+func redacted(kind string, data []byte) string {
+	return fmt.Sprintf("[redacted %s %s]", kind, Fingerprint(data))
+}
+
+func redactMessage(msg string) string {
+	msg = secretRunPattern.ReplaceAllStringFunc(msg, func(run string) string {
+		if !isSecretRun(run) {
+			return run
+		}
+		return redacted("data", []byte(run))
+	})
+	return redactMnemonics(msg)
+}
+
+// isSecretRun tells whether a run of secretRunPattern may be a secret. A hex run is a secret only when it is
+// exactly 32 bytes: the public keys (02/03/04 prefixed, 33 or 65 bytes) are longer, and the 0x prefixed runs
+// are addresses (e.g. Aptos) or hashes.
+func isSecretRun(run string) bool {
+	if decimalRunPattern.MatchString(run) || !hexRunPattern.MatchString(run) {
+		return true
+	}
+	return len(run) == 64
+}
+
+// redactMnemonics replaces the runs of mnemonicMinWords or more mnemonic words
+func redactMnemonics(msg string) string {
+	words := wordPattern.FindAllStringIndex(msg, -1)
+	var sb strings.Builder
+	last := 0
+	for i := 0; i < len(words); {
+		j := i
+		for j < len(words) && mnemonicWords[msg[words[j][0]:words[j][1]]] && (j == i || onlySpaces(msg[words[j-1][1]:words[j][0]])) {
+			j++
+		}
+		if j-i < mnemonicMinWords {
+			if j == i {
+				j++
+			}
+			i = j
+			continue
+		}
+		start, end := words[i][0], words[j-1][1]
+		sb.WriteString(msg[last:start])
+		sb.WriteString(redacted("mnemonic", []byte(msg[start:end])))
+		last = end
+		i = j
+	}
+	if last == 0 {
+		return msg
+	}
+	sb.WriteString(msg[last:])
+	return sb.String()
+}
+
+func onlySpaces(s string) bool {
+	return len(s) > 0 && strings.TrimSpace(s) == ""
+}
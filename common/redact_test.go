@@ -0,0 +1,90 @@
+package common_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	ecies "github.com/ecies/go/v2"
+	"github.com/stretchr/testify/assert"
+
+	"recovery-tool/common"
+)
+
+func TestRedact(t *testing.T) {
+	scalar, _ := new(big.Int).SetString("9aa5eaa7c63f1e157b94896919dd4327d279b8265c4794100f28b78cae79be7d", 16)
+	msg := common.Redact("scalar: %d %x %v", scalar, scalar, *scalar)
+	assert.NotContains(t, msg, scalar.String())
+	assert.NotContains(t, msg, scalar.Text(16))
+	assert.Equal(t, 3, strings.Count(msg, "[redacted scalar "+common.Fingerprint(scalar.Bytes())+"]"))
+
+	eciesPrivKey, err := ecies.NewPrivateKeyFromHex("ea5db436b7508e5c8ec3ae17003bcb997c30e03c655f0dd2d1824ec93bd0501c")
+	assert.NoError(t, err)
+	msg = common.Redact("ecies: %+v %d", eciesPrivKey, eciesPrivKey.D)
+	assert.NotContains(t, msg, eciesPrivKey.D.String())
+	assert.Contains(t, msg, "[redacted ecies private key ")
+
+	rsaPrivKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.NoError(t, err)
+	msg = common.Redact("rsa: %v %d", rsaPrivKey, rsaPrivKey.Primes[0])
+	assert.NotContains(t, msg, rsaPrivKey.Primes[0].String())
+	assert.Contains(t, msg, "[redacted rsa private key ")
+
+	// the secrets inside an error are found in the message
+	mnemonic := "amused garlic window please enrich sick gate ready owner giraffe elite umbrella hair seat punch seminar notable enroll wet asset outdoor inflict rich mushroom"
+	msg = common.Redact("create seed err: %s", fmt.Errorf("invalid mnemonic %s.", mnemonic))
+	assert.Equal(t, "create seed err: invalid mnemonic [redacted mnemonic "+common.Fingerprint([]byte(mnemonic))+"].", msg)
+	payload := strings.Repeat("AQIDBAUGBwgJ", 10)
+	msg = common.Redact("rpc: call error, err: %v", fmt.Errorf("bad tx %s", payload))
+	assert.NotContains(t, msg, payload)
+
+	// the addresses and the plain messages are kept
+	msg = common.Redact("backup %s matches the mnemonic, from: %s", "./test/134_archive.zip", "0xA209798360bAbfe34EE6426c5877D08c9301376B")
+	assert.Equal(t, "backup ./test/134_archive.zip matches the mnemonic, from: 0xA209798360bAbfe34EE6426c5877D08c9301376B", msg)
+	privKey := "0f2020d5f3ff4a08919d6e5f9058c47946dffaa620ea10e0d884c078dfa6ba23"
+	msg = common.Redact("derived %s: %s", "0xc1044f9290dd287b6824842953b2b25efb3edc02d695b2f267e59cab248437c9", privKey)
+	assert.Equal(t, "derived 0xc1044f9290dd287b6824842953b2b25efb3edc02d695b2f267e59cab248437c9: [redacted data "+common.Fingerprint([]byte(privKey))+"]", msg)
+}
+
+func TestRedactPubKeys(t *testing.T) {
+	eciesPrivKey, err := ecies.NewPrivateKeyFromHex("ea5db436b7508e5c8ec3ae17003bcb997c30e03c655f0dd2d1824ec93bd0501c")
+	assert.NoError(t, err)
+	for _, pubKey := range []string{eciesPrivKey.PublicKey.Hex(true), eciesPrivKey.PublicKey.Hex(false)} {
+		msg := common.Redact("ecdsa pub key: %s", pubKey)
+		assert.Equal(t, "ecdsa pub key: "+pubKey, msg)
+	}
+}
+
+// The logger of go-log is reached only through common.Logger, which redacts every message
+func TestLoggerNotBypassed(t *testing.T) {
+	root := ".."
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == "package" {
+			return filepath.SkipDir
+		}
+		if info.IsDir() || !strings.HasSuffix(path, ".go") || filepath.Base(path) == "logger.go" {
+			return nil
+		}
+		file, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.ImportsOnly)
+		if err != nil {
+			return err
+		}
+		for _, spec := range file.Imports {
+			importPath, _ := strconv.Unquote(spec.Path.Value)
+			assert.False(t, strings.HasPrefix(importPath, "github.com/ipfs/go-log"), "%s imports %s, log with common.Logger", path, importPath)
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,137 @@
+package common
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/decred/dcrd/dcrec/edwards/v2"
+
+	"recovery-tool/common/code"
+	"recovery-tool/crypto"
+	"recovery-tool/crypto/ckd"
+)
+
+// WatchOnlyShare is the public part of a root share, in hex
+type WatchOnlyShare struct {
+	EcdsaPubKey string `yaml:"ecdsa_public_key" json:"ecdsa_public_key"` // compressed secp256k1
+	EddsaPubKey string `yaml:"eddsa_public_key" json:"eddsa_public_key"` // ed25519
+	ChainCode   string `yaml:"chain_code" json:"chain_code"`
+}
+
+// WatchOnlyBundle holds the public data of RootKeys, enough to derive the addresses of the non-hardened paths
+// without any private key. The child public key is the sum of the child public keys of the shares.
+type WatchOnlyBundle struct {
+	Shares      []*WatchOnlyShare `yaml:"shares" json:"shares"`
+	EddsaPubKey string            `yaml:"eddsa_deduce_public_key" json:"eddsa_deduce_public_key"` // the combined eddsa public key
+}
+
+// WatchOnly exports the public keys and chain codes of the shares
+func (params *RootKeys) WatchOnly() *WatchOnlyBundle {
+	bundle := &WatchOnlyBundle{
+		Shares:      make([]*WatchOnlyShare, 0, len(params.Shares)),
+		EddsaPubKey: hex.EncodeToString(serializeEddsaPubKey(params.EddsaPubKey)),
+	}
+	for _, key := range params.Shares {
+		bundle.Shares = append(bundle.Shares, &WatchOnlyShare{
+			EcdsaPubKey: hex.EncodeToString(elliptic.MarshalCompressed(btcec.S256(), key.EcdsaPubKey.X(), key.EcdsaPubKey.Y())),
+			EddsaPubKey: hex.EncodeToString(serializeEddsaPubKey(key.EddsaPubKey)),
+			ChainCode:   hex.EncodeToString(key.ChainCode),
+		})
+	}
+	return bundle
+}
+
+// DeriveAddress derives the address and the public key of hdPath from the public data only
+func (b *WatchOnlyBundle) DeriveAddress(hdPath string, coin int) (string, []byte, error) {
+	if len(b.Shares) == 0 {
+		return "", nil, code.NewI18nError(code.FailedToParseDataErr, "watch-only bundle has no share")
+	}
+
+	eddsa := isEddsaCoin(coin)
+	var deducePubKey *crypto.ECPoint
+	var err error
+	if eddsa {
+		if deducePubKey, err = parseEddsaPubKey(b.EddsaPubKey); err != nil {
+			return "", nil, code.NewI18nError(code.FailedToParseDataErr, fmt.Sprintf("invalid eddsa deduce public key: %s", err))
+		}
+	}
+
+	var pubKey *crypto.ECPoint
+	for i, share := range b.Shares {
+		chainCode, err := hex.DecodeString(share.ChainCode)
+		if err != nil || len(chainCode) != 32 {
+			return "", nil, code.NewI18nError(code.FailedToParseDataErr, fmt.Sprintf("invalid chain code of share %d", i))
+		}
+
+		var sharePubKey, childPubKey *crypto.ECPoint
+		if eddsa {
+			if sharePubKey, err = parseEddsaPubKey(share.EddsaPubKey); err != nil {
+				return "", nil, code.NewI18nError(code.FailedToParseDataErr, fmt.Sprintf("invalid eddsa public key of share %d: %s", i, err))
+			}
+			childPubKey, err = ckd.DerivePublicKeyForPathD(ckd.NewExtendKeyD(nil, sharePubKey, deducePubKey, 0, 0, chainCode), hdPath, edwards.Edwards())
+		} else {
+			if sharePubKey, err = parseEcdsaPubKey(share.EcdsaPubKey); err != nil {
+				return "", nil, code.NewI18nError(code.FailedToParseDataErr, fmt.Sprintf("invalid ecdsa public key of share %d: %s", i, err))
+			}
+			childPubKey, err = ckd.DerivePublicKeyForPath(ckd.NewExtendKey(nil, sharePubKey, sharePubKey, 0, 0, chainCode), hdPath)
+		}
+		if err != nil {
+			return "", nil, code.NewI18nError(code.DeriveChildPrivErr, fmt.Sprintf("derive child public key of share %d failed: %s", i, err))
+		}
+
+		if pubKey == nil {
+			pubKey = childPubKey
+		} else if pubKey, err = pubKey.Add(childPubKey); err != nil {
+			return "", nil, code.NewI18nError(code.DeriveChildPrivErr, err.Error())
+		}
+	}
+
+	address, err := PubKeyAddress(pubKey, coin)
+	if err != nil {
+		return "", nil, code.NewI18nError(code.DeriveChildAddressErr, err.Error())
+	}
+	if eddsa {
+		return address, serializeEddsaPubKey(pubKey), nil
+	}
+	return address, elliptic.MarshalCompressed(btcec.S256(), pubKey.X(), pubKey.Y()), nil
+}
+
+// PubKeyAddress encodes the address of a child public key of coin
+func PubKeyAddress(pubKey *crypto.ECPoint, coin int) (string, error) {
+	chain := SwitchCoin(uint32(coin))
+	if isEddsaCoin(coin) {
+		return SwitchEddsaChainAddress(edwards.NewPublicKey(pubKey.X(), pubKey.Y()), chain)
+	}
+	return SwitchEcdsaChainAddress(&ecdsa.PublicKey{X: pubKey.X(), Y: pubKey.Y(), Curve: btcec.S256()}, chain)
+}
+
+func serializeEddsaPubKey(pubKey *crypto.ECPoint) []byte {
+	return edwards.NewPublicKey(pubKey.X(), pubKey.Y()).Serialize()
+}
+
+func parseEcdsaPubKey(pubKey string) (*crypto.ECPoint, error) {
+	pubKeyBytes, err := hex.DecodeString(pubKey)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := btcec.ParsePubKey(pubKeyBytes)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.NewECPoint(btcec.S256(), parsed.X(), parsed.Y())
+}
+
+func parseEddsaPubKey(pubKey string) (*crypto.ECPoint, error) {
+	pubKeyBytes, err := hex.DecodeString(pubKey)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := edwards.ParsePubKey(pubKeyBytes)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.NewECPoint(edwards.Edwards(), parsed.X, parsed.Y)
+}
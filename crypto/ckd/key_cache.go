@@ -0,0 +1,210 @@
+package ckd
+
+import (
+	"crypto/elliptic"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"recovery-tool/crypto"
+	"recovery-tool/crypto/secure"
+)
+
+// KeyCache memoizes the intermediate nodes derived from a single root key, so that paths sharing
+// a prefix (e.g. 81/0/<vault> for every coin of a vault) only derive that prefix once.
+// At most prefixDepth leading path parts are cached and the leaf key is never cached.
+// A KeyCache is safe for concurrent use.
+type KeyCache struct {
+	root        *ExtendedKey
+	prefixDepth int
+
+	mu    sync.Mutex
+	nodes map[string]*cachedKey
+}
+
+type cachedKey struct {
+	once sync.Once
+	key  *ExtendedKey
+	err  error
+}
+
+// KeyCacheD is the eddsa counterpart of KeyCache.
+type KeyCacheD struct {
+	root        *ExtendedKeyD
+	curve       elliptic.Curve
+	prefixDepth int
+
+	mu    sync.Mutex
+	nodes map[string]*cachedKeyD
+}
+
+type cachedKeyD struct {
+	once sync.Once
+	key  *ExtendedKeyD
+	err  error
+}
+
+// NewKeyCache creates a cache for the paths derived from root, root must be at depth 0.
+func NewKeyCache(root *ExtendedKey, prefixDepth int) *KeyCache {
+	return &KeyCache{
+		root:        root,
+		prefixDepth: prefixDepth,
+		nodes:       make(map[string]*cachedKey),
+	}
+}
+
+// NewKeyCacheD creates a cache for the paths derived from root, root must be at depth 0.
+func NewKeyCacheD(root *ExtendedKeyD, curve elliptic.Curve, prefixDepth int) *KeyCacheD {
+	return &KeyCacheD{
+		root:        root,
+		curve:       curve,
+		prefixDepth: prefixDepth,
+		nodes:       make(map[string]*cachedKeyD),
+	}
+}
+
+// DerivePrivateKeyForPath is DerivePrivateKeyForPath starting from the deepest cached prefix of path.
+func (c *KeyCache) DerivePrivateKeyForPath(path string) ([32]byte, []byte, error) {
+	parts := strings.Split(path, "/")
+	node, err := c.node(parts[:cachedDepth(len(parts), c.prefixDepth)])
+	if err != nil {
+		return [32]byte{}, nil, err
+	}
+	return DerivePrivateKeyForPath(node, path)
+}
+
+func (c *KeyCache) node(parts []string) (*ExtendedKey, error) {
+	if len(parts) == 0 {
+		return c.root, nil
+	}
+
+	id := strings.Join(parts, "/")
+	c.mu.Lock()
+	entry, ok := c.nodes[id]
+	if !ok {
+		entry = &cachedKey{}
+		c.nodes[id] = entry
+	}
+	c.mu.Unlock()
+
+	entry.once.Do(func() {
+		parent, err := c.node(parts[:len(parts)-1])
+		if err != nil {
+			entry.err = err
+			return
+		}
+		idx, harden, err := parsePathPart(parts[len(parts)-1])
+		if err != nil {
+			entry.err = err
+			return
+		}
+		_, entry.key, err = DeriveChildKey(idx, harden, parent, crypto.S256())
+		if err != nil {
+			entry.err = fmt.Errorf("DeriveChildKey error: %s", err)
+		}
+	})
+	return entry.key, entry.err
+}
+
+// DerivePrivateKeyForPathD is DerivePrivateKeyForPathD starting from the deepest cached prefix of path.
+func (c *KeyCacheD) DerivePrivateKeyForPathD(path string) ([32]byte, []byte, error) {
+	parts := strings.Split(path, "/")
+	node, err := c.node(parts[:cachedDepth(len(parts), c.prefixDepth)])
+	if err != nil {
+		return [32]byte{}, nil, err
+	}
+	return DerivePrivateKeyForPathD(node, path, c.curve)
+}
+
+func (c *KeyCacheD) node(parts []string) (*ExtendedKeyD, error) {
+	if len(parts) == 0 {
+		return c.root, nil
+	}
+
+	id := strings.Join(parts, "/")
+	c.mu.Lock()
+	entry, ok := c.nodes[id]
+	if !ok {
+		entry = &cachedKeyD{}
+		c.nodes[id] = entry
+	}
+	c.mu.Unlock()
+
+	entry.once.Do(func() {
+		parent, err := c.node(parts[:len(parts)-1])
+		if err != nil {
+			entry.err = err
+			return
+		}
+		idx, harden, err := parsePathPart(parts[len(parts)-1])
+		if err != nil {
+			entry.err = err
+			return
+		}
+		_, entry.key, err = DeriveChildKeyD(idx, harden, parent, c.curve)
+		if err != nil {
+			entry.err = fmt.Errorf("DeriveChildKey error: %s", err)
+		}
+	})
+	return entry.key, entry.err
+}
+
+// Wipe zeroes the private keys and chain codes of the root and the cached nodes, the cache must not be used after it
+func (c *KeyCache) Wipe() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	secure.Wipe(c.root.PrivKey)
+	for _, entry := range c.nodes {
+		if entry.key != nil {
+			secure.Wipe(entry.key.PrivKey)
+			secure.Wipe(entry.key.ChainCode)
+		}
+	}
+	c.nodes = make(map[string]*cachedKey)
+}
+
+// Wipe zeroes the private keys and chain codes of the root and the cached nodes, the cache must not be used after it
+func (c *KeyCacheD) Wipe() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	secure.Wipe(c.root.PrivKey)
+	for _, entry := range c.nodes {
+		if entry.key != nil {
+			secure.Wipe(entry.key.PrivKey)
+			secure.Wipe(entry.key.ChainCode)
+		}
+	}
+	c.nodes = make(map[string]*cachedKeyD)
+}
+
+// cachedDepth returns how many leading parts of a path with the given length are cached
+func cachedDepth(pathLen, prefixDepth int) int {
+	if prefixDepth > pathLen-1 {
+		prefixDepth = pathLen - 1
+	}
+	if prefixDepth < 0 {
+		return 0
+	}
+	return prefixDepth
+}
+
+func parsePathPart(part string) (uint32, bool, error) {
+	if part == "" {
+		return 0, false, errors.New("invalid BIP 32 path: empty index")
+	}
+	// do we have an apostrophe?
+	harden := part[len(part)-1:] == "'"
+	if harden {
+		part = part[:len(part)-1]
+	}
+	idx, err := strconv.Atoi(part)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid BIP 32 path: %s", err)
+	}
+	if idx < 0 || idx >= HardenedKeyStart {
+		return 0, false, errors.New("invalid BIP 32 path: index negative ot too large")
+	}
+	return uint32(idx), harden, nil
+}
@@ -0,0 +1,91 @@
+package ckd
+
+import (
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	edwards "github.com/decred/dcrd/dcrec/edwards/v2"
+	"github.com/stretchr/testify/assert"
+
+	"recovery-tool/crypto"
+)
+
+func TestKeyCache(t *testing.T) {
+	priKeyBytes, _ := hex.DecodeString("ae1e5bf5f3d6bf58b5c222088671fcbe78b437e28fae944c793897b26091f241")
+	chainCode, _ := hex.DecodeString("be1e5bf5f3d6bf58b5c222088671fcbe78b437e28fae944c793897b26091f242")
+	priKey := new(big.Int).SetBytes(priKeyBytes)
+
+	pubKey := crypto.ScalarBaseMult(crypto.S256(), priKey)
+	root := NewExtendKey(priKeyBytes, pubKey, pubKey, 0, 0, chainCode)
+	cache := NewKeyCache(root, 3)
+
+	edPubKey := crypto.ScalarBaseMult(edwards.Edwards(), priKey)
+	deduceKey, _ := edPubKey.Add(edPubKey)
+	rootD := NewExtendKeyD(priKeyBytes, edPubKey, deduceKey, 0, 0, chainCode)
+	cacheD := NewKeyCacheD(rootD, edwards.Edwards(), 3)
+
+	for _, path := range []string{"81/0/0/60/0", "81/0/0/0/0", "81/0/1/60/1", "81/1"} {
+		expectedKey, expectedPubKey, err := DerivePrivateKeyForPath(root, path)
+		assert.NoError(t, err)
+		childKey, childPubKey, err := cache.DerivePrivateKeyForPath(path)
+		assert.NoError(t, err)
+		assert.Equal(t, expectedKey, childKey, path)
+		assert.Equal(t, expectedPubKey, childPubKey, path)
+
+		expectedKey, expectedPubKey, err = DerivePrivateKeyForPathD(rootD, path, edwards.Edwards())
+		assert.NoError(t, err)
+		childKey, childPubKey, err = cacheD.DerivePrivateKeyForPathD(path)
+		assert.NoError(t, err)
+		assert.Equal(t, expectedKey, childKey, path)
+		assert.Equal(t, expectedPubKey, childPubKey, path)
+	}
+
+	_, _, err := cache.DerivePrivateKeyForPath("81/x/0/60/0")
+	assert.Error(t, err)
+	_, _, err = cacheD.DerivePrivateKeyForPathD("81//0/501/0")
+	assert.Error(t, err)
+}
+
+func TestKeyCacheWipe(t *testing.T) {
+	priKeyBytes, _ := hex.DecodeString("ae1e5bf5f3d6bf58b5c222088671fcbe78b437e28fae944c793897b26091f241")
+	chainCode, _ := hex.DecodeString("be1e5bf5f3d6bf58b5c222088671fcbe78b437e28fae944c793897b26091f242")
+	priKey := new(big.Int).SetBytes(priKeyBytes)
+
+	pubKey := crypto.ScalarBaseMult(crypto.S256(), priKey)
+	cache := NewKeyCache(NewExtendKey(append([]byte{}, priKeyBytes...), pubKey, pubKey, 0, 0, chainCode), 3)
+	edPubKey := crypto.ScalarBaseMult(edwards.Edwards(), priKey)
+	cacheD := NewKeyCacheD(NewExtendKeyD(append([]byte{}, priKeyBytes...), edPubKey, edPubKey, 0, 0, chainCode), edwards.Edwards(), 3)
+
+	_, _, err := cache.DerivePrivateKeyForPath("81/0/0/60/0")
+	assert.NoError(t, err)
+	_, _, err = cacheD.DerivePrivateKeyForPathD("81/0/0/501/0")
+	assert.NoError(t, err)
+
+	var nodes []*ExtendedKey
+	for _, entry := range cache.nodes {
+		nodes = append(nodes, entry.key)
+	}
+	var nodesD []*ExtendedKeyD
+	for _, entry := range cacheD.nodes {
+		nodesD = append(nodesD, entry.key)
+	}
+	assert.Len(t, nodes, 3)
+	assert.Len(t, nodesD, 3)
+
+	cache.Wipe()
+	cacheD.Wipe()
+	zero := make([]byte, 32)
+	assert.Equal(t, zero, cache.root.PrivKey)
+	assert.Equal(t, zero, cacheD.root.PrivKey)
+	for _, node := range nodes {
+		assert.Equal(t, zero, node.PrivKey)
+		assert.Equal(t, zero, node.ChainCode)
+	}
+	for _, node := range nodesD {
+		assert.Equal(t, zero, node.PrivKey)
+		assert.Equal(t, zero, node.ChainCode)
+	}
+	assert.Empty(t, cache.nodes)
+	assert.Empty(t, cacheD.nodes)
+}
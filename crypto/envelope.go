@@ -0,0 +1,222 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	ecies "github.com/ecies/go/v2"
+	"golang.org/x/crypto/scrypt"
+
+	"recovery-tool/crypto/secure"
+)
+
+const envelopeVersion = 1
+
+// envelope key kinds
+const (
+	EnvelopePassphrase = "passphrase"
+	EnvelopeEcies      = "ecies"
+	EnvelopeRsa        = "rsa"
+)
+
+// scrypt parameters of the new envelopes, the ones of an envelope are read from it
+const (
+	scryptN      = 1 << 17
+	scryptR      = 8
+	scryptP      = 1
+	scryptMaxN   = 1 << 20
+	scryptKeyLen = 32
+)
+
+var envelopeAAD = []byte("HBC_MPC_RECOVERY_OUTPUT")
+
+// Envelope is data encrypted with AES-256-GCM. The data key is derived from a passphrase with scrypt,
+// or is random and encrypted to an ECIES or RSA recipient key.
+type Envelope struct {
+	Version      int           `json:"version"`
+	Kind         string        `json:"kind"`
+	Scrypt       *ScryptParams `json:"scrypt,omitempty"`        // passphrase only
+	EncryptedKey []byte        `json:"encrypted_key,omitempty"` // ecies and rsa only
+	Nonce        []byte        `json:"nonce"`
+	Ciphertext   []byte        `json:"ciphertext"`
+}
+
+type ScryptParams struct {
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+	Salt []byte `json:"salt"`
+}
+
+// SealWithPassphrase encrypts data with a key derived from passphrase
+func SealWithPassphrase(data, passphrase []byte) (*Envelope, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("empty passphrase")
+	}
+	params := &ScryptParams{N: scryptN, R: scryptR, P: scryptP, Salt: make([]byte, 32)}
+	if _, err := rand.Read(params.Salt); err != nil {
+		return nil, err
+	}
+	key, err := scrypt.Key(passphrase, params.Salt, params.N, params.R, params.P, scryptKeyLen)
+	if err != nil {
+		return nil, err
+	}
+	defer secure.Wipe(key)
+
+	envelope := &Envelope{Version: envelopeVersion, Kind: EnvelopePassphrase, Scrypt: params}
+	return envelope, envelope.seal(key, data)
+}
+
+// SealToEcies encrypts data to an ECIES recipient
+func SealToEcies(data []byte, pubKey *ecies.PublicKey) (*Envelope, error) {
+	key, err := randomKey()
+	if err != nil {
+		return nil, err
+	}
+	defer secure.Wipe(key)
+
+	envelope := &Envelope{Version: envelopeVersion, Kind: EnvelopeEcies}
+	if envelope.EncryptedKey, err = ecies.Encrypt(pubKey, key); err != nil {
+		return nil, err
+	}
+	return envelope, envelope.seal(key, data)
+}
+
+// SealToRsa encrypts data to an RSA recipient
+func SealToRsa(data []byte, pubKey *rsa.PublicKey) (*Envelope, error) {
+	key, err := randomKey()
+	if err != nil {
+		return nil, err
+	}
+	defer secure.Wipe(key)
+
+	envelope := &Envelope{Version: envelopeVersion, Kind: EnvelopeRsa}
+	if envelope.EncryptedKey, err = RsaEncryptOAEP(pubKey, key); err != nil {
+		return nil, err
+	}
+	return envelope, envelope.seal(key, data)
+}
+
+// OpenWithPassphrase decrypts a passphrase envelope
+func (e *Envelope) OpenWithPassphrase(passphrase []byte) ([]byte, error) {
+	if err := e.check(EnvelopePassphrase); err != nil {
+		return nil, err
+	}
+	params := e.Scrypt
+	if params == nil || params.N <= 1 || params.N > scryptMaxN || params.R <= 0 || params.P <= 0 {
+		return nil, errors.New("invalid scrypt parameters")
+	}
+	key, err := scrypt.Key(passphrase, params.Salt, params.N, params.R, params.P, scryptKeyLen)
+	if err != nil {
+		return nil, err
+	}
+	defer secure.Wipe(key)
+	return e.open(key)
+}
+
+// OpenWithEcies decrypts an envelope encrypted to the public key of privKey
+func (e *Envelope) OpenWithEcies(privKey *ecies.PrivateKey) ([]byte, error) {
+	if err := e.check(EnvelopeEcies); err != nil {
+		return nil, err
+	}
+	key, err := ecies.Decrypt(privKey, e.EncryptedKey)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt data key failed: %s", err)
+	}
+	defer secure.Wipe(key)
+	return e.open(key)
+}
+
+// OpenWithRsa decrypts an envelope encrypted to the public key of privKey
+func (e *Envelope) OpenWithRsa(privKey *rsa.PrivateKey) ([]byte, error) {
+	if err := e.check(EnvelopeRsa); err != nil {
+		return nil, err
+	}
+	key, err := RsaDecryptOAEP(privKey, e.EncryptedKey)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt data key failed: %s", err)
+	}
+	defer secure.Wipe(key)
+	return e.open(key)
+}
+
+// ParseEnvelope parses the json of an envelope
+func ParseEnvelope(data []byte) (*Envelope, error) {
+	envelope := &Envelope{}
+	if err := json.Unmarshal(data, envelope); err != nil {
+		return nil, err
+	}
+	if envelope.Version != envelopeVersion {
+		return nil, fmt.Errorf("unsupported envelope version %d", envelope.Version)
+	}
+	return envelope, nil
+}
+
+func (e *Envelope) check(kind string) error {
+	if e.Kind != kind {
+		return fmt.Errorf("the envelope is encrypted with %s, not %s", e.Kind, kind)
+	}
+	return nil
+}
+
+func (e *Envelope) seal(key, data []byte) error {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	e.Nonce = make([]byte, aead.NonceSize())
+	if _, err = rand.Read(e.Nonce); err != nil {
+		return err
+	}
+	e.Ciphertext = aead.Seal(nil, e.Nonce, data, e.aad())
+	return nil
+}
+
+func (e *Envelope) open(key []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(e.Nonce) != aead.NonceSize() {
+		return nil, errors.New("invalid nonce")
+	}
+	data, err := aead.Open(nil, e.Nonce, e.Ciphertext, e.aad())
+	if err != nil {
+		return nil, errors.New("wrong key or corrupted data")
+	}
+	return data, nil
+}
+
+// aad binds the header to the ciphertext, so the kind, the version and the scrypt parameters can't be rewritten,
+// e.g. to weaken the key derivation
+func (e *Envelope) aad() []byte {
+	aad := fmt.Sprintf("%s|%d|%s", envelopeAAD, e.Version, e.Kind)
+	if e.Scrypt != nil {
+		aad += fmt.Sprintf("|%d|%d|%d|%x", e.Scrypt.N, e.Scrypt.R, e.Scrypt.P, e.Scrypt.Salt)
+	}
+	return []byte(aad)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != scryptKeyLen {
+		return nil, fmt.Errorf("invalid data key length: %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func randomKey() ([]byte, error) {
+	key := make([]byte, scryptKeyLen)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
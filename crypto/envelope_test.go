@@ -0,0 +1,78 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"testing"
+
+	ecies "github.com/ecies/go/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvelope(t *testing.T) {
+	data := []byte("keys:\n- private_key: 0f2020d5f3ff4a08919d6e5f9058c479\n")
+
+	envelope, err := SealWithPassphrase(data, []byte("correct horse"))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(envelope.Ciphertext), "private_key")
+	opened, err := envelope.OpenWithPassphrase([]byte("correct horse"))
+	assert.NoError(t, err)
+	assert.Equal(t, data, opened)
+	_, err = envelope.OpenWithPassphrase([]byte("wrong horse"))
+	assert.Error(t, err)
+
+	eciesPrivKey, err := ecies.GenerateKey()
+	assert.NoError(t, err)
+	envelope, err = SealToEcies(data, eciesPrivKey.PublicKey)
+	assert.NoError(t, err)
+	opened, err = envelope.OpenWithEcies(eciesPrivKey)
+	assert.NoError(t, err)
+	assert.Equal(t, data, opened)
+
+	rsaPrivKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	envelope, err = SealToRsa(data, &rsaPrivKey.PublicKey)
+	assert.NoError(t, err)
+
+	// round trip through json, and the kind must match
+	encoded, err := json.Marshal(envelope)
+	assert.NoError(t, err)
+	parsed, err := ParseEnvelope(encoded)
+	assert.NoError(t, err)
+	opened, err = parsed.OpenWithRsa(rsaPrivKey)
+	assert.NoError(t, err)
+	assert.Equal(t, data, opened)
+	_, err = parsed.OpenWithEcies(eciesPrivKey)
+	assert.Error(t, err)
+
+	// tampered ciphertext
+	parsed.Ciphertext[0] ^= 1
+	_, err = parsed.OpenWithRsa(rsaPrivKey)
+	assert.Error(t, err)
+}
+
+// the header is bound to the ciphertext, the same data key can't open an envelope with a rewritten header
+func TestEnvelopeHeaderBound(t *testing.T) {
+	key, err := randomKey()
+	assert.NoError(t, err)
+	envelope := &Envelope{Version: envelopeVersion, Kind: EnvelopePassphrase, Scrypt: &ScryptParams{N: scryptN, R: scryptR, P: scryptP, Salt: []byte("salt")}}
+	assert.NoError(t, envelope.seal(key, []byte("data")))
+	_, err = envelope.open(key)
+	assert.NoError(t, err)
+
+	for _, rewrite := range []func(e *Envelope){
+		func(e *Envelope) { e.Scrypt.N = 2 },
+		func(e *Envelope) { e.Scrypt.R = 1 },
+		func(e *Envelope) { e.Scrypt.Salt = []byte("pepper") },
+		func(e *Envelope) { e.Kind = EnvelopeEcies },
+		func(e *Envelope) { e.Version = envelopeVersion + 1 },
+	} {
+		rewritten := *envelope
+		params := *envelope.Scrypt
+		rewritten.Scrypt = &params
+		rewrite(&rewritten)
+		_, err = rewritten.open(key)
+		assert.Error(t, err)
+	}
+}
@@ -0,0 +1,271 @@
+package hdwallet
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// the most suggestions of an unknown word
+const maxSuggestions = 3
+
+// BIP39 words are unique in their first 4 letters, a typo after them is suggested by the prefix
+const suggestPrefixLen = 4
+
+// the largest edit distance of a suggestion
+const maxSuggestDistance = 2
+
+// WordIssue is a word of a mnemonic that is not in the word list
+type WordIssue struct {
+	Position    int      // starts from 1
+	Word        string   // as typed, NFKD normalized
+	Suggestions []string // the nearest words of the list
+}
+
+// MnemonicDiagnosis tells what is wrong with a mnemonic
+type MnemonicDiagnosis struct {
+	Language      string
+	Words         int
+	UnknownWords  []*WordIssue
+	ChecksumValid bool // only checked when every word is known
+}
+
+// WordFix is a single word substitution making the mnemonic match
+type WordFix struct {
+	Position  int    // starts from 1
+	Word      string // as typed
+	Corrected string
+}
+
+// wordIndices are the indices of the normalized words of each language
+var wordIndices = func() map[string]map[string]int {
+	indices := make(map[string]map[string]int, len(wordLists))
+	for language, list := range wordLists {
+		index := make(map[string]int, len(list))
+		for i, word := range list {
+			index[word] = i
+		}
+		indices[language] = index
+	}
+	return indices
+}()
+
+// Valid tells whether the mnemonic has a valid length, known words and a valid checksum
+func (d *MnemonicDiagnosis) Valid() bool {
+	return validWordCount(d.Words) && len(d.UnknownWords) == 0 && d.ChecksumValid
+}
+
+func (d *MnemonicDiagnosis) String() string {
+	if !validWordCount(d.Words) {
+		return fmt.Sprintf("the mnemonic has %d words, not 12, 15, 18, 21 or 24", d.Words)
+	}
+	if len(d.UnknownWords) > 0 {
+		msgs := make([]string, 0, len(d.UnknownWords))
+		for _, issue := range d.UnknownWords {
+			// the typed word is left out, as the messages are logged and returned to the callers
+			msg := fmt.Sprintf("word %d is not in the %s word list", issue.Position, d.Language)
+			if len(issue.Suggestions) > 0 {
+				msg += fmt.Sprintf(" (did you mean %s?)", strings.Join(issue.Suggestions, " or "))
+			}
+			msgs = append(msgs, msg)
+		}
+		return strings.Join(msgs, "; ")
+	}
+	if !d.ChecksumValid {
+		return "the checksum of the mnemonic is invalid, a word may be mistyped or in the wrong order"
+	}
+	return "the mnemonic is valid"
+}
+
+// DiagnoseMnemonic checks the length, the words and the checksum of mnemonic
+func DiagnoseMnemonic(mnemonic, language string) (*MnemonicDiagnosis, error) {
+	indices, ok := wordIndices[language]
+	if !ok {
+		return nil, fmt.Errorf("unsupported mnemonic language: %s", language)
+	}
+
+	words := strings.Fields(NormalizeMnemonic(mnemonic))
+	diagnosis := &MnemonicDiagnosis{Language: language, Words: len(words)}
+	for i, word := range words {
+		if _, ok := indices[word]; !ok {
+			diagnosis.UnknownWords = append(diagnosis.UnknownWords, &WordIssue{
+				Position:    i + 1,
+				Word:        word,
+				Suggestions: SuggestWords(word, language),
+			})
+		}
+	}
+	if validWordCount(len(words)) && len(diagnosis.UnknownWords) == 0 {
+		diagnosis.ChecksumValid = validChecksum(wordListIndices(words, indices))
+	}
+	return diagnosis, nil
+}
+
+// SuggestWords returns the words of the list nearest to word, the ones of the same prefix first and then by the edit distance
+func SuggestWords(word, language string) []string {
+	type candidate struct {
+		word     string
+		prefix   bool
+		distance int
+	}
+
+	typed := []rune(word)
+	candidates := make([]candidate, 0)
+	for _, listWord := range wordLists[language] {
+		listRunes := []rune(listWord)
+		prefix := samePrefix(typed, listRunes, suggestPrefixLen)
+		distance := editDistance(typed, listRunes)
+		if distance > maxSuggestDistance && !prefix {
+			continue
+		}
+		candidates = append(candidates, candidate{word: listWord, prefix: prefix, distance: distance})
+	}
+
+	// the words of the same prefix go first, a truncated word is far from its list word by the edit distance
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].prefix != candidates[j].prefix {
+			return candidates[i].prefix
+		}
+		return candidates[i].distance < candidates[j].distance
+	})
+	if len(candidates) > maxSuggestions {
+		candidates = candidates[:maxSuggestions]
+	}
+	suggestions := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		suggestions = append(suggestions, c.word)
+	}
+	return suggestions
+}
+
+// FixSingleWord tries the substitutions of one word with a valid checksum until match accepts the mnemonic.
+// Only the unknown word is substituted if there is one, every word otherwise. Nil is returned if nothing matches.
+func FixSingleWord(mnemonic, language string, match func(candidate string) bool) (*WordFix, error) {
+	diagnosis, err := DiagnoseMnemonic(mnemonic, language)
+	if err != nil {
+		return nil, err
+	}
+	if !validWordCount(diagnosis.Words) || len(diagnosis.UnknownWords) > 1 {
+		return nil, nil
+	}
+
+	indices := wordIndices[language]
+	list := wordLists[language]
+	words := strings.Fields(NormalizeMnemonic(mnemonic))
+	positions := make([]int, 0, len(words))
+	if len(diagnosis.UnknownWords) == 1 {
+		positions = append(positions, diagnosis.UnknownWords[0].Position-1)
+	} else {
+		for i := range words {
+			positions = append(positions, i)
+		}
+	}
+
+	wordIndex := wordListIndices(words, indices)
+	candidate := make([]string, len(words))
+	copy(candidate, words)
+	for _, position := range positions {
+		typedIndex := wordIndex[position]
+		for i, substitute := range list {
+			if i == typedIndex {
+				continue
+			}
+			wordIndex[position] = i
+			if !validChecksum(wordIndex) {
+				continue
+			}
+			candidate[position] = substitute
+			if match(strings.Join(candidate, " ")) {
+				return &WordFix{Position: position + 1, Word: words[position], Corrected: substitute}, nil
+			}
+		}
+		wordIndex[position] = typedIndex
+		candidate[position] = words[position]
+	}
+	return nil, nil
+}
+
+func validWordCount(count int) bool {
+	return count%3 == 0 && count >= 12 && count <= 24
+}
+
+// wordListIndices returns the indices of words, -1 for an unknown word
+func wordListIndices(words []string, indices map[string]int) []int {
+	result := make([]int, len(words))
+	for i, word := range words {
+		index, ok := indices[word]
+		if !ok {
+			index = -1
+		}
+		result[i] = index
+	}
+	return result
+}
+
+// validChecksum checks the checksum bits at the end of the 11 bit word indices, as BIP39 specifies
+func validChecksum(indices []int) bool {
+	bits := len(indices) * 11
+	checksumBits := bits / 33
+	entropyBits := bits - checksumBits
+
+	data := make([]byte, (bits+7)/8)
+	for i, index := range indices {
+		if index < 0 {
+			return false
+		}
+		for b := 0; b < 11; b++ {
+			if index&(1<<(10-b)) != 0 {
+				pos := i*11 + b
+				data[pos/8] |= 1 << (7 - pos%8)
+			}
+		}
+	}
+
+	hash := sha256.Sum256(data[:entropyBits/8])
+	for b := 0; b < checksumBits; b++ {
+		pos := entropyBits + b
+		if (data[pos/8]>>(7-pos%8))&1 != (hash[0]>>(7-b))&1 {
+			return false
+		}
+	}
+	return true
+}
+
+func samePrefix(a, b []rune, n int) bool {
+	if len(a) < n || len(b) < n {
+		return false
+	}
+	return string(a[:n]) == string(b[:n])
+}
+
+// editDistance is the Levenshtein distance of a and b
+func editDistance(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,81 @@
+package hdwallet_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"recovery-tool/crypto/hdwallet"
+)
+
+const testMnemonic = "amused garlic window please enrich sick gate ready owner giraffe elite umbrella hair seat punch seminar notable enroll wet asset outdoor inflict rich mushroom"
+
+func TestDiagnoseMnemonic(t *testing.T) {
+	diagnosis, err := hdwallet.DiagnoseMnemonic(testMnemonic, hdwallet.English)
+	assert.NoError(t, err)
+	assert.True(t, diagnosis.Valid())
+
+	// an unknown word is suggested by the edit distance and the prefix
+	diagnosis, err = hdwallet.DiagnoseMnemonic(strings.Replace(testMnemonic, "garlic", "garlik", 1), hdwallet.English)
+	assert.NoError(t, err)
+	assert.False(t, diagnosis.Valid())
+	assert.Equal(t, 1, len(diagnosis.UnknownWords))
+	assert.Equal(t, 2, diagnosis.UnknownWords[0].Position)
+	assert.Equal(t, "garlic", diagnosis.UnknownWords[0].Suggestions[0])
+	assert.Contains(t, hdwallet.SuggestWords("umbrellla", hdwallet.English), "umbrella")
+	assert.Contains(t, hdwallet.SuggestWords("mushr", hdwallet.English), "mushroom")
+
+	// the message tells the position and the suggestions, not the typed word
+	msg := diagnosis.String()
+	assert.True(t, strings.HasPrefix(msg, "word 2 is not in the english word list (did you mean garlic"), msg)
+	assert.NotContains(t, msg, "garlik")
+
+	// known words in the wrong order fail the checksum
+	swapped := strings.Replace(strings.Replace(testMnemonic, "amused garlic", "garlic amused", 1), "rich mushroom", "mushroom rich", 1)
+	diagnosis, err = hdwallet.DiagnoseMnemonic(swapped, hdwallet.English)
+	assert.NoError(t, err)
+	assert.Empty(t, diagnosis.UnknownWords)
+	assert.False(t, diagnosis.ChecksumValid)
+	assert.NotContains(t, diagnosis.String(), "garlic")
+
+	diagnosis, err = hdwallet.DiagnoseMnemonic("amused garlic", hdwallet.English)
+	assert.NoError(t, err)
+	assert.False(t, diagnosis.Valid())
+	assert.Equal(t, "the mnemonic has 2 words, not 12, 15, 18, 21 or 24", diagnosis.String())
+
+	_, err = hdwallet.DiagnoseMnemonic(testMnemonic, "klingon")
+	assert.Error(t, err)
+}
+
+func TestFixSingleWord(t *testing.T) {
+	expected, err := hdwallet.NewSeed(testMnemonic, "", hdwallet.English)
+	assert.NoError(t, err)
+	matches := func(candidate string) bool {
+		seed, err := hdwallet.NewSeed(candidate, "", hdwallet.English)
+		return err == nil && bytes.Equal(seed, expected)
+	}
+
+	// the unknown word is the only one substituted
+	fix, err := hdwallet.FixSingleWord(strings.Replace(testMnemonic, "garlic", "garlik", 1), hdwallet.English, matches)
+	assert.NoError(t, err)
+	assert.Equal(t, &hdwallet.WordFix{Position: 2, Word: "garlik", Corrected: "garlic"}, fix)
+
+	// a known but wrong word is searched at every position, the candidates must have a valid checksum
+	tried := 0
+	fix, err = hdwallet.FixSingleWord(strings.Replace(testMnemonic, "hair", "hand", 1), hdwallet.English, func(candidate string) bool {
+		tried++
+		diagnosis, _ := hdwallet.DiagnoseMnemonic(candidate, hdwallet.English)
+		assert.True(t, diagnosis.Valid())
+		return candidate == testMnemonic
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, &hdwallet.WordFix{Position: 13, Word: "hand", Corrected: "hair"}, fix)
+	assert.Less(t, tried, 13*2048/64)
+
+	// two unknown words are not searched
+	fix, err = hdwallet.FixSingleWord(strings.Replace(strings.Replace(testMnemonic, "garlic", "garlik", 1), "hair", "hiar", 1), hdwallet.English, matches)
+	assert.NoError(t, err)
+	assert.Nil(t, fix)
+}
@@ -6,6 +6,10 @@ const (
 	ChineseSimplified  = "chinese_simplified"
 	ChineseTraditional = "chinese_traditional"
 	Korean             = "korean"
+	Japanese           = "japanese"
+	French             = "french"
+	Italian            = "italian"
+	Spanish            = "spanish"
 )
 
 // zero is deafult of uint32
@@ -1,27 +1,70 @@
 package hdwallet
 
 import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/text/unicode/norm"
+
 	"recovery-tool/crypto/hdwallet/bip39"
 	"recovery-tool/crypto/hdwallet/bip39/wordlists"
 )
 
-func setLanguage(language string) {
-	switch language {
-	case ChineseSimplified:
-		bip39.SetWordList(wordlists.ChineseSimplified)
-	case ChineseTraditional:
-		bip39.SetWordList(wordlists.ChineseTraditional)
-	case Korean:
-		bip39.SetWordList(wordlists.Korean)
-	case English:
-		bip39.SetWordList(wordlists.English)
+// wordLists are the NFKD normalized word lists of the languages, the same form as NormalizeMnemonic
+var wordLists = map[string][]string{
+	English:            normalizeWords(wordlists.English),
+	ChineseSimplified:  normalizeWords(wordlists.ChineseSimplified),
+	ChineseTraditional: normalizeWords(wordlists.ChineseTraditional),
+	Japanese:           normalizeWords(wordlists.Japanese),
+	Korean:             normalizeWords(wordlists.Korean),
+	French:             normalizeWords(wordlists.French),
+	Italian:            normalizeWords(wordlists.Italian),
+	Spanish:            normalizeWords(wordlists.Spanish),
+}
+
+// languageMu guards the word list of bip39, which is shared by the package
+var languageMu sync.Mutex
+
+func normalizeWords(words []string) []string {
+	normalized := make([]string, len(words))
+	for i, word := range words {
+		normalized[i] = norm.NFKD.String(word)
+	}
+	return normalized
+}
+
+// IsLanguageSupported tells whether there is a word list of language
+func IsLanguageSupported(language string) bool {
+	_, ok := wordLists[language]
+	return ok
+}
+
+// WordList returns the NFKD normalized word list of language, nil if it is not supported
+func WordList(language string) []string {
+	return wordLists[language]
+}
+
+// NormalizeMnemonic returns the NFKD form of mnemonic with the words separated by single spaces.
+// The ideographic spaces of the Japanese mnemonics are normalized to spaces as well.
+func NormalizeMnemonic(mnemonic string) string {
+	return strings.Join(strings.Fields(norm.NFKD.String(mnemonic)), " ")
+}
+
+func withLanguage(language string, f func() error) error {
+	list, ok := wordLists[language]
+	if !ok {
+		return fmt.Errorf("unsupported mnemonic language: %s", language)
 	}
+
+	languageMu.Lock()
+	defer languageMu.Unlock()
+	bip39.SetWordList(list)
+	return f()
 }
 
 // NewMnemonic creates a random mnemonic
 func NewMnemonic(length int, language string) (string, error) {
-	setLanguage(language)
-
 	if length < 12 {
 		length = 12
 	}
@@ -35,11 +78,48 @@ func NewMnemonic(length int, language string) (string, error) {
 		return "", err
 	}
 
-	return bip39.NewMnemonic(entropy)
+	var mnemonic string
+	err = withLanguage(language, func() error {
+		mnemonic, err = bip39.NewMnemonic(entropy)
+		return err
+	})
+	return mnemonic, err
 }
 
-// NewSeed creates a hashed seed
+// EntropyToMnemonic encodes entropy of 16 to 32 bytes, a multiple of 4, as a mnemonic
+func EntropyToMnemonic(entropy []byte, language string) (string, error) {
+	var mnemonic string
+	err := withLanguage(language, func() error {
+		var err error
+		mnemonic, err = bip39.NewMnemonic(entropy)
+		return err
+	})
+	return mnemonic, err
+}
+
+// MnemonicToEntropy decodes the entropy of a mnemonic, checking its checksum
+func MnemonicToEntropy(mnemonic, language string) ([]byte, error) {
+	mnemonic = NormalizeMnemonic(mnemonic)
+
+	var entropy []byte
+	err := withLanguage(language, func() error {
+		var err error
+		entropy, err = bip39.EntropyFromMnemonic(mnemonic)
+		return err
+	})
+	return entropy, err
+}
+
+// NewSeed creates a hashed seed, the mnemonic and the password are NFKD normalized as BIP39 specifies
 func NewSeed(mnemonic, password, language string) ([]byte, error) {
-	setLanguage(language)
-	return bip39.NewSeedWithErrorChecking(mnemonic, password)
+	mnemonic = NormalizeMnemonic(mnemonic)
+	password = norm.NFKD.String(password)
+
+	var seed []byte
+	err := withLanguage(language, func() error {
+		var err error
+		seed, err = bip39.NewSeedWithErrorChecking(mnemonic, password)
+		return err
+	})
+	return seed, err
 }
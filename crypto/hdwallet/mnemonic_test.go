@@ -0,0 +1,28 @@
+package hdwallet_test
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"recovery-tool/crypto/hdwallet"
+)
+
+func TestMnemonicEntropy(t *testing.T) {
+	// BIP39 test vector
+	entropy, _ := hex.DecodeString("ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+	mnemonic, err := hdwallet.EntropyToMnemonic(entropy, hdwallet.English)
+	assert.NoError(t, err)
+	assert.Equal(t, strings.TrimSpace(strings.Repeat("zoo ", 23))+" vote", mnemonic)
+
+	decoded, err := hdwallet.MnemonicToEntropy("  "+strings.ReplaceAll(mnemonic, " ", "  ")+"\n", hdwallet.English)
+	assert.NoError(t, err)
+	assert.Equal(t, entropy, decoded)
+
+	_, err = hdwallet.MnemonicToEntropy(strings.Repeat("zoo ", 24), hdwallet.English)
+	assert.Error(t, err)
+	_, err = hdwallet.EntropyToMnemonic(entropy[:31], hdwallet.English)
+	assert.Error(t, err)
+}
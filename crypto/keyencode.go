@@ -0,0 +1,157 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+
+	ecies "github.com/ecies/go/v2"
+	"golang.org/x/crypto/pbkdf2"
+
+	"recovery-tool/crypto/secure"
+)
+
+// the PBKDF2 iterations of the keys encrypted by EncryptPKCS8
+var pkcs8Iterations = 600000
+
+const pkcs8SaltLen = 16
+
+// MarshalRsaPrivKey encodes key as a PKCS#8 PEM, encrypted with PBES2 if password is not empty
+func MarshalRsaPrivKey(key *rsa.PrivateKey, password []byte) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	defer secure.Wipe(der)
+	return marshalPKCS8(der, password)
+}
+
+// MarshalEciesPrivKey encodes key as a PKCS#8 PEM of secp256k1, encrypted with PBES2 if password is not empty
+func MarshalEciesPrivKey(key *ecies.PrivateKey, password []byte) ([]byte, error) {
+	scalar := key.Bytes()
+	defer secure.Wipe(scalar)
+	sec1, err := asn1.Marshal(ecPrivateKey{
+		Version:    1,
+		PrivateKey: scalar,
+		PublicKey:  asn1.BitString{Bytes: key.PublicKey.Bytes(false), BitLength: 8 * 65},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer secure.Wipe(sec1)
+
+	curve, err := asn1.Marshal(oidSecp256k1)
+	if err != nil {
+		return nil, err
+	}
+	der, err := asn1.Marshal(pkcs8{
+		Algo:       pkix.AlgorithmIdentifier{Algorithm: oidPublicKeyECDSA, Parameters: asn1.RawValue{FullBytes: curve}},
+		PrivateKey: sec1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer secure.Wipe(der)
+	return marshalPKCS8(der, password)
+}
+
+func marshalPKCS8(der []byte, password []byte) ([]byte, error) {
+	if len(password) == 0 {
+		return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+	}
+	encrypted, err := EncryptPKCS8(der, password)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: encrypted}), nil
+}
+
+// EncryptPKCS8 encrypts a PKCS#8 private key into EncryptedPrivateKeyInfo,
+// with PBES2 of PBKDF2-HMAC-SHA256 and AES-256-CBC, the same as `openssl pkcs8 -topk8 -v2 aes-256-cbc`
+func EncryptPKCS8(der []byte, password []byte) ([]byte, error) {
+	if len(password) == 0 {
+		return nil, errors.New("empty password")
+	}
+	salt := make([]byte, pkcs8SaltLen)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+
+	key := pbkdf2.Key(password, salt, pkcs8Iterations, 32, sha256.New)
+	defer secure.Wipe(key)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	padding := aes.BlockSize - len(der)%aes.BlockSize
+	padded := make([]byte, len(der)+padding)
+	defer secure.Wipe(padded)
+	copy(padded, der)
+	for i := len(der); i < len(padded); i++ {
+		padded[i] = byte(padding)
+	}
+	encrypted := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, padded)
+
+	kdfParams, err := asn1.Marshal(pbkdf2Params{
+		Salt:           salt,
+		IterationCount: pkcs8Iterations,
+		PRF:            pkix.AlgorithmIdentifier{Algorithm: oidHMACWithSHA256, Parameters: asn1.NullRawValue},
+	})
+	if err != nil {
+		return nil, err
+	}
+	ivParams, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, err
+	}
+	params, err := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: pkix.AlgorithmIdentifier{Algorithm: oidPBKDF2, Parameters: asn1.RawValue{FullBytes: kdfParams}},
+		EncryptionScheme:  pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: ivParams}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(encryptedPKCS8{
+		Algo:          pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: params}},
+		EncryptedData: encrypted,
+	})
+}
+
+// MarshalRsaPubKey encodes key as a PKIX PEM, which ParseRsaPubKey reads
+func MarshalRsaPubKey(key *rsa.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+// RsaPubKeyFingerprint is the SHA-256 of the PKIX DER of key in hex, the same as
+// `openssl pkey -pubin -outform DER | sha256sum`
+func RsaPubKeyFingerprint(key *rsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// EciesPubKeyFingerprint is the SHA-256 of the compressed key in hex
+func EciesPubKeyFingerprint(key *ecies.PublicKey) string {
+	sum := sha256.Sum256(key.Bytes(true))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,499 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"strings"
+
+	s256k1 "github.com/btcsuite/btcd/btcec/v2"
+	ecies "github.com/ecies/go/v2"
+	"golang.org/x/crypto/pbkdf2"
+
+	"recovery-tool/crypto/secure"
+)
+
+// The errors of the key loader, wrapped with the details, tell apart why a key cannot be loaded
+var (
+	ErrKeyFormat           = errors.New("unsupported private key format")
+	ErrKeyType             = errors.New("unexpected private key type")
+	ErrKeyPasswordRequired = errors.New("the private key is encrypted, a password is required")
+	ErrKeyPassword         = errors.New("wrong password of the private key")
+)
+
+// PasswordFunc returns the password of an encrypted key, it is only called for an encrypted key
+type PasswordFunc func() ([]byte, error)
+
+var (
+	oidPublicKeyECDSA = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidSecp256k1      = asn1.ObjectIdentifier{1, 3, 132, 0, 10}
+
+	oidPBES2  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA224 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 8}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+
+	oidAES128CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidDESEDE3CBC = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+)
+
+// the most PBKDF2 iterations of an encrypted key, the keys of EncryptPKCS8 and openssl use far fewer
+const pbkdf2MaxIterations = 10000000
+
+// secp256k1Key is the scalar of a secp256k1 private key, which the x509 package does not support
+type secp256k1Key []byte
+
+// pkcs8 is PrivateKeyInfo of RFC 5208
+type pkcs8 struct {
+	Version    int
+	Algo       pkix.AlgorithmIdentifier
+	PrivateKey []byte
+}
+
+// ecPrivateKey is ECPrivateKey of RFC 5915 (SEC1)
+type ecPrivateKey struct {
+	Version       int
+	PrivateKey    []byte
+	NamedCurveOID asn1.ObjectIdentifier `asn1:"optional,explicit,tag:0"`
+	PublicKey     asn1.BitString        `asn1:"optional,explicit,tag:1"`
+}
+
+// encryptedPKCS8 is EncryptedPrivateKeyInfo of RFC 5208
+type encryptedPKCS8 struct {
+	Algo          pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// jwk is a private JSON Web Key of RFC 7517, EC on secp256k1 or RSA
+type jwk struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	D   string `json:"d"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	P   string `json:"p"`
+	Q   string `json:"q"`
+}
+
+// LoadRsaPrivKey loads an RSA private key of PKCS#8 (optionally encrypted with PBES2), PKCS#1 (optionally with
+// the legacy PEM encryption) or JWK. The PEM may be hex encoded as well. password is called for an encrypted key.
+func LoadRsaPrivKey(data string, password PasswordFunc) (*rsa.PrivateKey, error) {
+	key, err := loadPrivKey(data, password)
+	if err != nil {
+		return nil, err
+	}
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return k, nil
+	case secp256k1Key:
+		secure.Wipe(k)
+		return nil, fmt.Errorf("%w: a secp256k1 key, not an RSA key", ErrKeyType)
+	}
+	return nil, fmt.Errorf("%w: %s, not an RSA key", ErrKeyType, keyTypeName(key))
+}
+
+// LoadEciesPrivKey loads a secp256k1 private key of hex, SEC1 (optionally with the legacy PEM encryption),
+// PKCS#8 (optionally encrypted with PBES2) or JWK. password is called for an encrypted key.
+func LoadEciesPrivKey(data string, password PasswordFunc) (*ecies.PrivateKey, error) {
+	trimmed := strings.TrimSpace(data)
+	if decoded, err := hex.DecodeString(trimmed); err == nil && len(decoded) <= 32 {
+		defer secure.Wipe(decoded)
+		return newEciesPrivKey(decoded)
+	}
+
+	key, err := loadPrivKey(data, password)
+	if err != nil {
+		return nil, err
+	}
+	if k, ok := key.(secp256k1Key); ok {
+		defer secure.Wipe(k)
+		return newEciesPrivKey(k)
+	}
+	return nil, fmt.Errorf("%w: %s, not a secp256k1 key", ErrKeyType, keyTypeName(key))
+}
+
+func newEciesPrivKey(scalar []byte) (*ecies.PrivateKey, error) {
+	d := new(big.Int).SetBytes(scalar)
+	defer secure.WipeBigInt(d)
+	if d.Sign() == 0 || d.Cmp(s256k1.S256().Params().N) >= 0 {
+		return nil, errors.New("the secp256k1 private key is out of range")
+	}
+	return ecies.NewPrivateKeyFromBytes(scalar), nil
+}
+
+func keyTypeName(key interface{}) string {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return "an RSA key"
+	case *ecdsa.PrivateKey:
+		return fmt.Sprintf("an EC key on %s", k.Curve.Params().Name)
+	case ed25519.PrivateKey:
+		return "an ed25519 key"
+	}
+	return fmt.Sprintf("a %T key", key)
+}
+
+// loadPrivKey detects the format of data, and returns *rsa.PrivateKey, secp256k1Key or another key of the x509 package
+func loadPrivKey(data string, password PasswordFunc) (interface{}, error) {
+	trimmed := strings.TrimSpace(data)
+	if strings.HasPrefix(trimmed, "{") {
+		return parseJWK([]byte(trimmed))
+	}
+
+	pemData := []byte(trimmed)
+	if decoded, err := hex.DecodeString(trimmed); err == nil {
+		defer secure.Wipe(decoded)
+		pemData = decoded
+	}
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, fmt.Errorf("%w: neither PEM nor JWK", ErrKeyFormat)
+	}
+	defer secure.Wipe(block.Bytes)
+
+	der := block.Bytes
+	// the legacy PEM encryption of OpenSSL is deprecated, but still used for PKCS#1 and SEC1 keys
+	legacyEncrypted := x509.IsEncryptedPEMBlock(block)
+	if legacyEncrypted {
+		pass, err := readPassword(password)
+		if err != nil {
+			return nil, err
+		}
+		der, err = x509.DecryptPEMBlock(block, pass)
+		if err != nil {
+			if errors.Is(err, x509.IncorrectPasswordError) {
+				return nil, ErrKeyPassword
+			}
+			return nil, fmt.Errorf("%w: %s", ErrKeyFormat, err)
+		}
+		defer secure.Wipe(der)
+	}
+
+	switch block.Type {
+	case "ENCRYPTED PRIVATE KEY":
+		pass, err := readPassword(password)
+		if err != nil {
+			return nil, err
+		}
+		decrypted, err := decryptPKCS8(der, pass)
+		if err != nil {
+			return nil, err
+		}
+		defer secure.Wipe(decrypted)
+		key, err := parsePKCS8(decrypted)
+		if err != nil {
+			// a wrong password may pass the padding check by chance
+			return nil, ErrKeyPassword
+		}
+		return key, nil
+	case "PRIVATE KEY":
+		return parsePKCS8(der)
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(der)
+		if err != nil && legacyEncrypted {
+			// a wrong password may pass the padding check by chance
+			return nil, ErrKeyPassword
+		}
+		return key, err
+	case "EC PRIVATE KEY":
+		key, err := parseSEC1(der, nil)
+		if err != nil && legacyEncrypted {
+			// a wrong password may pass the padding check by chance
+			return nil, ErrKeyPassword
+		}
+		return key, err
+	}
+	return nil, fmt.Errorf("%w: PEM block %q", ErrKeyFormat, block.Type)
+}
+
+func readPassword(password PasswordFunc) ([]byte, error) {
+	if password == nil {
+		return nil, ErrKeyPasswordRequired
+	}
+	pass, err := password()
+	if err != nil {
+		return nil, err
+	}
+	if len(pass) == 0 {
+		return nil, ErrKeyPasswordRequired
+	}
+	return pass, nil
+}
+
+// parsePKCS8 parses the keys of the x509 package, and the secp256k1 keys which it rejects
+func parsePKCS8(der []byte) (interface{}, error) {
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err == nil {
+		return key, nil
+	}
+
+	var info pkcs8
+	if _, asn1Err := asn1.Unmarshal(der, &info); asn1Err != nil {
+		return nil, err
+	}
+	if !info.Algo.Algorithm.Equal(oidPublicKeyECDSA) {
+		return nil, err
+	}
+	var curve asn1.ObjectIdentifier
+	if _, asn1Err := asn1.Unmarshal(info.Algo.Parameters.FullBytes, &curve); asn1Err != nil {
+		return nil, fmt.Errorf("invalid EC parameters: %s", asn1Err)
+	}
+	return parseSEC1(info.PrivateKey, curve)
+}
+
+// parseSEC1 parses a secp256k1 key, the curve is given by PKCS#8 or else written in the key
+func parseSEC1(der []byte, curve asn1.ObjectIdentifier) (interface{}, error) {
+	var key ecPrivateKey
+	if _, err := asn1.Unmarshal(der, &key); err != nil {
+		return nil, fmt.Errorf("invalid EC private key: %s", err)
+	}
+	defer secure.Wipe(key.PrivateKey)
+	if curve == nil {
+		curve = key.NamedCurveOID
+	}
+	if !curve.Equal(oidSecp256k1) {
+		if ecKey, err := x509.ParseECPrivateKey(der); err == nil {
+			return ecKey, nil
+		}
+		return nil, fmt.Errorf("%w: an EC key on curve %s, not secp256k1", ErrKeyType, curve)
+	}
+	if len(key.PrivateKey) > 32 {
+		return nil, fmt.Errorf("invalid secp256k1 private key length: %d", len(key.PrivateKey))
+	}
+
+	scalar := make([]byte, 32)
+	copy(scalar[32-len(key.PrivateKey):], key.PrivateKey)
+	if len(key.PublicKey.Bytes) > 0 && !matchPubKey(scalar, key.PublicKey.Bytes) {
+		secure.Wipe(scalar)
+		return nil, errors.New("the public key of the EC private key does not match")
+	}
+	return secp256k1Key(scalar), nil
+}
+
+// matchPubKey tells whether pubKey, compressed or not, is the public key of the secp256k1 scalar
+func matchPubKey(scalar []byte, pubKey []byte) bool {
+	priv := ecies.NewPrivateKeyFromBytes(scalar)
+	defer secure.WipeBigInt(priv.D)
+	return bytes.Equal(priv.PublicKey.Bytes(true), pubKey) || bytes.Equal(priv.PublicKey.Bytes(false), pubKey)
+}
+
+// decryptPKCS8 decrypts an EncryptedPrivateKeyInfo of PBES2 with PBKDF2, and AES-CBC or DES-EDE3-CBC
+func decryptPKCS8(der []byte, password []byte) ([]byte, error) {
+	var info encryptedPKCS8
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("%w: invalid encrypted PKCS#8: %s", ErrKeyFormat, err)
+	}
+	if !info.Algo.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("%w: encryption %s, only PBES2 is supported", ErrKeyFormat, info.Algo.Algorithm)
+	}
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algo.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("%w: invalid PBES2 parameters: %s", ErrKeyFormat, err)
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("%w: key derivation %s, only PBKDF2 is supported", ErrKeyFormat, params.KeyDerivationFunc.Algorithm)
+	}
+	var kdfParams pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdfParams); err != nil {
+		return nil, fmt.Errorf("%w: invalid PBKDF2 parameters: %s", ErrKeyFormat, err)
+	}
+
+	// the count comes from the file, a huge one would hang the tool before the password is even checked
+	if kdfParams.IterationCount <= 0 || kdfParams.IterationCount > pbkdf2MaxIterations {
+		return nil, fmt.Errorf("%w: PBKDF2 iteration count %d, expected 1 to %d", ErrKeyFormat, kdfParams.IterationCount, pbkdf2MaxIterations)
+	}
+
+	prf, err := pbkdf2PRF(kdfParams.PRF.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	newCipher, keyLen, err := pbes2Cipher(params.EncryptionScheme.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if kdfParams.KeyLength != 0 && kdfParams.KeyLength != keyLen {
+		return nil, fmt.Errorf("%w: key length %d of PBKDF2, expected %d", ErrKeyFormat, kdfParams.KeyLength, keyLen)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, fmt.Errorf("%w: invalid IV: %s", ErrKeyFormat, err)
+	}
+
+	key := pbkdf2.Key(password, kdfParams.Salt, kdfParams.IterationCount, keyLen, prf)
+	defer secure.Wipe(key)
+	block, err := newCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != block.BlockSize() || len(info.EncryptedData) == 0 || len(info.EncryptedData)%block.BlockSize() != 0 {
+		return nil, fmt.Errorf("%w: invalid IV or encrypted data length", ErrKeyFormat)
+	}
+
+	decrypted := make([]byte, len(info.EncryptedData))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(decrypted, info.EncryptedData)
+	unpadded, ok := unpadPKCS7(decrypted, block.BlockSize())
+	if !ok {
+		secure.Wipe(decrypted)
+		return nil, ErrKeyPassword
+	}
+	return unpadded, nil
+}
+
+func pbkdf2PRF(oid asn1.ObjectIdentifier) (func() hash.Hash, error) {
+	switch {
+	case len(oid) == 0, oid.Equal(oidHMACWithSHA1):
+		return sha1.New, nil
+	case oid.Equal(oidHMACWithSHA224):
+		return sha256.New224, nil
+	case oid.Equal(oidHMACWithSHA256):
+		return sha256.New, nil
+	case oid.Equal(oidHMACWithSHA384):
+		return sha512.New384, nil
+	case oid.Equal(oidHMACWithSHA512):
+		return sha512.New, nil
+	}
+	return nil, fmt.Errorf("%w: PBKDF2 PRF %s", ErrKeyFormat, oid)
+}
+
+func pbes2Cipher(oid asn1.ObjectIdentifier) (func(key []byte) (cipher.Block, error), int, error) {
+	switch {
+	case oid.Equal(oidAES128CBC):
+		return aes.NewCipher, 16, nil
+	case oid.Equal(oidAES192CBC):
+		return aes.NewCipher, 24, nil
+	case oid.Equal(oidAES256CBC):
+		return aes.NewCipher, 32, nil
+	case oid.Equal(oidDESEDE3CBC):
+		return des.NewTripleDESCipher, 24, nil
+	}
+	return nil, 0, fmt.Errorf("%w: PBES2 encryption scheme %s", ErrKeyFormat, oid)
+}
+
+func unpadPKCS7(data []byte, blockSize int) ([]byte, bool) {
+	padding := int(data[len(data)-1])
+	if padding == 0 || padding > blockSize || padding > len(data) {
+		return nil, false
+	}
+	for _, b := range data[len(data)-padding:] {
+		if int(b) != padding {
+			return nil, false
+		}
+	}
+	return data[:len(data)-padding], true
+}
+
+// parseJWK parses an EC key on secp256k1 or an RSA key with its primes
+func parseJWK(data []byte) (interface{}, error) {
+	var key jwk
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, fmt.Errorf("%w: invalid JWK: %s", ErrKeyFormat, err)
+	}
+	if len(key.D) == 0 {
+		return nil, fmt.Errorf("%w: the JWK has no private key", ErrKeyType)
+	}
+
+	switch key.Kty {
+	case "EC":
+		if key.Crv != "secp256k1" && key.Crv != "P-256K" {
+			return nil, fmt.Errorf("%w: a JWK on curve %s, not secp256k1", ErrKeyType, key.Crv)
+		}
+		d, err := decodeJWKField("d", key.D)
+		if err != nil {
+			return nil, err
+		}
+		defer secure.Wipe(d)
+		if len(d) > 32 {
+			return nil, fmt.Errorf("invalid secp256k1 private key length: %d", len(d))
+		}
+		scalar := make([]byte, 32)
+		copy(scalar[32-len(d):], d)
+		if len(key.X) > 0 && len(key.Y) > 0 {
+			x, errX := decodeJWKField("x", key.X)
+			y, errY := decodeJWKField("y", key.Y)
+			if errX != nil || errY != nil {
+				secure.Wipe(scalar)
+				return nil, fmt.Errorf("%w: invalid JWK public key", ErrKeyFormat)
+			}
+			pubKey := elliptic.Marshal(s256k1.S256(), new(big.Int).SetBytes(x), new(big.Int).SetBytes(y))
+			if !matchPubKey(scalar, pubKey) {
+				secure.Wipe(scalar)
+				return nil, errors.New("the public key of the JWK does not match")
+			}
+		}
+		return secp256k1Key(scalar), nil
+	case "RSA":
+		if len(key.P) == 0 || len(key.Q) == 0 {
+			return nil, fmt.Errorf("%w: an RSA JWK without its primes", ErrKeyFormat)
+		}
+		fields := make([]*big.Int, 0, 5)
+		for _, field := range []struct{ name, value string }{{"n", key.N}, {"e", key.E}, {"d", key.D}, {"p", key.P}, {"q", key.Q}} {
+			value, err := decodeJWKField(field.name, field.value)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, new(big.Int).SetBytes(value))
+			secure.Wipe(value)
+		}
+		if !fields[1].IsInt64() || fields[1].Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA public exponent")
+		}
+		rsaKey := &rsa.PrivateKey{
+			PublicKey: rsa.PublicKey{N: fields[0], E: int(fields[1].Int64())},
+			D:         fields[2],
+			Primes:    []*big.Int{fields[3], fields[4]},
+		}
+		if err := rsaKey.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid RSA JWK: %s", err)
+		}
+		rsaKey.Precompute()
+		return rsaKey, nil
+	}
+	return nil, fmt.Errorf("%w: a JWK of kty %q", ErrKeyType, key.Kty)
+}
+
+func decodeJWKField(name, value string) ([]byte, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+	if err != nil || len(decoded) == 0 {
+		return nil, fmt.Errorf("%w: invalid JWK field %s", ErrKeyFormat, name)
+	}
+	return decoded, nil
+}
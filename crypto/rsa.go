@@ -5,28 +5,13 @@ import (
 	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
-	"encoding/hex"
 	"encoding/pem"
 	"errors"
 )
 
+// ParseRsaPrivKey parses an unencrypted RSA private key, see LoadRsaPrivKey for the formats
 func ParseRsaPrivKey(privKey string) (*rsa.PrivateKey, error) {
-	var block *pem.Block
-	decoded, err := hex.DecodeString(privKey)
-	if err == nil {
-		block, _ = pem.Decode(decoded)
-	} else {
-		block, _ = pem.Decode([]byte(privKey))
-	}
-
-	if block == nil {
-		return nil, errors.New("private key error")
-	}
-	privateKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
-	if err != nil {
-		return nil, err
-	}
-	return privateKey.(*rsa.PrivateKey), nil
+	return LoadRsaPrivKey(privKey, nil)
 }
 
 func ParseRsaPubKey(pubKey string) (*rsa.PublicKey, error) {
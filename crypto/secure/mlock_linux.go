@@ -0,0 +1,36 @@
+//go:build linux
+
+package secure
+
+import (
+	"syscall"
+)
+
+// MADV_DONTDUMP of linux, missing in syscall
+const madvDontDump = 0x10
+
+// alloc maps the buffer on its own pages, so that locking and unlocking it does not touch other memory.
+// It falls back to the heap if the pages cannot be mapped, and to unlocked pages if RLIMIT_MEMLOCK is reached.
+func alloc(size int) ([]byte, bool) {
+	if size == 0 {
+		return []byte{}, false
+	}
+	data, err := syscall.Mmap(-1, 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_ANON|syscall.MAP_PRIVATE)
+	if err != nil {
+		return make([]byte, size), false
+	}
+	// keeps the secrets out of the core dumps
+	_ = syscall.Madvise(data, madvDontDump)
+	if err = syscall.Mlock(data); err != nil {
+		return data, false
+	}
+	return data, true
+}
+
+func free(data []byte, locked bool) {
+	if locked {
+		_ = syscall.Munlock(data)
+	}
+	// the heap fallback is not mapped and fails with EINVAL, which is harmless
+	_ = syscall.Munmap(data)
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package secure
+
+// alloc allocates on the heap, the memory is not locked on this platform
+func alloc(size int) ([]byte, bool) {
+	return make([]byte, size), false
+}
+
+func free([]byte, bool) {}
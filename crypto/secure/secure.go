@@ -0,0 +1,65 @@
+// Package secure keeps the key material in buffers that are wiped explicitly instead of waiting for the GC,
+// and locked in RAM where the platform supports it, so that they are not swapped to disk.
+package secure
+
+import "math/big"
+
+// Buffer is a secret byte buffer, its memory is locked if possible and zeroed by Wipe
+type Buffer struct {
+	data   []byte
+	locked bool
+}
+
+// NewBuffer allocates a zeroed buffer of size bytes
+func NewBuffer(size int) *Buffer {
+	data, locked := alloc(size)
+	return &Buffer{data: data, locked: locked}
+}
+
+// Copy moves src into a new buffer, src is wiped
+func Copy(src []byte) *Buffer {
+	b := NewBuffer(len(src))
+	copy(b.data, src)
+	Wipe(src)
+	return b
+}
+
+// Bytes returns the content of the buffer, it must not be used after Wipe
+func (b *Buffer) Bytes() []byte {
+	return b.data
+}
+
+// Locked tells whether the memory of the buffer is locked in RAM
+func (b *Buffer) Locked() bool {
+	return b.locked
+}
+
+// Wipe zeroes and releases the buffer, it is safe to call more than once
+func (b *Buffer) Wipe() {
+	if b == nil || b.data == nil {
+		return
+	}
+	Wipe(b.data)
+	free(b.data, b.locked)
+	b.data = nil
+	b.locked = false
+}
+
+// Wipe zeroes b in place
+func Wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// WipeBigInt zeroes the words of a private scalar in place, once it is no longer needed
+func WipeBigInt(k *big.Int) {
+	if k == nil {
+		return
+	}
+	words := k.Bits()
+	for i := range words {
+		words[i] = 0
+	}
+	k.SetInt64(0)
+}
@@ -0,0 +1,42 @@
+package secure
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuffer(t *testing.T) {
+	src := []byte{1, 2, 3, 4}
+	b := Copy(src)
+	assert.Equal(t, []byte{0, 0, 0, 0}, src)
+	assert.Equal(t, []byte{1, 2, 3, 4}, b.Bytes())
+
+	// the mapped pages are released by Wipe, so only the heap fallback can be read after it
+	heap := &Buffer{data: []byte{1, 2, 3, 4}}
+	data := heap.Bytes()
+	heap.Wipe()
+	assert.Equal(t, []byte{0, 0, 0, 0}, data)
+
+	b.Wipe()
+	assert.Nil(t, b.Bytes())
+	assert.False(t, b.Locked())
+	b.Wipe()
+
+	empty := NewBuffer(0)
+	assert.Empty(t, empty.Bytes())
+	empty.Wipe()
+}
+
+func TestWipeBigInt(t *testing.T) {
+	scalar, _ := new(big.Int).SetString("9aa5eaa7c63f1e157b94896919dd4327d279b8265c4794100f28b78cae79be7d", 16)
+	words := scalar.Bits()
+	WipeBigInt(scalar)
+	WipeBigInt(nil)
+
+	assert.Equal(t, 0, scalar.Sign())
+	for _, word := range words {
+		assert.Zero(t, word)
+	}
+}
@@ -0,0 +1,127 @@
+// Package shamir splits a secret into shares of Shamir's secret sharing over GF(2^8), any threshold of them
+// reconstruct the secret, fewer tell nothing about it. Each byte of the secret is shared by its own polynomial.
+package shamir
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"recovery-tool/crypto/secure"
+)
+
+// MaxShares is the most shares of a secret, the indices of the shares are 1 to 255
+const MaxShares = 255
+
+// Share is the evaluation of the polynomials at Index
+type Share struct {
+	Index byte
+	Data  []byte
+}
+
+// Split splits secret into n shares, any threshold of which reconstruct it
+func Split(secret []byte, threshold, n int) ([]*Share, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("empty secret")
+	}
+	if threshold < 2 || threshold > n || n > MaxShares {
+		return nil, fmt.Errorf("invalid threshold %d of %d shares, requires 2 <= threshold <= shares <= %d", threshold, n, MaxShares)
+	}
+
+	shares := make([]*Share, n)
+	for i := range shares {
+		shares[i] = &Share{Index: byte(i + 1), Data: make([]byte, len(secret))}
+	}
+
+	// coeffs[0] is the secret byte, the others are random
+	coeffs := make([]byte, threshold)
+	defer secure.Wipe(coeffs)
+	for j, b := range secret {
+		coeffs[0] = b
+		if _, err := rand.Read(coeffs[1:]); err != nil {
+			return nil, err
+		}
+		for _, share := range shares {
+			share.Data[j] = evaluate(coeffs, share.Index)
+		}
+	}
+	return shares, nil
+}
+
+// Combine reconstructs the secret from the shares by the Lagrange interpolation at 0.
+// The shares must number at least the threshold of the split, or the result is garbage,
+// the caller checks the result against something known of the secret.
+func Combine(shares []*Share) ([]byte, error) {
+	if len(shares) < 2 {
+		return nil, errors.New("at least 2 shares are required")
+	}
+	length := len(shares[0].Data)
+	seen := make(map[byte]bool)
+	for _, share := range shares {
+		if share.Index == 0 {
+			return nil, errors.New("invalid share index 0")
+		}
+		if seen[share.Index] {
+			return nil, fmt.Errorf("duplicate share index %d", share.Index)
+		}
+		seen[share.Index] = true
+		if len(share.Data) != length || length == 0 {
+			return nil, errors.New("the shares differ in length")
+		}
+	}
+
+	// the Lagrange basis polynomials at 0: prod x_m / (x_m - x_i), subtraction is xor in GF(2^8)
+	basis := make([]byte, len(shares))
+	for i, share := range shares {
+		num, den := byte(1), byte(1)
+		for m, other := range shares {
+			if m == i {
+				continue
+			}
+			num = mul(num, other.Index)
+			den = mul(den, other.Index^share.Index)
+		}
+		basis[i] = mul(num, inverse(den))
+	}
+
+	secret := make([]byte, length)
+	for j := range secret {
+		var b byte
+		for i, share := range shares {
+			b ^= mul(share.Data[j], basis[i])
+		}
+		secret[j] = b
+	}
+	return secret, nil
+}
+
+// evaluate evaluates the polynomial of coeffs at x by Horner's method
+func evaluate(coeffs []byte, x byte) byte {
+	var y byte
+	for i := len(coeffs) - 1; i >= 0; i-- {
+		y = mul(y, x) ^ coeffs[i]
+	}
+	return y
+}
+
+// mul multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x + 1, without branching on the operands
+func mul(a, b byte) byte {
+	var p byte
+	for i := 0; i < 8; i++ {
+		p ^= -(b & 1) & a
+		carry := -(a >> 7)
+		a = a<<1 ^ carry&0x1b
+		b >>= 1
+	}
+	return p
+}
+
+// inverse is a^254, the multiplicative inverse of a non-zero a
+func inverse(a byte) byte {
+	result := byte(1)
+	for i := 0; i < 7; i++ {
+		a = mul(a, a)
+		result = mul(result, a)
+	}
+	return result
+}
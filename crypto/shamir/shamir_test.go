@@ -0,0 +1,73 @@
+package shamir
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestField(t *testing.T) {
+	// the multiplication of the AES field, FIPS-197 4.2
+	assert.Equal(t, byte(0xc1), mul(0x57, 0x83))
+	assert.Equal(t, byte(0xfe), mul(0x57, 0x13))
+	for a := 1; a < 256; a++ {
+		assert.Equal(t, byte(1), mul(byte(a), inverse(byte(a))), "inverse of %d", a)
+	}
+	assert.Equal(t, byte(0), mul(0, 0x57))
+}
+
+func TestSplitCombine(t *testing.T) {
+	secret, _ := hex.DecodeString("ea5db4366ad1de0a17f8b6b0ff3dd1dcea36e5b16c8d07a3f6d1f3d0a1c8501c")
+	shares, err := Split(secret, 3, 5)
+	assert.NoError(t, err)
+	assert.Len(t, shares, 5)
+	for i, share := range shares {
+		assert.Equal(t, byte(i+1), share.Index)
+		assert.Len(t, share.Data, len(secret))
+		assert.NotEqual(t, secret, share.Data)
+	}
+
+	// every subset of the threshold or more reconstructs the secret
+	for mask := 0; mask < 1<<5; mask++ {
+		var subset []*Share
+		for i := range shares {
+			if mask&(1<<i) != 0 {
+				subset = append(subset, shares[i])
+			}
+		}
+		if len(subset) < 2 {
+			continue
+		}
+		combined, err := Combine(subset)
+		assert.NoError(t, err)
+		assert.Equal(t, len(subset) >= 3, bytes.Equal(secret, combined), "shares %b", mask)
+	}
+
+	_, err = Combine(shares[:1])
+	assert.Error(t, err)
+	_, err = Combine([]*Share{shares[0], shares[0], shares[1]})
+	assert.Error(t, err)
+	_, err = Combine([]*Share{shares[0], {Index: 2, Data: []byte{1}}})
+	assert.Error(t, err)
+	_, err = Combine([]*Share{shares[0], {Index: 0, Data: shares[1].Data}})
+	assert.Error(t, err)
+}
+
+func TestSplitParams(t *testing.T) {
+	_, err := Split(nil, 2, 3)
+	assert.Error(t, err)
+	_, err = Split([]byte{1}, 1, 3)
+	assert.Error(t, err)
+	_, err = Split([]byte{1}, 4, 3)
+	assert.Error(t, err)
+	_, err = Split([]byte{1}, 2, 256)
+	assert.Error(t, err)
+
+	shares, err := Split([]byte{1, 2, 3}, 255, 255)
+	assert.NoError(t, err)
+	combined, err := Combine(shares)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1, 2, 3}, combined)
+}
@@ -41,6 +41,9 @@ require (
 	github.com/stretchr/testify v1.8.4
 	github.com/the729/lcs v0.1.5
 	github.com/tidwall/gjson v1.2.1
+	go.uber.org/zap v1.16.0
+	golang.org/x/term v0.15.0
+	golang.org/x/text v0.14.0
 )
 
 require (
@@ -64,7 +67,6 @@ require (
 	github.com/tidwall/pretty v0.0.0-20190325153808-1166b9ac2b65 // indirect
 	go.uber.org/atomic v1.7.0 // indirect
 	go.uber.org/multierr v1.6.0 // indirect
-	go.uber.org/zap v1.16.0 // indirect
 	golang.org/x/sys v0.15.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 	nhooyr.io/websocket v1.8.7 // indirect
@@ -1,19 +1,50 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"strings"
 	"time"
 
 	"recovery-tool/cmd"
 	"recovery-tool/common"
+	"recovery-tool/common/code"
 )
 
 func main() {
 	recoverCmd := flag.NewFlagSet("recover", flag.ExitOnError)
 	inputPath := recoverCmd.String("i", "./input.yaml", "The path of input parmas")
 	outputPath := recoverCmd.String("o", "./output.yaml", "The path of result")
+	discover := recoverCmd.Bool("discover", false, "Discover used vaults and addresses through the chain nodes")
+	addressesOnly := recoverCmd.Bool("addresses-only", false, "Output the addresses and public keys without the private keys")
+	fixMnemonic := recoverCmd.Bool("fix-mnemonic", false, "Try correcting one mistyped word of the mnemonic against the backups")
+	verifyPath := recoverCmd.String("verify", "", "A CSV or JSON file of expected addresses, output the verify report instead of the keys")
+	plaintext := recoverCmd.Bool("plaintext", false, "Output the private keys unencrypted, with file mode 0600")
+	encrypt := recoverCmd.String("encrypt", "", "Encrypt the output with passphrase, ecies or rsa, overrides output_encryption of the input")
+	recipient := recoverCmd.String("recipient", "", "The ECIES public key in hex or the RSA public key file, to encrypt the output to")
+
+	decryptOutputCmd := flag.NewFlagSet("decrypt-output", flag.ExitOnError)
+	decryptInput := decryptOutputCmd.String("i", "./output.yaml", "The path of encrypted output")
+	decryptOutput := decryptOutputCmd.String("o", "./output.plain.yaml", "The path of decrypted output")
+	decryptEcies := decryptOutputCmd.String("ecies", "", "The path of ECIES private key file, or prompt to type it, if the output is encrypted to an ECIES key")
+	decryptRsa := decryptOutputCmd.String("rsa", "", "The path of RSA private key file, or prompt to type it, if the output is encrypted to an RSA key")
+
+	keygenCmd := flag.NewFlagSet("keygen", flag.ExitOnError)
+	keygenOutput := keygenCmd.String("o", "./recovery_keys", "The directory of the generated keys")
+	keygenEncrypt := keygenCmd.Bool("encrypt-keys", false, "Encrypt the private keys with passwords, read from RECOVERY_ECIES_KEY_PASSWORD and RECOVERY_RSA_KEY_PASSWORD or prompted")
+
+	splitKeyCmd := flag.NewFlagSet("split-key", flag.ExitOnError)
+	splitEcies := splitKeyCmd.String("ecies", "", "The path of ECIES private key file, or prompt to type it, to split")
+	splitRsa := splitKeyCmd.String("rsa", "", "The path of RSA private key file, or prompt to type it, to split")
+	splitThreshold := splitKeyCmd.Int("k", 2, "The shares required to reconstruct a key")
+	splitShares := splitKeyCmd.Int("n", 3, "The shares of each key, one for each custodian")
+	splitOutput := splitKeyCmd.String("o", "./key_shares", "The directory of the share files")
+	splitEncoding := splitKeyCmd.String("encoding", cmd.ShareEncodingHex, "The encoding of the share data, hex or mnemonic")
+	splitEncrypt := splitKeyCmd.String("encrypt", "", "Encrypt the share files of each custodian with passphrase, ecies or rsa")
+	splitRecipients := splitKeyCmd.String("recipients", "", "Comma separated ECIES public keys in hex or RSA public key files, one for each share")
 
 	balanceCmd := flag.NewFlagSet("balance", flag.ExitOnError)
 	address := balanceCmd.String("addr", "", "address")
@@ -21,6 +52,22 @@ func main() {
 	chain := balanceCmd.String("chain", "sol", "Chain name, can be sol, apt or dot")
 	url := balanceCmd.String("url", "https://api.mainnet-beta.solana.com", "url")
 
+	inspectCmd := flag.NewFlagSet("inspect", flag.ExitOnError)
+	inspectZip := inspectCmd.String("zip", "", "The backup zip file, or a directory of them")
+	inspectEcies := inspectCmd.String("ecies", "", "The path of ECIES private key file, or prompt to type it, optional, to decrypt the user pubkeys")
+	inspectRsa := inspectCmd.String("rsa", "", "The path of RSA private key file, or prompt to type it, optional, to decrypt the user pubkeys")
+
+	watchOnlyCmd := flag.NewFlagSet("watch-only", flag.ExitOnError)
+	watchOnlyInput := watchOnlyCmd.String("i", "input.yaml", "The path of input file")
+	watchOnlyOutput := watchOnlyCmd.String("o", "watch_only.yaml", "The path of watch-only bundle file")
+
+	deriveAddressCmd := flag.NewFlagSet("derive-address", flag.ExitOnError)
+	deriveBundle := deriveAddressCmd.String("bundle", "watch_only.yaml", "The path of watch-only bundle file")
+	deriveWallet := deriveAddressCmd.String("wallet", "asset", "Wallet type: asset or api")
+	deriveVault := deriveAddressCmd.Int("vault", 1, "Vault index, starts from 1, ignored by api wallets")
+	deriveChain := deriveAddressCmd.String("chain", "", "Chain name")
+	deriveIndex := deriveAddressCmd.Int("index", 0, "Address index")
+
 	transferCmd := flag.NewFlagSet("transfer", flag.ExitOnError)
 	fromkey := transferCmd.String("fromkey", "", "Private key")
 	toAddress := transferCmd.String("to", "", "Address")
@@ -30,7 +77,7 @@ func main() {
 	chainUrl := transferCmd.String("url", "https://api.mainnet-beta.solana.com", "url")
 
 	if len(os.Args) < 2 {
-		fmt.Println("expected 'recover', 'balance' or 'transfer' subcommands")
+		fmt.Println("expected 'recover', 'decrypt-output', 'keygen', 'split-key', 'inspect', 'watch-only', 'derive-address', 'balance' or 'transfer' subcommands")
 		os.Exit(1)
 	}
 
@@ -38,14 +85,93 @@ func main() {
 	case "recover":
 		recoverCmd.Parse(os.Args[2:])
 
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		output := cmd.OutputEncryption{Mode: *encrypt, Recipient: *recipient}
+		if *plaintext {
+			if len(*encrypt) > 0 {
+				common.Logger.Errorf("-plaintext and -encrypt cannot be used together")
+				os.Exit(1)
+			}
+			output.Mode = cmd.OutputPlaintext
+		}
+
 		start := time.Now()
-		err := cmd.RecoverKeysCmd(*inputPath, *outputPath)
+		err := cmd.RecoverKeysCmd(ctx, *inputPath, *outputPath, cmd.RecoverOptions{
+			Discover:      *discover,
+			VerifyPath:    *verifyPath,
+			AddressesOnly: *addressesOnly,
+			FixMnemonic:   *fixMnemonic,
+			Output:        output,
+		})
+		if i18nErr, ok := err.(*code.I18nError); ok && i18nErr.Code == code.PartialRecoveryErr {
+			// the recovered keys are saved, exits with 2 to tell the partial success
+			common.Logger.Errorf("%s", err)
+			fmt.Printf("Output the partial result to file `%s`\n", *outputPath)
+			os.Exit(2)
+		}
+		if i18nErr, ok := err.(*code.I18nError); ok && i18nErr.Code == code.AddressMismatchErr {
+			common.Logger.Errorf("%s", err)
+			fmt.Printf("Output the verify report to file `%s`\n", *outputPath)
+			os.Exit(3)
+		}
 		if err != nil {
 			common.Logger.Errorf("%s", err)
 			os.Exit(1)
 		}
 		duration := time.Since(start)
 		fmt.Printf("Output the result to file `%s`, cost: %s \n ", *outputPath, duration.String())
+	case "decrypt-output":
+		decryptOutputCmd.Parse(os.Args[2:])
+
+		if err := cmd.DecryptOutputCmd(*decryptInput, *decryptOutput, *decryptEcies, *decryptRsa); err != nil {
+			common.Logger.Errorf("%s", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Output the decrypted result to file `%s`\n", *decryptOutput)
+	case "keygen":
+		keygenCmd.Parse(os.Args[2:])
+
+		if err := cmd.KeygenCmd(*keygenOutput, *keygenEncrypt); err != nil {
+			common.Logger.Errorf("%s", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Output the keys to directory `%s`, keep the private keys offline\n", *keygenOutput)
+	case "split-key":
+		splitKeyCmd.Parse(os.Args[2:])
+
+		var recipients []string
+		if len(*splitRecipients) > 0 {
+			recipients = strings.Split(*splitRecipients, ",")
+		}
+		if err := cmd.SplitKeyCmd(*splitEcies, *splitRsa, *splitThreshold, *splitShares, *splitOutput, *splitEncoding, *splitEncrypt, recipients); err != nil {
+			common.Logger.Errorf("%s", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Output the shares to directory `%s`, give share i of each key to custodian i\n", *splitOutput)
+	case "inspect":
+		inspectCmd.Parse(os.Args[2:])
+
+		if err := cmd.InspectCmd(*inspectZip, *inspectEcies, *inspectRsa); err != nil {
+			common.Logger.Errorf("%s", err)
+			os.Exit(1)
+		}
+	case "watch-only":
+		watchOnlyCmd.Parse(os.Args[2:])
+
+		if err := cmd.ExportWatchOnlyCmd(*watchOnlyInput, *watchOnlyOutput); err != nil {
+			common.Logger.Errorf("%s", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Output the watch-only bundle to file `%s`\n", *watchOnlyOutput)
+	case "derive-address":
+		deriveAddressCmd.Parse(os.Args[2:])
+
+		if err := cmd.DeriveAddressCmd(*deriveBundle, *deriveWallet, *deriveVault, *deriveChain, *deriveIndex); err != nil {
+			common.Logger.Errorf("%s", err)
+			os.Exit(1)
+		}
 	case "balance":
 		balanceCmd.Parse(os.Args[2:])
 
@@ -67,7 +193,7 @@ func main() {
 		}
 		fmt.Printf("tx: %s/%s\n", cmd.Scan(*chainName), txHash)
 	default:
-		fmt.Println("expected 'recover', 'balance' or 'transfer' subcommands")
+		fmt.Println("expected 'recover', 'decrypt-output', 'keygen', 'split-key', 'inspect', 'watch-only', 'derive-address', 'balance' or 'transfer' subcommands")
 		os.Exit(1)
 	}
 }
@@ -84,7 +84,22 @@ extern RSResult GetRSResult(GoString s);
 extern char* GetChainList1();
 extern RSResult GetChainList();
 extern char* MacGetChainList();
+/*
+  GoRecovery: data is the json array of the recovered keys,
+    [{"VaultIndex", "Chain", "Address", "PrivKey"}].
+  GoRecoveryV2: data is the json object of the recovery result, without private_key if addressesOnly is "true",
+    {"version": 2, "addresses_only", "mnemonic_fix": {"position"},
+     "backups": [{"archive", "entry"}],
+     "keys": [{"wallet_type", "vault_index", "chain", "coin_type", "sign_kind", "address_index", "address",
+               "public_key", "private_key", "balance"}],
+     "errors": [{"wallet_type", "vault_index", "chain", "coin_type", "sign_kind", "code", "message"}]}
+  Both return ok FALSE unless every chain is recovered, on a partial recovery errMsg tells it
+  and data still holds the keys recovered. data is plain malloc memory holding the private keys,
+  release it with GoWipeString once read, which zeroes it before freeing.
+*/
 extern RSResult GoRecovery(GoString zipPath, GoString userMnemonic, GoString eciesPrivKey, GoString rsaPrivKeyPath, GoString vaultCount, GoString chains, GoString language);
+extern RSResult GoRecoveryV2(GoString zipPath, GoString userMnemonic, GoString eciesPrivKey, GoString rsaPrivKeyPath, GoString vaultCount, GoString chains, GoString language, GoString addressesOnly);
+extern void GoWipeString(char* p);
 
 #ifdef __cplusplus
 }
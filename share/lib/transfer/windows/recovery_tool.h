@@ -84,7 +84,22 @@ extern __declspec(dllexport) RSResult GetRSResult(GoString s);
 extern __declspec(dllexport) char* GetChainList1();
 extern __declspec(dllexport) RSResult GetChainList();
 extern __declspec(dllexport) char* MacGetChainList();
+/*
+  GoRecovery: data is the json array of the recovered keys,
+    [{"VaultIndex", "Chain", "Address", "PrivKey"}].
+  GoRecoveryV2: data is the json object of the recovery result, without private_key if addressesOnly is "true",
+    {"version": 2, "addresses_only", "mnemonic_fix": {"position"},
+     "backups": [{"archive", "entry"}],
+     "keys": [{"wallet_type", "vault_index", "chain", "coin_type", "sign_kind", "address_index", "address",
+               "public_key", "private_key", "balance"}],
+     "errors": [{"wallet_type", "vault_index", "chain", "coin_type", "sign_kind", "code", "message"}]}
+  Both return ok FALSE unless every chain is recovered, on a partial recovery errMsg tells it
+  and data still holds the keys recovered. data is plain malloc memory holding the private keys,
+  release it with GoWipeString once read, which zeroes it before freeing.
+*/
 extern __declspec(dllexport) RSResult GoRecovery(GoString zipPath, GoString userMnemonic, GoString eciesPrivKey, GoString rsaPrivKeyPath, GoString vaultCount, GoString chains, GoString language);
+extern __declspec(dllexport) RSResult GoRecoveryV2(GoString zipPath, GoString userMnemonic, GoString eciesPrivKey, GoString rsaPrivKeyPath, GoString vaultCount, GoString chains, GoString language, GoString addressesOnly);
+extern __declspec(dllexport) void GoWipeString(char* p);
 extern __declspec(dllexport) RSResult GoBalance(GoString chain, GoString url, GoString addr, GoString coinAddress, GoString language);
 extern __declspec(dllexport) RSResult GoSign(GoString chain, GoString url, GoString privkey, GoString toAddr, GoString amount, GoString coinAddress, GoString language);
 extern __declspec(dllexport) RSResult GoTransfer(GoString chain, GoString url, GoString privkey, GoString toAddr, GoString amount, GoString coinAddress, GoString language);
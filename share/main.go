@@ -1,6 +1,10 @@
 package main
 
-//#include "file.h"
+/*
+#include <stdlib.h>
+#include <string.h>
+#include "file.h"
+*/
 import "C"
 
 import (
@@ -10,8 +14,10 @@ import (
 	"recovery-tool/cmd"
 	"recovery-tool/common"
 	"recovery-tool/common/code"
+	"recovery-tool/crypto/secure"
 	"strconv"
 	"strings"
+	"unsafe"
 )
 
 //export GetKey
@@ -60,34 +66,87 @@ func MacGetChainList() *C.char {
 	return C.CString(res)
 }
 
+// GoRecovery returns the keys as a json array with the Go field names. It is kept with its signature
+// for the existing callers, see GoRecoveryV2 for the errors of a partial recovery and the addresses only mode.
+// ok is FALSE unless every chain is recovered, the keys recovered are still in data.
+//
 //export GoRecovery
 func GoRecovery(zipPath, userMnemonic, eciesPrivKey, rsaPrivKeyPath, vaultCount, chains, language string) C.RSResult {
+	recoverResult, failed := recoverKeys(zipPath, userMnemonic, eciesPrivKey, rsaPrivKeyPath, vaultCount, chains, "", language)
+	if failed != nil {
+		return *failed
+	}
+
+	keys := make([]*legacyDeriveResult, 0, len(recoverResult.Keys))
+	for _, key := range recoverResult.Keys {
+		keys = append(keys, &legacyDeriveResult{VaultIndex: key.VaultIndex, Chain: key.Chain, Address: key.Address, PrivKey: key.PrivKey})
+	}
+	resBytes, _ := json.Marshal(keys)
+	return recoveryRSResult(recoverResult, resBytes, language)
+}
+
+// legacyDeriveResult is a key returned by GoRecovery, in the json of the first release
+type legacyDeriveResult struct {
+	VaultIndex int
+	Chain      string
+	Address    string
+	PrivKey    string
+}
+
+// RecoveryResultVersion is the version field of the json returned by GoRecoveryV2
+const RecoveryResultVersion = 2
+
+// recoveryResultV2 is the json returned by GoRecoveryV2:
+// {"version", "addresses_only", "mnemonic_fix", "backups", "keys", "errors"}
+type recoveryResultV2 struct {
+	Version int `json:"version"`
+	*cmd.RecoveryResult
+}
+
+// GoRecoveryV2 returns the recovery result as json, holding the keys and the errors of the failed chains.
+// addressesOnly is "true" to leave out the private keys, empty or "false" to recover them.
+// ok is FALSE unless every chain is recovered, errMsg then tells a partial recovery and data still holds the result.
+//
+//export GoRecoveryV2
+func GoRecoveryV2(zipPath, userMnemonic, eciesPrivKey, rsaPrivKeyPath, vaultCount, chains, language, addressesOnly string) C.RSResult {
+	recoverResult, failed := recoverKeys(zipPath, userMnemonic, eciesPrivKey, rsaPrivKeyPath, vaultCount, chains, addressesOnly, language)
+	if failed != nil {
+		return *failed
+	}
+
+	resBytes, _ := json.Marshal(&recoveryResultV2{Version: RecoveryResultVersion, RecoveryResult: recoverResult})
+	return recoveryRSResult(recoverResult, resBytes, language)
+}
+
+// recoverKeys recovers the keys of the FFI exports, or returns the result telling why nothing was recovered
+func recoverKeys(zipPath, userMnemonic, eciesPrivKey, rsaPrivKeyPath, vaultCount, chains, addressesOnly, language string) (*cmd.RecoveryResult, *C.RSResult) {
 	vaultCountInt, err := strconv.Atoi(vaultCount)
 	if err != nil {
-		return C.RSResult{
-			errMsg: C.CString(code.GetMessage(language, code.VaultIndexParamErr)),
-			data:   C.CString(""),
-			ok:     C.FALSE,
+		return nil, failedRSResult(code.GetMessage(language, code.VaultIndexParamErr))
+	}
+
+	addressesOnlyBool := false
+	if len(addressesOnly) > 0 {
+		addressesOnlyBool, err = strconv.ParseBool(addressesOnly)
+		if err != nil {
+			return nil, failedRSResult(code.GetMessage(language, code.ParamErr))
 		}
 	}
 
 	rsaBytes, err := os.ReadFile(rsaPrivKeyPath)
 	if err != nil {
-		return C.RSResult{
-			errMsg: C.CString(code.GetMessage(language, code.FileNotFound, "RSA")),
-			data:   C.CString(""),
-			ok:     C.FALSE,
-		}
+		return nil, failedRSResult(code.GetMessage(language, code.FileNotFound, "RSA"))
 	}
 
 	chainList := strings.Split(chains, ",")
 	input := cmd.RecoveryInput{
-		ZipPath:      zipPath,
-		UserMnemonic: userMnemonic,
-		EciesPrivKey: eciesPrivKey,
-		RsaPrivKey:   string(rsaBytes),
-		VaultCount:   vaultCountInt,
-		Chains:       chainList,
+		ZipPath:       zipPath,
+		UserMnemonic:  userMnemonic,
+		EciesPrivKey:  eciesPrivKey,
+		RsaPrivKey:    string(rsaBytes),
+		VaultCount:    vaultCountInt,
+		Chains:        chainList,
+		AddressesOnly: addressesOnlyBool,
 	}
 
 	recoverResult, err := cmd.RecoverKeys(input)
@@ -99,23 +158,61 @@ func GoRecovery(zipPath, userMnemonic, eciesPrivKey, rsaPrivKeyPath, vaultCount,
 		} else {
 			errMsg = err.Error()
 		}
+		return nil, failedRSResult(errMsg)
+	}
+	return recoverResult, nil
+}
+
+// recoveryRSResult returns the json of the recovered keys, ok is FALSE if some chains failed
+func recoveryRSResult(recoverResult *cmd.RecoveryResult, resBytes []byte, language string) C.RSResult {
+	// the root keys are wiped by RecoverKeys, the json of the child keys once it is copied to C
+	data := cSecretString(resBytes)
+	if len(recoverResult.Errors) > 0 {
+		// the keys recovered are still returned, along with the errors of the failed chains
 		return C.RSResult{
-			errMsg: C.CString(errMsg),
-			data:   C.CString(""),
+			errMsg: C.CString(code.GetMessage(language, code.PartialRecoveryErr)),
+			data:   data,
 			ok:     C.FALSE,
 		}
 	}
-
-	resBytes, _ := json.Marshal(recoverResult)
-	data := string(resBytes)
-	msg := code.GetMessage(language, code.Success)
 	return C.RSResult{
-		errMsg: C.CString(msg),
-		data:   C.CString(data),
+		errMsg: C.CString(code.GetMessage(language, code.Success)),
+		data:   data,
 		ok:     C.TRUE,
 	}
 }
 
+// cSecretString copies secret bytes into a NUL terminated C string, without a Go string in between, and wipes them.
+// The C string is ordinary malloc memory, neither locked nor wiped by Go: the caller owns it and should release it
+// with GoWipeString once read.
+func cSecretString(data []byte) *C.char {
+	defer secure.Wipe(data)
+	p := C.malloc(C.size_t(len(data) + 1))
+	buf := unsafe.Slice((*byte)(p), len(data)+1)
+	copy(buf, data)
+	buf[len(data)] = 0
+	return (*C.char)(p)
+}
+
+// GoWipeString zeroes and frees the data of a recovery result, the C string holding the private keys.
+//
+//export GoWipeString
+func GoWipeString(p *C.char) {
+	if p == nil {
+		return
+	}
+	C.memset(unsafe.Pointer(p), 0, C.strlen(p))
+	C.free(unsafe.Pointer(p))
+}
+
+func failedRSResult(errMsg string) *C.RSResult {
+	return &C.RSResult{
+		errMsg: C.CString(errMsg),
+		data:   C.CString(""),
+		ok:     C.FALSE,
+	}
+}
+
 //export GoBalance
 func GoBalance(chain, url, addr, coinAddress, language string) C.RSResult {
 	res, err := cmd.GetBalance(cmd.ShortChainName(chain), url, addr, coinAddress)
@@ -1,7 +1,16 @@
 package main
 
 import (
+	"encoding/json"
+	"os"
+	"path/filepath"
 	"testing"
+	"unsafe"
+
+	"github.com/alecthomas/gometalinter/_linters/src/gopkg.in/yaml.v2"
+	"github.com/stretchr/testify/assert"
+
+	"recovery-tool/cmd"
 )
 
 // must remove import "C"
@@ -25,3 +34,57 @@ func TestGoRecoveryTest(t *testing.T) {
 	//err = GoRecoveryTest(input.ZipPath, input.UserMnemonic, input.EciesPrivKey, "./test/RSAKet", vaultCountStr, chainStr, "zh")
 	//fmt.Printf("err: %s", err)
 }
+
+// loadTestInput loads the params of input.yaml and writes its RSA key to a file, as the exports read it from one
+func loadTestInput(t *testing.T) (cmd.RecoveryInput, string) {
+	data, err := os.ReadFile("../input.yaml")
+	assert.NoError(t, err)
+	var input cmd.RecoveryInput
+	assert.NoError(t, yaml.UnmarshalStrict(data, &input))
+
+	rsaKeyPath := filepath.Join(t.TempDir(), "rsa.pem")
+	assert.NoError(t, os.WriteFile(rsaKeyPath, []byte(input.RsaPrivKey), 0600))
+	return input, rsaKeyPath
+}
+
+func TestGoRecovery(t *testing.T) {
+	input, rsaKeyPath := loadTestInput(t)
+	zipPath := "../" + input.ZipPath
+
+	res := GoRecovery(zipPath, input.UserMnemonic, input.EciesPrivKey, rsaKeyPath, "1", "Bitcoin,Solana", "en")
+	assert.EqualValues(t, 1, res.ok)
+	var keys []*legacyDeriveResult
+	assert.NoError(t, json.Unmarshal(cBytes(unsafe.Pointer(res.data)), &keys))
+	if assert.Len(t, keys, 2) {
+		assert.NotEmpty(t, keys[1].PrivKey)
+	}
+	GoWipeString(res.data)
+
+	res = GoRecoveryV2(zipPath, input.UserMnemonic, input.EciesPrivKey, rsaKeyPath, "1", "Bitcoin,Solana", "en", "true")
+	assert.EqualValues(t, 1, res.ok)
+	assert.NotContains(t, string(cBytes(unsafe.Pointer(res.data))), "private_key")
+	GoWipeString(res.data)
+
+	res = GoRecoveryV2(zipPath, input.UserMnemonic, input.EciesPrivKey, rsaKeyPath, "1", "Bitcoin,Solana", "en", "maybe")
+	assert.EqualValues(t, 0, res.ok)
+}
+
+func TestCSecretString(t *testing.T) {
+	expected := `[{"PrivKey":"0f20"}]`
+	data := []byte(expected)
+	p := cSecretString(data)
+	assert.Equal(t, expected, string(cBytes(unsafe.Pointer(p))))
+	assert.Equal(t, make([]byte, len(data)), data)
+
+	GoWipeString(p)
+	GoWipeString(nil)
+}
+
+// cBytes copies the bytes of a NUL terminated C string
+func cBytes(p unsafe.Pointer) []byte {
+	var data []byte
+	for ; *(*byte)(p) != 0; p = unsafe.Add(p, 1) {
+		data = append(data, *(*byte)(p))
+	}
+	return data
+}
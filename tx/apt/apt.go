@@ -59,9 +59,14 @@ func (c *Apt) GetBlockNumber() (uint64, error) {
 }
 
 func (c *Apt) Balance(address string) (balance decimal.Decimal, amount string, err error) {
+	return c.BalanceWithContext(context.Background(), address)
+}
+
+// BalanceWithContext is Balance, the request is canceled once ctx is done
+func (c *Apt) BalanceWithContext(ctx context.Context, address string) (balance decimal.Decimal, amount string, err error) {
 	var res *client.AccountResource
 	res, err = c.Client.GetResourceByAccountAddressAndResourceType(
-		context.Background(),
+		ctx,
 		address, "0x1::coin::CoinStore<0x1::aptos_coin::AptosCoin>",
 	)
 	if err != nil {
@@ -101,7 +106,12 @@ func (c *Apt) BalanceOf(address string) (balance decimal.Decimal, err error) {
 }
 
 func (c *Apt) GetNonce(address string) (nonce uint64, err error) {
-	accountInfo, err := c.Client.GetAccount(context.Background(), address)
+	return c.GetNonceWithContext(context.Background(), address)
+}
+
+// GetNonceWithContext is GetNonce, the request is canceled once ctx is done
+func (c *Apt) GetNonceWithContext(ctx context.Context, address string) (nonce uint64, err error) {
+	accountInfo, err := c.Client.GetAccount(ctx, address)
 	if err != nil {
 		return 0, fmt.Errorf("GetNonce err %v", err)
 	}
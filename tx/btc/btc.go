@@ -0,0 +1,91 @@
+package btc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Btc queries addresses of bitcoin like chains through an esplora compatible api,
+// such as https://blockstream.info/api
+type Btc struct {
+	endpoint string
+	Decimals int
+}
+
+func NewBtc(url string) *Btc {
+	btc := new(Btc)
+	btc.endpoint = url
+	btc.Decimals = 8
+	return btc
+}
+
+type TxoStats struct {
+	FundedTxoSum int64 `json:"funded_txo_sum"`
+	SpentTxoSum  int64 `json:"spent_txo_sum"`
+	TxCount      int   `json:"tx_count"`
+}
+
+type AddressStats struct {
+	Address      string   `json:"address"`
+	ChainStats   TxoStats `json:"chain_stats"`
+	MempoolStats TxoStats `json:"mempool_stats"`
+}
+
+// TxCount returns the number of confirmed and unconfirmed transactions
+func (s *AddressStats) TxCount() int {
+	return s.ChainStats.TxCount + s.MempoolStats.TxCount
+}
+
+// Amount returns the confirmed balance in satoshi
+func (s *AddressStats) Amount() int64 {
+	return s.ChainStats.FundedTxoSum - s.ChainStats.SpentTxoSum
+}
+
+func (c *Btc) AddressStats(ctx context.Context, address string) (*AddressStats, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%v/address/%v", c.endpoint, address), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	httpclient := &http.Client{
+		Timeout: 120 * time.Second,
+	}
+	res, err := httpclient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, fmt.Errorf("get status code: %d", res.StatusCode)
+	}
+
+	var stats AddressStats
+	if err = json.Unmarshal(body, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+func (c *Btc) Balance(ctx context.Context, address string) (balance decimal.Decimal, amount string, err error) {
+	stats, err := c.AddressStats(ctx, address)
+	if err != nil {
+		return
+	}
+	return c.ToDecimal(stats.Amount()), fmt.Sprintf("%d", stats.Amount()), nil
+}
+
+func (c *Btc) ToDecimal(amount int64) decimal.Decimal {
+	return decimal.NewFromInt(amount).Div(decimal.NewFromFloat(math.Pow10(c.Decimals)))
+}
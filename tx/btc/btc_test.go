@@ -0,0 +1,42 @@
+package btc_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"recovery-tool/tx/btc"
+)
+
+func TestAddressStats(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/address/used":
+			w.Write([]byte(`{"address":"used","chain_stats":{"funded_txo_sum":150000000,"spent_txo_sum":50000000,"tx_count":3},"mempool_stats":{"funded_txo_sum":0,"spent_txo_sum":0,"tx_count":1}}`))
+		case "/address/redirect":
+			w.WriteHeader(http.StatusMultipleChoices)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+	client := btc.NewBtc(server.URL)
+
+	stats, err := client.AddressStats(context.Background(), "used")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, stats.TxCount())
+	assert.Equal(t, int64(100000000), stats.Amount())
+
+	balance, amount, err := client.Balance(context.Background(), "used")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", balance.String())
+	assert.Equal(t, "100000000", amount)
+
+	_, err = client.AddressStats(context.Background(), "redirect")
+	assert.EqualError(t, err, "get status code: 300")
+	_, err = client.AddressStats(context.Background(), "invalid")
+	assert.Error(t, err)
+}
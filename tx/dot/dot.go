@@ -1,6 +1,7 @@
 package dot
 
 import (
+	"context"
 	"encoding/hex"
 	"fmt"
 	"math"
@@ -98,8 +99,13 @@ func (c *Dot) GetBlockNumber() (uint64, error) {
 }
 
 func (c *Dot) Balance(address string) (balance decimal.Decimal, amount string, err error) {
+	return c.BalanceWithContext(context.Background(), address)
+}
+
+// BalanceWithContext is Balance, the request is canceled once ctx is done
+func (c *Dot) BalanceWithContext(ctx context.Context, address string) (balance decimal.Decimal, amount string, err error) {
 	var res AccountsBalanceInfoResponse
-	res, err = c.Client.AccountsBalanceInfo(address)
+	res, err = c.Client.AccountsBalanceInfoWithContext(ctx, address)
 
 	if err != nil {
 		return
@@ -119,8 +125,13 @@ func (c *Dot) SendRawTransaction(raw string) (txid string, err error) {
 }
 
 func (c *Dot) GetNonce(address string) (nonce uint64, err error) {
+	return c.GetNonceWithContext(context.Background(), address)
+}
+
+// GetNonceWithContext is GetNonce, the request is canceled once ctx is done
+func (c *Dot) GetNonceWithContext(ctx context.Context, address string) (nonce uint64, err error) {
 	var res AccountsBalanceInfoResponse
-	res, err = c.Client.AccountsBalanceInfo(address)
+	res, err = c.Client.AccountsBalanceInfoWithContext(ctx, address)
 	if err != nil {
 		return
 	}
@@ -7,11 +7,16 @@ import (
 )
 
 func (c *Client) AccountsBalanceInfo(address string) (AccountsBalanceInfoResponse, error) {
+	return c.AccountsBalanceInfoWithContext(context.Background(), address)
+}
+
+// AccountsBalanceInfoWithContext is AccountsBalanceInfo, the request is canceled once ctx is done
+func (c *Client) AccountsBalanceInfoWithContext(ctx context.Context, address string) (AccountsBalanceInfoResponse, error) {
 	res := struct {
 		GeneralResponse
 		AccountsBalanceInfoResponse
 	}{}
-	err := c.Get(context.Background(), fmt.Sprintf("%v/accounts/%v/balance-info", c.endpoint, address), nil, &res)
+	err := c.Get(ctx, fmt.Sprintf("%v/accounts/%v/balance-info", c.endpoint, address), nil, &res)
 	err = CheckRpcResult(res.GeneralResponse, err)
 
 	if err != nil {
@@ -0,0 +1,87 @@
+package evm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+type Client struct {
+	endpoint string
+}
+
+func NewClient(endpoint string) *Client {
+	return &Client{endpoint: endpoint}
+}
+
+type jsonRpcRequest struct {
+	JsonRpc string        `json:"jsonrpc"`
+	Id      uint64        `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type GeneralResponse struct {
+	JsonRPC string         `json:"jsonrpc"`
+	ID      uint64         `json:"id"`
+	Error   *ErrorResponse `json:"error,omitempty"`
+}
+
+type ErrorResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type hexResponse struct {
+	GeneralResponse
+	Result string `json:"result"`
+}
+
+// Call sends a json rpc request and returns the hex encoded result
+func (c *Client) Call(ctx context.Context, method string, params ...interface{}) (string, error) {
+	j, err := json.Marshal(jsonRpcRequest{
+		JsonRpc: "2.0",
+		Id:      1,
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to prepare payload, err: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.endpoint, bytes.NewBuffer(j))
+	if err != nil {
+		return "", fmt.Errorf("failed to do http.NewRequestWithContext, err: %v", err)
+	}
+	req.Header.Add("Content-Type", "application/json")
+
+	httpclient := &http.Client{
+		Timeout: 120 * time.Second,
+	}
+	res, err := httpclient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to do request, err: %v", err)
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read body, err: %v", err)
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return "", fmt.Errorf("get status code: %v", res.StatusCode)
+	}
+
+	var result hexResponse
+	if err = json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("rpc: failed to json decode body, err: %v", err)
+	}
+	if result.Error != nil {
+		return "", fmt.Errorf("rpc response error: %d %s", result.Error.Code, result.Error.Message)
+	}
+	return result.Result, nil
+}
@@ -0,0 +1,57 @@
+package evm
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// Evm queries accounts of ethereum compatible chains through json rpc
+type Evm struct {
+	Client   *Client
+	Decimals int
+}
+
+func NewEvm(url string) *Evm {
+	evm := new(Evm)
+	evm.Client = NewClient(url)
+	evm.Decimals = 18
+	return evm
+}
+
+func (c *Evm) Balance(ctx context.Context, address string) (balance decimal.Decimal, amount string, err error) {
+	res, err := c.Client.Call(ctx, "eth_getBalance", address, "latest")
+	if err != nil {
+		return
+	}
+	value, err := parseHexBig(res)
+	if err != nil {
+		return
+	}
+	balance = decimal.NewFromBigInt(value, 0).Div(decimal.NewFromFloat(math.Pow10(c.Decimals)))
+	return balance, value.String(), nil
+}
+
+func (c *Evm) GetNonce(ctx context.Context, address string) (nonce uint64, err error) {
+	res, err := c.Client.Call(ctx, "eth_getTransactionCount", address, "latest")
+	if err != nil {
+		return 0, err
+	}
+	value, err := parseHexBig(res)
+	if err != nil {
+		return 0, err
+	}
+	return value.Uint64(), nil
+}
+
+func parseHexBig(s string) (*big.Int, error) {
+	value, ok := new(big.Int).SetString(strings.TrimPrefix(s, "0x"), 16)
+	if !ok {
+		return nil, fmt.Errorf("invalid hex number: %s", s)
+	}
+	return value, nil
+}
@@ -0,0 +1,51 @@
+package evm_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"recovery-tool/tx/evm"
+)
+
+func TestEvm(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string        `json:"method"`
+			Params []interface{} `json:"params"`
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		w.WriteHeader(status)
+		switch {
+		case req.Params[0] == "0xbad":
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"error":{"code":-32602,"message":"invalid address"}}`))
+		case req.Method == "eth_getBalance":
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1bc16d674ec80000"}`))
+		case req.Method == "eth_getTransactionCount":
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x2a"}`))
+		}
+	}))
+	defer server.Close()
+	client := evm.NewEvm(server.URL)
+
+	balance, amount, err := client.Balance(context.Background(), "0x01")
+	assert.NoError(t, err)
+	assert.Equal(t, "2", balance.String())
+	assert.Equal(t, "2000000000000000000", amount)
+
+	nonce, err := client.GetNonce(context.Background(), "0x01")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(42), nonce)
+
+	_, err = client.GetNonce(context.Background(), "0xbad")
+	assert.EqualError(t, err, "rpc response error: -32602 invalid address")
+
+	status = http.StatusMultipleChoices
+	_, _, err = client.Balance(context.Background(), "0x01")
+	assert.EqualError(t, err, "get status code: 300")
+}
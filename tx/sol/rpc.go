@@ -143,3 +143,18 @@ func (c *Client) GetTokenSupply(ctx context.Context, contractAddress string) (Ge
 	}
 	return res, nil
 }
+
+// GetSignaturesForAddress returns signatures of confirmed transactions that include the given address
+func (c *Client) GetSignaturesForAddress(ctx context.Context, base58Addr string, limit int) (GetSignaturesForAddressResponse, error) {
+	var res GetSignaturesForAddressResponse
+	body, rpcErr := c.Call(ctx, "getSignaturesForAddress", base58Addr, map[string]interface{}{"limit": limit})
+	err := c.processRpcCall(body, rpcErr, &res)
+	if err != nil {
+		return GetSignaturesForAddressResponse{}, err
+	}
+	err = CheckRpcResult(res.GeneralResponse, err)
+	if err != nil {
+		return GetSignaturesForAddressResponse{}, err
+	}
+	return res, nil
+}
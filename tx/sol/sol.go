@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math/big"
 	"strings"
 	"time"
 
@@ -77,6 +78,20 @@ func (c *Sol) GetBalance(ctx context.Context, base58Addr string) (uint64, error)
 	return c.Client.GetBalance(ctx, base58Addr)
 }
 
+// ToDecimal converts lamports to sol
+func (c *Sol) ToDecimal(lamports uint64) decimal.Decimal {
+	return decimal.NewFromBigInt(new(big.Int).SetUint64(lamports), int32(-c.Decimals))
+}
+
+// HasHistory reports whether the address has any confirmed transaction
+func (c *Sol) HasHistory(ctx context.Context, base58Addr string) (bool, error) {
+	res, err := c.Client.GetSignaturesForAddress(ctx, base58Addr, 1)
+	if err != nil {
+		return false, err
+	}
+	return len(res.Result) > 0, nil
+}
+
 func (c *Sol) GetTokenBalance(associatedAddress string) (decimals int, amount string, amountDecimal decimal.Decimal, err error) {
 	res, err1 := c.Client.GetAccountInfoWithCfg(context.Background(), associatedAddress, Cfg{
 		Encoding: "jsonParsed",
@@ -60,6 +60,17 @@ type GetBalanceResult struct {
 	Value   uint64  `json:"value"`
 }
 
+// GetSignaturesForAddressResponse is a full raw rpc response of `getSignaturesForAddress`
+type GetSignaturesForAddressResponse struct {
+	GeneralResponse
+	Result []SignatureInfo `json:"result"`
+}
+
+type SignatureInfo struct {
+	Signature string `json:"signature"`
+	Slot      uint64 `json:"slot"`
+}
+
 type Context struct {
 	Slot uint64 `json:"slot"`
 }